@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	deleteAccountCallbackPrefix = "deleteaccount:"
+	// deletionGracePeriod is how long /start can still restore a deleted account
+	deletionGracePeriod = 7 * 24 * time.Hour
+)
+
+// UserData is everything the bot stores about a user, sent by /mydata.
+type UserData struct {
+	ExportedAt    time.Time      `json:"exported_at"`
+	User          User           `json:"user"`
+	Preferences   *Preferences   `json:"preferences"`
+	Allowlisted   bool           `json:"allowlisted"`
+	QuotaOverride *QuotaOverride `json:"quota_override,omitempty"`
+	Alerts        []Alert        `json:"alerts"`
+	Positions     []Position     `json:"positions"`
+	Notifications []Notification `json:"notifications"`
+	Invites       []Invite       `json:"invites_created"`
+}
+
+func (b *TelegramBot) myData(c *CommandContext) error {
+	data := UserData{ExportedAt: time.Now().UTC(), User: *c.User, Preferences: b.preferences(c.UserId), Alerts: []Alert{}, Positions: []Position{}, Notifications: []Notification{}, Invites: []Invite{}}
+	var err error
+	if data.Allowlisted, err = b.store.IsAllowlisted(c.UserId); err != nil {
+		return err
+	}
+	if override, err := b.store.GetQuotaOverride(c.UserId); err == nil {
+		data.QuotaOverride = override
+	}
+	alerts, err := b.store.GetAlertsByUserId(c.UserId)
+	if err != nil {
+		return err
+	}
+	data.Alerts = append(data.Alerts, alerts...)
+	positions, err := b.store.GetPositionsByUserId(c.UserId)
+	if err != nil {
+		return err
+	}
+	data.Positions = append(data.Positions, positions...)
+	notifications, err := b.store.GetNotificationsByUserId(c.UserId)
+	if err != nil {
+		return err
+	}
+	data.Notifications = append(data.Notifications, notifications...)
+	invites, err := b.store.GetInvites()
+	if err != nil {
+		return err
+	}
+	for _, invite := range invites {
+		if invite.CreatedBy == c.UserId {
+			data.Invites = append(data.Invites, invite)
+		}
+	}
+
+	bytes, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+	// the document may end up in a group, the data only goes to the user
+	name := fmt.Sprintf("goalertify-mydata-%s.json", data.ExportedAt.Format("2006-01-02"))
+	if err := b.sendDocument(c.UserId, name, bytes, c.T("account.mydata_caption")); err != nil {
+		return b.sendMessage(c.ChatId, c.T("account.mydata_private_failed"))
+	}
+	if c.ChatId != c.UserId {
+		return b.sendMessage(c.ChatId, c.T("account.mydata_sent"))
+	}
+	return nil
+}
+
+// deleteUser asks for a confirmation before scheduling the deletion of the
+// account.
+func (b *TelegramBot) deleteUser(c *CommandContext) error {
+	count, err := b.store.CountActiveAlertsByUserId(c.UserId)
+	if err != nil {
+		return err
+	}
+	userId := strconv.FormatInt(c.UserId, 10)
+	days := int(deletionGracePeriod / (24 * time.Hour))
+	msg := tgbotapi.NewMessage(c.ChatId, c.T("account.delete_confirm", "alerts", count)+"\n"+c.T("account.delete_grace", "count", days))
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(c.T("account.delete_button"), deleteAccountCallbackPrefix+"confirm:"+userId),
+			tgbotapi.NewInlineKeyboardButtonData(c.T("button.cancel"), deleteAccountCallbackPrefix+"cancel:"+userId),
+		),
+	)
+	_, err = b.bot.Send(msg)
+	return err
+}
+
+func (b *TelegramBot) handleDeleteAccountButton(query *tgbotapi.CallbackQuery) {
+	action, id, _ := strings.Cut(strings.TrimPrefix(query.Data, deleteAccountCallbackPrefix), ":")
+	userId, _ := strconv.ParseInt(id, 10, 64)
+	lang := b.language(query.From.ID, query.From.LanguageCode)
+	if userId != query.From.ID {
+		b.bot.Send(tgbotapi.NewCallback(query.ID, T(lang, "account.delete_not_owner")))
+		return
+	}
+
+	var text string
+	if action == "confirm" {
+		deleteAt := time.Now().UTC().Add(deletionGracePeriod)
+		if err := b.store.ScheduleUserDeletion(userId, &deleteAt); err != nil {
+			log.Printf("Error scheduling deletion of %d: %s", userId, err.Error())
+			text = T(lang, "account.delete_failed")
+		} else {
+			text = T(lang, "account.delete_scheduled", "time", b.preferences(userId).FormatTime(deleteAt))
+		}
+	} else {
+		text = T(lang, "account.delete_cancelled")
+	}
+
+	b.bot.Send(tgbotapi.NewCallback(query.ID, ""))
+	b.bot.Send(tgbotapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID, text))
+}
+
+// restoreUser cancels a scheduled deletion, called by /start.
+func (b *TelegramBot) restoreUser(c *CommandContext, user *User) error {
+	if err := b.store.ScheduleUserDeletion(user.UserId, nil); err != nil {
+		return err
+	}
+	if !user.Active {
+		if err := b.store.SetUserActive(user.UserId, true); err != nil {
+			return err
+		}
+	}
+	return b.sendMessage(c.ChatId, c.T("account.restored"))
+}
+
+// startDeletionPurger deletes the accounts whose grace period is over.
+func (b *TelegramBot) startDeletionPurger() {
+	for {
+		b.purgeDeletedUsers(time.Now().UTC())
+		time.Sleep(1 * time.Hour)
+	}
+}
+
+func (b *TelegramBot) purgeDeletedUsers(now time.Time) {
+	users, err := b.store.GetUsersScheduledForDeletion()
+	if err != nil {
+		log.Printf("Error retrieving users scheduled for deletion: %s", err.Error())
+		return
+	}
+	for _, u := range users {
+		if u.DeleteAt.After(now) {
+			continue
+		}
+		if err := b.store.DeleteUserAndAlerts(u.UserId); err != nil {
+			log.Printf("Error deleting user %d: %s", u.UserId, err.Error())
+			continue
+		}
+		log.Printf("Deleted user %d after the grace period", u.UserId)
+	}
+}
+
+// pausedUserIds returns the users whose alerts must not trigger because
+// their account is scheduled for deletion.
+func (b *TelegramBot) pausedUserIds() (map[int64]bool, error) {
+	users, err := b.store.GetUsersScheduledForDeletion()
+	if err != nil {
+		return nil, err
+	}
+	paused := make(map[int64]bool)
+	for _, u := range users {
+		paused[u.UserId] = true
+	}
+	return paused, nil
+}
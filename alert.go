@@ -9,59 +9,215 @@ import (
 	"time"
 )
 
+type AlertKind string
+
+const (
+	// AlertPrice fires when the price reaches TargetPrice
+	AlertPrice AlertKind = "price"
+	// AlertTrail is a trailing stop; TargetPrice follows the best price
+	AlertTrail AlertKind = "trail"
+	// AlertCompound fires when Condition holds
+	AlertCompound AlertKind = "compound"
+	// AlertBreakout fires when the price breaks out of the session range
+	// given by Breakout
+	AlertBreakout AlertKind = "breakout"
+	// AlertMove fires whenever Symbol, or any ticker of the category in
+	// Symbol, makes the Move
+	AlertMove AlertKind = "move"
+	// AlertLadder fires at each level of Ladder in turn
+	AlertLadder AlertKind = "ladder"
+	// AlertPnL fires when the position of its user on Symbol reaches the
+	// P&L of PnL; TargetPrice is the price it does at
+	AlertPnL AlertKind = "pnl"
+)
+
 type Alert struct {
 	Id          string    `json:"id"`
 	UserId      int64     `json:"user_id"`
+	ChatId      int64     `json:"chat_id"`
 	Number      int32     `json:"number"`
 	Symbol      string    `json:"symbol"`
 	Description string    `json:"description"`
 	TargetPrice float64   `json:"target_price"`
 	StartPrice  float64   `json:"start_price"`
 	Active      bool      `json:"active"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	Kind        AlertKind `json:"kind"`
+	Trail       Trail     `json:"trail"`
+	Condition   Condition `json:"condition"`
+	Move        Move      `json:"move"`
+	Breakout    Breakout  `json:"breakout"`
+	Ladder      Ladder    `json:"ladder"`
+	PnL         PnL       `json:"pnl"`
+	// MovesFired are the moves a move alert was notified of and that did
+	// not fade yet
+	MovesFired FiredMoves `json:"moves_fired,omitempty"`
+	// ExpiresAt is when the alert is archived, nil for never
+	ExpiresAt *time.Time `json:"expires_at"`
+	// ArchivedAt is set once the alert expired
+	ArchivedAt *time.Time `json:"archived_at"`
+	// Window limits when the alert is checked, the zero window always
+	Window ActiveWindow `json:"window"`
+	// Urgent alerts are delivered during quiet hours
+	Urgent bool `json:"urgent"`
+	// HighPrice and LowPrice are the extremes the price traded at since
+	// WatchedSince, when the target was set
+	HighPrice    float64   `json:"high_price"`
+	LowPrice     float64   `json:"low_price"`
+	WatchedSince time.Time `json:"watched_since"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
 }
 
 func GetCreateAlertsTable() string {
 	return `CREATE TABLE IF NOT EXISTS alerts (
 		id TEXT PRIMARY KEY,
 		user_id INTEGER,
+		chat_id INTEGER,
 		number INTEGER,
 		symbol TEXT NOT NULL,
 		description TEXT,
 		target_price REAL,
 		start_price REAL,
 		active BOOLEAN,
+		urgent BOOLEAN NOT NULL DEFAULT FALSE,
+		kind TEXT NOT NULL DEFAULT 'price',
+		trail_distance REAL NOT NULL DEFAULT 0,
+		trail_percent BOOLEAN NOT NULL DEFAULT FALSE,
+		trail_short BOOLEAN NOT NULL DEFAULT FALSE,
+		condition TEXT NOT NULL DEFAULT '',
+		move_percent REAL NOT NULL DEFAULT 0,
+		move_direction INTEGER NOT NULL DEFAULT 0,
+		move_minutes INTEGER NOT NULL DEFAULT 0,
+		breakout_side TEXT NOT NULL DEFAULT '',
+		breakout_days INTEGER NOT NULL DEFAULT 0,
+		expires_at TIMESTAMP,
+		archived_at TIMESTAMP,
+		active_window TEXT NOT NULL DEFAULT '',
+		ladder TEXT NOT NULL DEFAULT '',
+		pnl_amount REAL NOT NULL DEFAULT 0,
+		pnl_r BOOLEAN NOT NULL DEFAULT FALSE,
+		pnl_short BOOLEAN NOT NULL DEFAULT FALSE,
+		moves_fired TEXT NOT NULL DEFAULT '',
+		high_price REAL NOT NULL DEFAULT 0,
+		low_price REAL NOT NULL DEFAULT 0,
+		watched_since TIMESTAMP,
 		updated_at TIMESTAMP NOT NULL,
 		created_at TIMESTAMP NOT NULL,
 		FOREIGN KEY (user_id) REFERENCES users (user_id)
 	);`
 }
 
-func NewAlert(userId int64, symbol, description string, targetPrice, startPrice float64) *Alert {
-	return &Alert{
+func NewAlert(userId, chatId int64, symbol, description string, targetPrice, startPrice float64) *Alert {
+	alert := &Alert{
 		Id:          fmt.Sprint("AL" + strconv.Itoa(rand.Int())),
 		UserId:      userId,
+		ChatId:      chatId,
 		Number:      9999,
 		Description: description,
 		Symbol:      symbol,
-		TargetPrice: targetPrice,
-		StartPrice:  startPrice,
 		Active:      true,
+		Kind:        AlertPrice,
 		CreatedAt:   time.Now().UTC(),
 		UpdatedAt:   time.Now().UTC(),
 	}
+	alert.SetTarget(targetPrice, startPrice)
+	return alert
+}
+
+// NewTrailingStop creates a trailing stop following the price from livePrice.
+func NewTrailingStop(userId, chatId int64, symbol, description string, trail Trail, livePrice float64) *Alert {
+	alert := NewAlert(userId, chatId, symbol, description, trail.stop(livePrice), livePrice)
+	alert.Kind = AlertTrail
+	alert.Trail = trail
+	return alert
+}
+
+// SetTarget points the alert at a new target, watching the price from now on.
+func (a *Alert) SetTarget(targetPrice, startPrice float64) {
+	a.TargetPrice = targetPrice
+	a.StartPrice = startPrice
+	a.HighPrice, a.LowPrice = startPrice, startPrice
+	a.WatchedSince = time.Now().UTC()
+}
+
+// observe widens the range the price traded at since the alert started
+// watching with the latest quote of its ticker, and reports whether it
+// changed. The prices traded since the previous quote only count when that
+// quote came after the alert was set, otherwise only the live price does.
+func (a *Alert) observe(t *Ticker) bool {
+	if !t.UpdatedAt.After(a.WatchedSince) {
+		return false
+	}
+	high, low := t.LivePrice, t.LivePrice
+	if !t.PrevUpdatedAt.Before(a.WatchedSince) {
+		high, low = t.RangeHigh, t.RangeLow
+	}
+	if high <= a.HighPrice && low >= a.LowPrice {
+		return false
+	}
+	a.HighPrice, a.LowPrice = max(a.HighPrice, high), min(a.LowPrice, low)
+	if a.Kind == AlertTrail {
+		a.TargetPrice = a.Trail.stop(a.bestPrice())
+	}
+	return true
+}
+
+// bestPrice is the extreme a trailing stop follows.
+func (a *Alert) bestPrice() float64 {
+	if a.Trail.Short {
+		return a.LowPrice
+	}
+	return a.HighPrice
 }
 
-func (a *Alert) ToString(livePrice float64) string {
+// triggered reports whether the alert fires at the latest quote of its
+// ticker, after observe took the quote in.
+func (a *Alert) triggered(t *Ticker) bool {
+	tolerance := t.Meta.Tolerance()
+	if a.Kind == AlertTrail {
+		if a.Trail.Short {
+			return t.LivePrice >= a.TargetPrice-tolerance
+		}
+		return t.LivePrice <= a.TargetPrice+tolerance
+	}
+	if a.Kind == AlertPnL {
+		return a.pnlReached(tolerance)
+	}
+	return a.crossed(tolerance)
+}
+
+// crossed reports whether the price reached the target since the alert
+// started watching: targets above the start price need a high at or above
+// them, targets below a low at or below them, within the tolerance.
+func (a *Alert) crossed(tolerance float64) bool {
+	if a.TargetPrice >= a.StartPrice {
+		return a.HighPrice >= a.TargetPrice-tolerance
+	}
+	return a.LowPrice <= a.TargetPrice+tolerance
+}
+
+// ToString renders the alert as a card, formatted with the preferences of
+// the user viewing it.
+func (a *Alert) ToString(livePrice float64, prefs *Preferences, lang string) string {
+	return a.card(livePrice, prefs, lang) + a.validityString(prefs, lang)
+}
+
+func (a *Alert) card(livePrice float64, prefs *Preferences, lang string) string {
 	var diffTargetPrice = a.TargetPrice - livePrice
 	var diffStartPrice = livePrice - a.StartPrice
 	var activeIcon string
-	if a.Active {
+	if a.ArchivedAt != nil {
+		activeIcon = "\U0001F5C4"
+	} else if a.Active && !a.Window.contains(time.Now()) {
+		activeIcon = "\u23F8"
+	} else if a.Active {
 		activeIcon = "\U0001F7E2"
 	} else {
 		activeIcon = "\U0001F534"
 	}
+	if a.Urgent {
+		activeIcon += "\u26A1"
+	}
 	var diffStartPriceIcon string
 	if diffStartPrice == 0 {
 		diffStartPriceIcon = "\u27A1\uFE0F"
@@ -76,6 +232,38 @@ func (a *Alert) ToString(livePrice float64) string {
 	} else {
 		diffTargetPriceIcon = "\U0001F539"
 	}
-	return fmt.Sprintf("#%d [%s] %s %s\n(%.5f) => [%s %.5f]\n(%.5f) => [%s %.5f]",
-		a.Number, strings.ToUpper(a.Symbol), activeIcon, a.Description, a.TargetPrice, diffTargetPriceIcon, math.Abs(diffTargetPrice), livePrice, diffStartPriceIcon, diffStartPrice)
+	switch a.Kind {
+	case AlertCompound:
+		return a.compoundString(activeIcon, prefs, lang)
+	case AlertMove:
+		return a.moveString(activeIcon, prefs, lang)
+	case AlertBreakout:
+		return a.breakoutString(activeIcon, livePrice, prefs, lang)
+	case AlertLadder:
+		return a.ladderString(activeIcon, livePrice, prefs, lang)
+	}
+	price := func(p float64) string {
+		return prefs.FormatPrice(a.Symbol, p)
+	}
+	symbol := strings.ToUpper(a.Symbol)
+	switch a.Kind {
+	case AlertTrail:
+		symbol += " trail " + a.Trail.String()
+	case AlertPnL:
+		symbol += " P&L " + a.PnL.String()
+	}
+	if prefs.Cards == CardCompact {
+		return fmt.Sprintf("#%d [%s] %s %s [%s %s] %s",
+			a.Number, symbol, activeIcon, price(a.TargetPrice), diffTargetPriceIcon, price(math.Abs(diffTargetPrice)), a.Description)
+	}
+	card := fmt.Sprintf("#%d [%s] %s %s\n(%s) => [%s %s]\n(%s) => [%s %s]",
+		a.Number, symbol, activeIcon, a.Description, price(a.TargetPrice), diffTargetPriceIcon, price(math.Abs(diffTargetPrice)), price(livePrice), diffStartPriceIcon, price(diffStartPrice))
+	if a.Kind == AlertTrail {
+		card += "\n" + T(lang, "trail.card_best", "best", price(a.bestPrice()))
+	}
+	// forex traders count distances in pips
+	if t, exist := getTicker(a.Symbol); exist && t.Meta.AssetClass == AssetForex && livePrice > 0 {
+		card += "\n" + T(lang, "alert.card_pips", "pips", strconv.FormatFloat(math.Abs(t.Meta.Pips(diffTargetPrice)), 'f', 1, 64))
+	}
+	return card + "\n" + T(lang, "alert.card_created", "time", prefs.FormatTime(a.CreatedAt))
 }
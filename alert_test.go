@@ -0,0 +1,151 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTickerUpdateRange(t *testing.T) {
+	tests := []struct {
+		name              string
+		dailyHigh, low    float64
+		live              float64
+		newHigh, newLow   float64
+		wantHigh, wantLow float64
+	}{
+		{name: "between quotes", dailyHigh: 1.09, low: 1.08, live: 1.085, newHigh: 1.09, newLow: 1.08, wantHigh: 1.086, wantLow: 1.085},
+		{name: "new daily high", dailyHigh: 1.09, low: 1.08, live: 1.085, newHigh: 1.095, newLow: 1.08, wantHigh: 1.095, wantLow: 1.085},
+		{name: "new daily low", dailyHigh: 1.09, low: 1.08, live: 1.085, newHigh: 1.09, newLow: 1.07, wantHigh: 1.086, wantLow: 1.07},
+		{name: "no daily range", live: 1.085, wantHigh: 1.086, wantLow: 1.085},
+	}
+	for _, tt := range tests {
+		ticker := NewTicker("eurusd", "euro", "forex", 1.086, tt.dailyHigh, tt.low)
+		ticker.Update(tt.live, tt.newHigh, tt.newLow)
+		if ticker.PrevPrice != 1.086 {
+			t.Errorf("%s: PrevPrice = %g, want 1.086", tt.name, ticker.PrevPrice)
+		}
+		if ticker.RangeHigh != tt.wantHigh || ticker.RangeLow != tt.wantLow {
+			t.Errorf("%s: range = [%g, %g], want [%g, %g]", tt.name, ticker.RangeLow, ticker.RangeHigh, tt.wantLow, tt.wantHigh)
+		}
+	}
+}
+
+func TestAlertCrossed(t *testing.T) {
+	watched := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	before, after, later := watched.Add(-time.Minute), watched.Add(time.Minute), watched.Add(2*time.Minute)
+	tests := []struct {
+		name         string
+		target       float64
+		start        float64
+		high, low    float64
+		ticker       Ticker
+		tolerance    float64
+		wantObserved bool
+		want         bool
+	}{
+		{
+			name:         "within 1% of a crypto target is not a cross",
+			target:       60000,
+			start:        59000,
+			ticker:       Ticker{LivePrice: 59401, PrevPrice: 59000, RangeHigh: 59401, RangeLow: 59000, PrevUpdatedAt: after, UpdatedAt: later},
+			wantObserved: true,
+			want:         false,
+		},
+		{
+			name:         "live price at the target",
+			target:       60000,
+			start:        59000,
+			ticker:       Ticker{LivePrice: 60000, PrevPrice: 59500, RangeHigh: 60000, RangeLow: 59500, PrevUpdatedAt: after, UpdatedAt: later},
+			wantObserved: true,
+			want:         true,
+		},
+		{
+			name:         "live price within half a tick of the target",
+			target:       1.1,
+			start:        1.09,
+			ticker:       Ticker{LivePrice: 1.099996, PrevPrice: 1.095, RangeHigh: 1.099996, RangeLow: 1.095, PrevUpdatedAt: after, UpdatedAt: later},
+			tolerance:    0.000005,
+			wantObserved: true,
+			want:         true,
+		},
+		{
+			name:         "crossed up between the previous and live price",
+			target:       60000,
+			start:        59000,
+			ticker:       Ticker{LivePrice: 60100, PrevPrice: 59900, RangeHigh: 60100, RangeLow: 59900, PrevUpdatedAt: after, UpdatedAt: later},
+			wantObserved: true,
+			want:         true,
+		},
+		{
+			name:         "crossed down between the previous and live price",
+			target:       1.08,
+			start:        1.09,
+			ticker:       Ticker{LivePrice: 1.0795, PrevPrice: 1.0805, RangeHigh: 1.0805, RangeLow: 1.0795, PrevUpdatedAt: after, UpdatedAt: later},
+			wantObserved: true,
+			want:         true,
+		},
+		{
+			name:         "new daily high traded through the target and came back",
+			target:       1.1,
+			start:        1.09,
+			ticker:       Ticker{LivePrice: 1.095, PrevPrice: 1.094, RangeHigh: 1.1002, RangeLow: 1.094, PrevUpdatedAt: after, UpdatedAt: later},
+			wantObserved: true,
+			want:         true,
+		},
+		{
+			name:         "old daily high from before the alert does not count",
+			target:       1.1,
+			start:        1.09,
+			ticker:       Ticker{LivePrice: 1.095, PrevPrice: 1.094, DailyHigh: 1.12, DailyLow: 1.08, RangeHigh: 1.095, RangeLow: 1.094, PrevUpdatedAt: after, UpdatedAt: later},
+			wantObserved: true,
+			want:         false,
+		},
+		{
+			name:         "range of a quote spanning the creation only counts the live price",
+			target:       1.1,
+			start:        1.09,
+			ticker:       Ticker{LivePrice: 1.095, PrevPrice: 1.101, RangeHigh: 1.101, RangeLow: 1.095, PrevUpdatedAt: before, UpdatedAt: after},
+			wantObserved: true,
+			want:         false,
+		},
+		{
+			name:         "quote from before the alert is ignored",
+			target:       1.1,
+			start:        1.09,
+			ticker:       Ticker{LivePrice: 1.105, PrevPrice: 1.09, RangeHigh: 1.105, RangeLow: 1.09, PrevUpdatedAt: before, UpdatedAt: before},
+			wantObserved: false,
+			want:         false,
+		},
+		{
+			name:         "high observed earlier keeps the alert crossed",
+			target:       60000,
+			start:        59000,
+			high:         60010,
+			low:          59000,
+			ticker:       Ticker{LivePrice: 59000, PrevPrice: 59100, RangeHigh: 59100, RangeLow: 59000, PrevUpdatedAt: after, UpdatedAt: later},
+			wantObserved: false,
+			want:         true,
+		},
+		{
+			name:         "move away from the target",
+			target:       60000,
+			start:        59000,
+			ticker:       Ticker{LivePrice: 58000, PrevPrice: 58500, RangeHigh: 58500, RangeLow: 58000, PrevUpdatedAt: after, UpdatedAt: later},
+			wantObserved: true,
+			want:         false,
+		},
+	}
+	for _, tt := range tests {
+		alert := &Alert{TargetPrice: tt.target, StartPrice: tt.start, HighPrice: tt.start, LowPrice: tt.start, WatchedSince: watched}
+		if tt.high != 0 {
+			alert.HighPrice, alert.LowPrice = tt.high, tt.low
+		}
+		ticker := tt.ticker
+		if observed := alert.observe(&ticker); observed != tt.wantObserved {
+			t.Errorf("%s: observe() = %t, want %t", tt.name, observed, tt.wantObserved)
+		}
+		if got := alert.crossed(tt.tolerance); got != tt.want {
+			t.Errorf("%s: crossed() = %t, want %t (range [%g, %g])", tt.name, got, tt.want, alert.LowPrice, alert.HighPrice)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+)
+
+// Breakout sides: a break above the high or below the low of the last Days
+// sessions, today's included, or a return into the range of the previous
+// session after trading outside of it.
+const (
+	BreakoutHigh    = "high"
+	BreakoutLow     = "low"
+	BreakoutReenter = "reenter"
+)
+
+// Breakout is the session range a breakout alert watches.
+type Breakout struct {
+	Side string `json:"side"`
+	// Days is the number of sessions whose extreme a high or low must
+	// exceed, 1 for today's
+	Days int `json:"days"`
+}
+
+var errInvalidBreakout = errors.New("invalid breakout")
+
+// parseBreakout reads `high|low [days]` or `reenter` from the start of
+// fields, returning the breakout and the number of fields it used.
+func parseBreakout(fields []string) (Breakout, int, error) {
+	var breakout Breakout
+	if len(fields) == 0 {
+		return breakout, 0, errInvalidBreakout
+	}
+	breakout.Side = strings.ToLower(fields[0])
+	switch breakout.Side {
+	case BreakoutReenter:
+		return breakout, 1, nil
+	case BreakoutHigh, BreakoutLow:
+	default:
+		return breakout, 0, errInvalidBreakout
+	}
+	breakout.Days = 1
+	if len(fields) > 1 {
+		// a number after the side is the days, anything else the description
+		if days, err := strconv.Atoi(fields[1]); err == nil {
+			if days < 1 || days > maxSessionDays {
+				return breakout, 0, errInvalidBreakout
+			}
+			breakout.Days = days
+			return breakout, 2, nil
+		}
+	}
+	return breakout, 1, nil
+}
+
+// String renders the breakout in the syntax parseBreakout reads.
+func (b Breakout) String() string {
+	if b.Days > 1 {
+		return b.Side + " " + strconv.Itoa(b.Days)
+	}
+	return b.Side
+}
+
+// Label names the range the breakout watches, such as today's high.
+func (b Breakout) Label(lang string) string {
+	if b.Days > 1 {
+		return T(lang, "breakout."+b.Side+"_days", "days", b.Days)
+	}
+	return T(lang, "breakout."+b.Side)
+}
+
+// need is the number of sessions, today's included, the breakout needs.
+func (b Breakout) need() int {
+	if b.Side == BreakoutReenter {
+		return 2
+	}
+	return b.Days
+}
+
+// level returns the extreme a high or low breakout must exceed on a
+// trading day, from the sessions of the symbol, newest first; ok is false
+// while fewer sessions were recorded than the breakout looks back on.
+func (b Breakout) level(history []Session, day string) (level float64, ok bool) {
+	days := b.Days
+	if len(history) == 0 || history[0].Day != day {
+		// the first quote of the day has no prices of today to beat yet
+		days--
+	}
+	if days == 0 || len(history) < days {
+		return 0, false
+	}
+	level = history[0].High
+	if b.Side == BreakoutLow {
+		level = history[0].Low
+	}
+	for _, s := range history[:days] {
+		if b.Side == BreakoutLow {
+			level = min(level, s.Low)
+		} else {
+			level = max(level, s.High)
+		}
+	}
+	return level, true
+}
+
+// previousSession returns the last session before a trading day.
+func previousSession(history []Session, day string) (Session, bool) {
+	for _, s := range history {
+		if s.Day < day {
+			return s, true
+		}
+	}
+	return Session{}, false
+}
+
+// breakoutTriggered reports whether a breakout alert fires at the latest
+// quote of its ticker, checked against the sessions before the quote, and
+// whether the range the alert watched changed. Re-entries watch the price
+// from the start of the session on, so the alert starts over every day.
+func (a *Alert) breakoutTriggered(t *Ticker, history []Session) (observed, triggered bool) {
+	day := tradingDay(t.Category, t.UpdatedAt)
+	if a.Breakout.Side != BreakoutReenter {
+		level, ok := a.Breakout.level(history, day)
+		if !ok {
+			return false, false
+		}
+		high, low := quoteRange(t)
+		if a.Breakout.Side == BreakoutLow {
+			return false, low < level
+		}
+		return false, high > level
+	}
+
+	if tradingDay(t.Category, a.WatchedSince) != day {
+		a.SetTarget(0, t.LivePrice)
+		observed = true
+	}
+	observed = a.observe(t) || observed
+	prev, ok := previousSession(history, day)
+	if !ok {
+		return observed, false
+	}
+	outside := a.HighPrice > prev.High || a.LowPrice < prev.Low
+	return observed, outside && t.LivePrice >= prev.Low && t.LivePrice <= prev.High
+}
+
+// NewBreakoutAlert creates an alert on a break of the session range of a
+// symbol.
+func NewBreakoutAlert(userId, chatId int64, symbol, description string, breakout Breakout, livePrice float64) *Alert {
+	alert := NewAlert(userId, chatId, symbol, description, 0, livePrice)
+	alert.Kind = AlertBreakout
+	alert.Breakout = breakout
+	return alert
+}
+
+// breakoutString renders a breakout alert as a card.
+func (a *Alert) breakoutString(activeIcon string, livePrice float64, prefs *Preferences, lang string) string {
+	header := fmt.Sprintf("#%d [%s %s] %s %s", a.Number, strings.ToUpper(a.Symbol), a.Breakout, activeIcon, a.Description)
+	if prefs.Cards == CardCompact {
+		return header
+	}
+	price := func(p float64) string {
+		return prefs.FormatPrice(a.Symbol, p)
+	}
+	lines := []string{header}
+	history := cachedSessions(a.Symbol)
+	var day string
+	if t, exist := getTicker(a.Symbol); exist {
+		day = tradingDay(t.Category, t.UpdatedAt)
+	}
+	if a.Breakout.Side == BreakoutReenter {
+		if prev, ok := previousSession(history, day); ok {
+			lines = append(lines, T(lang, "breakout.card_range", "label", a.Breakout.Label(lang), "low", price(prev.Low), "high", price(prev.High), "price", price(livePrice)))
+		} else {
+			lines = append(lines, T(lang, "breakout.card_warming", "have", len(history), "need", a.Breakout.need()))
+		}
+	} else if level, ok := a.Breakout.level(history, day); ok {
+		lines = append(lines, T(lang, "breakout.card_level", "label", a.Breakout.Label(lang), "level", price(level), "price", price(livePrice)))
+	} else {
+		lines = append(lines, T(lang, "breakout.card_warming", "have", len(history), "need", a.Breakout.need()))
+	}
+	lines = append(lines, T(lang, "alert.card_created", "time", prefs.FormatTime(a.CreatedAt)))
+	return strings.Join(lines, "\n")
+}
+
+// breakoutTriggeredText is the notification of a breakout alert that fired
+// at the latest quote of its ticker.
+func breakoutTriggeredText(alert *Alert, t *Ticker, history []Session, prefs *Preferences, lang string) string {
+	price := func(p float64) string {
+		return prefs.FormatPrice(alert.Symbol, p)
+	}
+	day := tradingDay(t.Category, t.UpdatedAt)
+	if alert.Breakout.Side == BreakoutReenter {
+		prev, _ := previousSession(history, day)
+		return T(lang, "breakout.triggered_reenter", "symbol", alert.Symbol, "price", price(t.LivePrice), "low", price(prev.Low), "high", price(prev.High), "description", html.EscapeString(alert.Description))
+	}
+	level, _ := alert.Breakout.level(history, day)
+	return T(lang, "breakout.triggered", "symbol", alert.Symbol, "label", alert.Breakout.Label(lang), "level", price(level), "price", price(t.LivePrice), "description", html.EscapeString(alert.Description))
+}
+
+// createBreakoutAlert handles `/createalert <symbol> high|low [days]
+// [description]` and `/createalert <symbol> reenter [description]`.
+func (b *TelegramBot) createBreakoutAlert(c *CommandContext, alertChatId int64, t *Ticker) error {
+	fields := []string{c.Args[1]}
+	if len(c.Args) > 2 {
+		fields = append(fields, strings.Fields(c.Args[2])...)
+	}
+	breakout, used, err := parseBreakout(fields)
+	if err != nil {
+		return b.sendMessage(c.ChatId, c.T("breakout.invalid", "max", maxSessionDays))
+	}
+	description := strings.Join(fields[used:], " ")
+	if description == "" {
+		description = c.Flags["note"]
+	}
+
+	alert := NewBreakoutAlert(c.UserId, alertChatId, t.Symbol, description, breakout, t.LivePrice)
+	alert.Urgent = c.Flags["urgent"] == "true"
+	if ok, err := b.setValidity(c, alert); !ok {
+		return err
+	}
+	if err := b.store.CreateAlert(alert); err != nil {
+		return b.sendMessage(c.ChatId, c.T("alert.store_failed"))
+	}
+	history := b.sessionHistory(t.Symbol)
+	if len(history) < breakout.need() {
+		return b.sendMessage(c.ChatId, c.T("breakout.created_warming", "label", breakout.Label(c.Lang), "have", len(history), "need", breakout.need()))
+	}
+	return b.sendMessage(c.ChatId, c.T("breakout.created", "label", breakout.Label(c.Lang)))
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	broadcastCallbackPrefix = "broadcast:"
+	// Telegram allows about 30 messages per second in total, stay below it
+	broadcastInterval = 40 * time.Millisecond
+	// how often the progress message is updated while delivering
+	broadcastProgressEvery = 25
+	// how long a preview can be confirmed
+	broadcastPendingExpiry = 30 * time.Minute
+)
+
+// Broadcast is an announcement waiting for its author to confirm it.
+type Broadcast struct {
+	Id         string
+	AuthorId   int64
+	ChatId     int64
+	Target     string
+	Text       string
+	Recipients []User
+	// Lang is the language of the author, used for the progress reports
+	Lang      string
+	CreatedAt time.Time
+}
+
+type BroadcastTally struct {
+	Delivered int
+	Blocked   int
+	Failed    int
+}
+
+func (t BroadcastTally) toTelegramString(lang string) string {
+	return T(lang, "broadcast.tally", "delivered", t.Delivered, "blocked", t.Blocked, "failed", t.Failed)
+}
+
+var (
+	pendingBroadcastsMu sync.Mutex
+	pendingBroadcasts   = make(map[string]*Broadcast)
+)
+
+// isBlockedError reports whether Telegram refused a message because the user
+// blocked the bot or deleted their account.
+func isBlockedError(err error) bool {
+	var apiErr *tgbotapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == 403
+}
+
+// broadcastRecipients resolves a broadcast target: all, role:<role> or
+// symbol:<symbol>. Inactive and banned users are skipped.
+func (b *TelegramBot) broadcastRecipients(target string) ([]User, error) {
+	var filter func(u User) bool
+	kind, value, _ := strings.Cut(strings.ToLower(target), ":")
+	switch kind {
+	case "all":
+		filter = func(u User) bool { return true }
+	case "role":
+		role, ok := ParseRole(value)
+		if !ok {
+			return nil, fmt.Errorf("unknown role %q", value)
+		}
+		filter = func(u User) bool { return u.Role == role }
+	case "symbol":
+		userIds, err := b.store.GetUserIdsWithAlertsOnSymbol(value)
+		if err != nil {
+			return nil, err
+		}
+		watching := make(map[int64]bool)
+		for _, userId := range userIds {
+			watching[userId] = true
+		}
+		filter = func(u User) bool { return watching[u.UserId] }
+	default:
+		return nil, fmt.Errorf("unknown target %q, use all, role:<role> or symbol:<symbol>", target)
+	}
+
+	users, err := b.store.GetUsers()
+	if err != nil {
+		return nil, err
+	}
+	var recipients []User
+	for _, u := range users {
+		if u.Active && u.Role != RoleBanned && filter(u) {
+			recipients = append(recipients, u)
+		}
+	}
+	return recipients, nil
+}
+
+// broadcast previews the announcement given after the target, or the message
+// the command replies to, so multi-line text arrives as it was written.
+func (b *TelegramBot) broadcast(c *CommandContext) error {
+	var text string
+	if len(c.Args) > 1 {
+		text = c.Args[1]
+	} else if reply := c.Message.ReplyToMessage; reply != nil {
+		text = reply.Text
+		if text == "" {
+			text = reply.Caption
+		}
+	}
+	if strings.TrimSpace(text) == "" {
+		return b.sendUsage(c)
+	}
+
+	recipients, err := b.broadcastRecipients(c.Args[0])
+	if err != nil {
+		return b.sendMessage(c.ChatId, c.T("broadcast.invalid_target", "error", err.Error()))
+	}
+	if len(recipients) == 0 {
+		return b.sendMessage(c.ChatId, c.T("broadcast.no_recipients"))
+	}
+
+	buf := make([]byte, 6)
+	if _, err := rand.Read(buf); err != nil {
+		return err
+	}
+	broadcast := &Broadcast{
+		Id:         hex.EncodeToString(buf),
+		AuthorId:   c.UserId,
+		ChatId:     c.ChatId,
+		Target:     c.Args[0],
+		Text:       text,
+		Recipients: recipients,
+		Lang:       c.Lang,
+		CreatedAt:  time.Now(),
+	}
+	pendingBroadcastsMu.Lock()
+	for id, pending := range pendingBroadcasts {
+		if time.Since(pending.CreatedAt) > broadcastPendingExpiry {
+			delete(pendingBroadcasts, id)
+		}
+	}
+	pendingBroadcasts[broadcast.Id] = broadcast
+	pendingBroadcastsMu.Unlock()
+
+	msg := tgbotapi.NewMessage(c.ChatId, c.T("broadcast.preview", "target", broadcast.Target, "count", len(recipients))+"\n\n"+broadcast.Text)
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(c.T("broadcast.send"), broadcastCallbackPrefix+"send:"+broadcast.Id),
+			tgbotapi.NewInlineKeyboardButtonData(c.T("button.cancel"), broadcastCallbackPrefix+"cancel:"+broadcast.Id),
+		),
+	)
+	_, err = b.bot.Send(msg)
+	return err
+}
+
+func (b *TelegramBot) handleBroadcastButton(query *tgbotapi.CallbackQuery) {
+	action, id, _ := strings.Cut(strings.TrimPrefix(query.Data, broadcastCallbackPrefix), ":")
+
+	pendingBroadcastsMu.Lock()
+	broadcast, exist := pendingBroadcasts[id]
+	if exist && time.Since(broadcast.CreatedAt) > broadcastPendingExpiry {
+		delete(pendingBroadcasts, id)
+		exist = false
+	}
+	if exist && broadcast.AuthorId == query.From.ID {
+		delete(pendingBroadcasts, id)
+	}
+	pendingBroadcastsMu.Unlock()
+
+	lang := b.language(query.From.ID, query.From.LanguageCode)
+	var text string
+	switch {
+	case !exist:
+		text = T(lang, "broadcast.not_pending")
+	case broadcast.AuthorId != query.From.ID:
+		b.bot.Send(tgbotapi.NewCallback(query.ID, T(lang, "broadcast.author_only")))
+		return
+	case action == "send":
+		text = T(lang, "broadcast.sending", "count", len(broadcast.Recipients))
+		go b.deliverBroadcast(broadcast, query.Message.MessageID)
+	default:
+		text = T(lang, "broadcast.cancelled")
+	}
+
+	b.bot.Send(tgbotapi.NewCallback(query.ID, ""))
+	b.bot.Send(tgbotapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID, text))
+}
+
+// deliverBroadcast sends the broadcast at a pace Telegram accepts, reporting
+// progress by editing the confirmation message.
+func (b *TelegramBot) deliverBroadcast(broadcast *Broadcast, progressMessageId int) {
+	var tally BroadcastTally
+	throttle := time.NewTicker(broadcastInterval)
+	defer throttle.Stop()
+
+	for i, user := range broadcast.Recipients {
+		<-throttle.C
+		err := b.sendWithRetry(tgbotapi.NewMessage(user.UserId, broadcast.Text))
+		switch {
+		case err == nil:
+			tally.Delivered++
+		case isBlockedError(err):
+			tally.Blocked++
+			if err := b.store.SetUserActive(user.UserId, false); err != nil {
+				log.Printf("Error marking user %d inactive: %s", user.UserId, err.Error())
+			}
+		default:
+			tally.Failed++
+			log.Printf("Error broadcasting to user %d: %s", user.UserId, err.Error())
+		}
+
+		if (i+1)%broadcastProgressEvery == 0 && i+1 < len(broadcast.Recipients) {
+			progress := T(broadcast.Lang, "broadcast.progress", "sent", i+1, "total", len(broadcast.Recipients)) + "\n\n" + tally.toTelegramString(broadcast.Lang)
+			b.bot.Send(tgbotapi.NewEditMessageText(broadcast.ChatId, progressMessageId, progress))
+		}
+	}
+
+	b.bot.Send(tgbotapi.NewEditMessageText(broadcast.ChatId, progressMessageId, T(broadcast.Lang, "broadcast.finished", "target", broadcast.Target)+"\n\n"+tally.toTelegramString(broadcast.Lang)))
+}
+
+// sendWithRetry sends a message, waiting once when Telegram asks us to slow
+// down.
+func (b *TelegramBot) sendWithRetry(msg tgbotapi.Chattable) error {
+	_, err := b.bot.Send(msg)
+	var apiErr *tgbotapi.Error
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+		time.Sleep(time.Duration(apiErr.RetryAfter) * time.Second)
+		_, err = b.bot.Send(msg)
+	}
+	return err
+}
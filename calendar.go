@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"html"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TradingCalendar tells when the market of a category trades, by the
+// trading days of session.go.
+type TradingCalendar struct {
+	// Weekends closes the sessions named after Saturday and Sunday
+	Weekends bool
+	// Break is how long before the roll the market closes every day
+	Break time.Duration
+	// Holidays names the trading days the market is closed on
+	Holidays map[string]string
+}
+
+// calendars holds the categories that don't trade around the clock: forex
+// trades from Sunday to Friday 17:00 New York time, the futures of the CME
+// Globex session from Sunday to Friday 16:00 Chicago time with a break of
+// an hour every day. Cryptos never close.
+var calendars = map[string]*TradingCalendar{
+	"forex":   {Weekends: true, Holidays: map[string]string{}},
+	"feature": {Weekends: true, Break: time.Hour, Holidays: map[string]string{}},
+}
+
+// maxClosedDays bounds the search for the last open of a market.
+const maxClosedDays = 14
+
+// closedOn reports whether the market is closed for a whole trading day.
+func (c *TradingCalendar) closedOn(day string) bool {
+	if _, holiday := c.Holidays[day]; holiday {
+		return true
+	}
+	if !c.Weekends {
+		return false
+	}
+	date, err := time.Parse(time.DateOnly, day)
+	return err == nil && (date.Weekday() == time.Saturday || date.Weekday() == time.Sunday)
+}
+
+// marketOpen reports whether the market of a category trades at a time.
+func marketOpen(category string, at time.Time) bool {
+	calendar, exist := calendars[category]
+	if !exist {
+		return true
+	}
+	if calendar.closedOn(tradingDay(category, at)) {
+		return false
+	}
+	end := sessionStart(category, at).AddDate(0, 0, 1).Add(-calendar.Break)
+	return at.Before(end)
+}
+
+// openedAt returns when the market of a category last opened before a time
+// it trades at, or the zero time for markets that never close.
+func openedAt(category string, at time.Time) time.Time {
+	calendar, exist := calendars[category]
+	if !exist {
+		return time.Time{}
+	}
+	start := sessionStart(category, at)
+	// without a break the sessions of consecutive trading days run into
+	// each other
+	for i := 0; i < maxClosedDays && calendar.Break == 0; i++ {
+		prev := sessionStart(category, start.Add(-time.Minute))
+		if calendar.closedOn(tradingDay(category, prev)) {
+			break
+		}
+		start = prev
+	}
+	return start
+}
+
+// reopened reports whether the market of a category closed between two
+// quotes, so the second one opened with a gap.
+func reopened(category string, prev, at time.Time) bool {
+	if !marketOpen(category, at) {
+		return false
+	}
+	return prev.Before(openedAt(category, at))
+}
+
+// closedSymbol returns the first of the symbols whose market is closed, or
+// "" when all of them trade. Synthetic tickers trade while both of their
+// inputs do.
+func closedSymbol(symbols []string, snapshot map[string]*Ticker, now time.Time) string {
+	for _, symbol := range symbols {
+		inputs := []string{symbol}
+		if left, _, right, ok := splitSynthetic(symbol); ok {
+			inputs = []string{left, right}
+		}
+		for _, input := range inputs {
+			if t, exist := snapshot[input]; exist && !marketOpen(t.Category, now) {
+				return symbol
+			}
+		}
+	}
+	return ""
+}
+
+// LoadHolidays reads the holidays of every calendar from <category>.txt in
+// dir: one trading day per line as 2024-12-25, optionally followed by the
+// name of the holiday. Lines starting with # are comments, missing files
+// leave a calendar without holidays.
+func LoadHolidays(dir string) error {
+	for category, calendar := range calendars {
+		file, err := os.Open(filepath.Join(dir, category+".txt"))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		holidays, err := parseHolidays(bufio.NewScanner(file))
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("%s holidays: %w", category, err)
+		}
+		calendar.Holidays = holidays
+		log.Printf("Loaded %d %s holidays", len(holidays), category)
+	}
+	return nil
+}
+
+func parseHolidays(scanner *bufio.Scanner) (map[string]string, error) {
+	holidays := make(map[string]string)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		day, name, _ := strings.Cut(text, " ")
+		if _, err := time.Parse(time.DateOnly, day); err != nil {
+			return nil, fmt.Errorf("line %d: %q is not a date like 2024-12-25", line, day)
+		}
+		holidays[day] = strings.TrimSpace(name)
+	}
+	return holidays, scanner.Err()
+}
+
+// HolidaysDirFromEnv reads HOLIDAYS_DIR, holidays by default.
+func HolidaysDirFromEnv() string {
+	if dir := os.Getenv("HOLIDAYS_DIR"); dir != "" {
+		return dir
+	}
+	return "holidays"
+}
+
+// rearmGap points a price alert or trailing stop the market gapped through
+// at the open back at its target, watched from the opening price, so it
+// only fires once the price trades there. It reports whether the alert was
+// re-armed.
+func (a *Alert) rearmGap(t *Ticker) bool {
+	switch a.Kind {
+	case AlertPrice:
+		a.SetTarget(a.TargetPrice, t.LivePrice)
+	case AlertTrail:
+		a.SetTarget(a.Trail.stop(t.LivePrice), t.LivePrice)
+	default:
+		return false
+	}
+	a.UpdatedAt = time.Now().UTC()
+	return true
+}
+
+// gapText is the notice of an alert re-armed after a gap at the open.
+func gapText(alert *Alert, t *Ticker, prefs *Preferences, lang string) string {
+	return T(lang, "calendar.gap", "number", alert.Number, "symbol", strings.ToUpper(alert.Symbol), "from", prefs.FormatPrice(alert.Symbol, t.PrevPrice), "price", prefs.FormatPrice(alert.Symbol, t.LivePrice), "target", prefs.FormatPrice(alert.Symbol, alert.TargetPrice), "description", html.EscapeString(alert.Description))
+}
+
+// marketCalendar handles /calendar: whether each market trades now and its
+// holidays in the next weeks.
+func (b *TelegramBot) marketCalendar(c *CommandContext) error {
+	const upcomingDays = 30
+	now := time.Now()
+	prefs := b.preferences(c.UserId)
+	categories := []string{"crypto"}
+	for category := range calendars {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+
+	lines := []string{c.T("calendar.title")}
+	for _, category := range categories {
+		key := "calendar.open"
+		if !marketOpen(category, now) {
+			key = "calendar.closed"
+		}
+		lines = append(lines, c.T(key, "category", strings.ToUpper(category)))
+		calendar, exist := calendars[category]
+		if !exist {
+			continue
+		}
+		today := tradingDay(category, now)
+		last := now.AddDate(0, 0, upcomingDays).Format(time.DateOnly)
+		var days []string
+		for day := range calendar.Holidays {
+			if day >= today && day <= last {
+				days = append(days, day)
+			}
+		}
+		sort.Strings(days)
+		for _, day := range days {
+			lines = append(lines, c.T("calendar.holiday", "day", day, "name", calendar.Holidays[day]))
+		}
+	}
+	lines = append(lines, "", c.T("calendar.gaps", "gaps", prefs.GapsString()))
+	return b.sendMessage(c.ChatId, strings.Join(lines, "\n"))
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMarketOpen(t *testing.T) {
+	newYork := mustLoadLocation("America/New_York")
+	chicago := mustLoadLocation("America/Chicago")
+	defer func(holidays map[string]string) { calendars["forex"].Holidays = holidays }(calendars["forex"].Holidays)
+	calendars["forex"].Holidays = map[string]string{"2024-12-25": "Christmas Day"}
+
+	tests := []struct {
+		category string
+		at       time.Time
+		want     bool
+	}{
+		{category: "forex", at: time.Date(2024, 5, 3, 16, 59, 0, 0, newYork), want: true},
+		{category: "forex", at: time.Date(2024, 5, 3, 17, 0, 0, 0, newYork)},
+		{category: "forex", at: time.Date(2024, 5, 5, 16, 59, 0, 0, newYork)},
+		{category: "forex", at: time.Date(2024, 5, 5, 17, 0, 0, 0, newYork), want: true},
+		// the holiday runs from the evening before
+		{category: "forex", at: time.Date(2024, 12, 24, 17, 0, 0, 0, newYork)},
+		{category: "forex", at: time.Date(2024, 12, 25, 17, 0, 0, 0, newYork), want: true},
+		{category: "feature", at: time.Date(2024, 5, 1, 15, 59, 0, 0, chicago), want: true},
+		{category: "feature", at: time.Date(2024, 5, 1, 16, 30, 0, 0, chicago)},
+		{category: "feature", at: time.Date(2024, 5, 1, 17, 0, 0, 0, chicago), want: true},
+		{category: "feature", at: time.Date(2024, 5, 3, 16, 0, 0, 0, chicago)},
+		{category: "crypto", at: time.Date(2024, 5, 4, 12, 0, 0, 0, time.UTC), want: true},
+	}
+	for _, tt := range tests {
+		if got := marketOpen(tt.category, tt.at); got != tt.want {
+			t.Errorf("marketOpen(%s, %s) = %t, want %t", tt.category, tt.at, got, tt.want)
+		}
+	}
+}
+
+func TestReopened(t *testing.T) {
+	newYork := mustLoadLocation("America/New_York")
+	chicago := mustLoadLocation("America/Chicago")
+	tests := []struct {
+		name     string
+		category string
+		prev, at time.Time
+		want     bool
+	}{
+		{name: "weekend", category: "forex", prev: time.Date(2024, 5, 3, 16, 55, 0, 0, newYork), at: time.Date(2024, 5, 5, 17, 2, 0, 0, newYork), want: true},
+		{name: "over the roll", category: "forex", prev: time.Date(2024, 5, 1, 16, 58, 0, 0, newYork), at: time.Date(2024, 5, 1, 17, 3, 0, 0, newYork)},
+		{name: "during the week", category: "forex", prev: time.Date(2024, 5, 2, 10, 0, 0, 0, newYork), at: time.Date(2024, 5, 2, 10, 5, 0, 0, newYork)},
+		{name: "daily break", category: "feature", prev: time.Date(2024, 5, 1, 15, 58, 0, 0, chicago), at: time.Date(2024, 5, 1, 17, 3, 0, 0, chicago), want: true},
+		{name: "cryptos", category: "crypto", prev: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), at: time.Date(2024, 5, 6, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		if got := reopened(tt.category, tt.prev, tt.at); got != tt.want {
+			t.Errorf("%s: reopened = %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseHolidays(t *testing.T) {
+	holidays, err := parseHolidays(bufio.NewScanner(strings.NewReader("# comment\n\n2024-12-25 Christmas Day\n2025-01-01\n")))
+	if err != nil || len(holidays) != 2 || holidays["2024-12-25"] != "Christmas Day" {
+		t.Errorf("parseHolidays = %v, %v", holidays, err)
+	}
+	if _, err := parseHolidays(bufio.NewScanner(strings.NewReader("25.12.2024 Christmas Day\n"))); err == nil {
+		t.Errorf("parseHolidays accepted a date that is not YYYY-MM-DD")
+	}
+}
+
+func TestRearmGap(t *testing.T) {
+	ticker := &Ticker{Symbol: "eurusd", LivePrice: 1.105, PrevPrice: 1.095}
+	alert := NewAlert(1, 1, "eurusd", "", 1.1, 1.095)
+	if !alert.rearmGap(ticker) {
+		t.Fatalf("price alert not re-armed")
+	}
+	// the target below the opening price is watched from above now
+	ticker.RangeHigh, ticker.RangeLow = 1.104, 1.101
+	ticker.PrevUpdatedAt, ticker.UpdatedAt = alert.WatchedSince, alert.WatchedSince.Add(time.Minute)
+	alert.observe(ticker)
+	if alert.triggered(ticker) {
+		t.Errorf("re-armed alert triggered at %g above its target", ticker.LivePrice)
+	}
+	ticker.RangeLow = 1.0995
+	alert.observe(ticker)
+	if !alert.triggered(ticker) {
+		t.Errorf("re-armed alert did not trigger at its target")
+	}
+	if NewCompoundAlert(1, 1, "", Condition{}).rearmGap(ticker) {
+		t.Errorf("compound alert re-armed")
+	}
+}
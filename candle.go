@@ -0,0 +1,135 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// maxCandles is the number of closed candles kept per symbol and timeframe,
+// enough to seed an indicator of the longest period.
+const maxCandles = maxIndicatorPeriod + 50
+
+// timeframes are the candle lengths indicators can be computed on.
+var timeframes = map[string]time.Duration{
+	"15m": 15 * time.Minute,
+	"1h":  time.Hour,
+	"4h":  4 * time.Hour,
+	"1d":  24 * time.Hour,
+}
+
+// Candle aggregates the prices sampled during one period of a timeframe.
+type Candle struct {
+	OpenTime               time.Time
+	Open, High, Low, Close float64
+}
+
+// CandleSeries holds the candles of one symbol on one timeframe and the
+// indicators computed over their closes.
+type CandleSeries struct {
+	timeframe time.Duration
+	// current is the candle still being formed, nil before the first sample
+	current    *Candle
+	closed     []Candle
+	count      int
+	indicators map[IndicatorSpec]Indicator
+}
+
+// add takes in a price sampled at a time, closing the current candle when
+// the sample belongs to a later period.
+func (s *CandleSeries) add(price float64, at time.Time) {
+	openTime := at.UTC().Truncate(s.timeframe)
+	if s.current != nil && !openTime.After(s.current.OpenTime) {
+		s.current.High = max(s.current.High, price)
+		s.current.Low = min(s.current.Low, price)
+		s.current.Close = price
+		return
+	}
+	if s.current != nil {
+		s.close(*s.current)
+	}
+	s.current = &Candle{OpenTime: openTime, Open: price, High: price, Low: price, Close: price}
+}
+
+func (s *CandleSeries) close(candle Candle) {
+	s.closed = append(s.closed, candle)
+	if len(s.closed) > maxCandles {
+		s.closed = s.closed[len(s.closed)-maxCandles:]
+	}
+	s.count++
+	for _, indicator := range s.indicators {
+		indicator.Update(candle.Close)
+	}
+}
+
+// indicator returns the state of an indicator, seeding a new one from the
+// kept candles.
+func (s *CandleSeries) indicator(spec IndicatorSpec) Indicator {
+	indicator, exist := s.indicators[spec]
+	if !exist {
+		indicator = spec.newIndicator()
+		for _, candle := range s.closed {
+			indicator.Update(candle.Close)
+		}
+		s.indicators[spec] = indicator
+	}
+	return indicator
+}
+
+var (
+	// candlesMu guards candles, sampled by the scraper and read by the
+	// alert checker
+	candlesMu sync.Mutex
+	candles   = make(map[string]map[string]*CandleSeries)
+)
+
+// candleSeries returns the series of a symbol on a timeframe, creating it.
+// The caller holds candlesMu.
+func candleSeries(symbol, timeframe string) *CandleSeries {
+	bySymbol, exist := candles[symbol]
+	if !exist {
+		bySymbol = make(map[string]*CandleSeries)
+		candles[symbol] = bySymbol
+	}
+	series, exist := bySymbol[timeframe]
+	if !exist {
+		series = &CandleSeries{timeframe: timeframes[timeframe], indicators: make(map[IndicatorSpec]Indicator)}
+		bySymbol[timeframe] = series
+	}
+	return series
+}
+
+// lastSampled keeps the update time of the last quote sampled per symbol,
+// so quotes that didn't change since are not sampled twice.
+var lastSampled = make(map[string]time.Time)
+
+// sampleCandles adds the latest quote of every ticker in the snapshot to
+// its candles, once per scrape cycle. Synthetic tickers outside the snapshot
+// are sampled once an indicator asked for them.
+func sampleCandles(snapshot map[string]*Ticker) {
+	candlesMu.Lock()
+	defer candlesMu.Unlock()
+
+	for symbol := range candles {
+		lookupTicker(snapshot, symbol)
+	}
+	for symbol, t := range snapshot {
+		if !t.UpdatedAt.After(lastSampled[symbol]) {
+			continue
+		}
+		lastSampled[symbol] = t.UpdatedAt
+		for timeframe := range timeframes {
+			candleSeries(symbol, timeframe).add(t.LivePrice, t.UpdatedAt)
+		}
+	}
+}
+
+// indicatorValues returns the values of an indicator over the closed
+// candles of a symbol, or nil with the number of candles it has and needs
+// while it warms up.
+func indicatorValues(symbol, timeframe string, spec IndicatorSpec) (values []float64, have, need int) {
+	candlesMu.Lock()
+	defer candlesMu.Unlock()
+
+	series := candleSeries(symbol, timeframe)
+	return series.indicator(spec).Values(), series.count, spec.need()
+}
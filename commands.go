@@ -0,0 +1,518 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// CommandContext carries everything a command handler needs to know about
+// the message that invoked it.
+type CommandContext struct {
+	Command   *Command
+	User      *User
+	ChatId    int64
+	ChatType  string
+	UserId    int64
+	Username  string
+	Firstname string
+	Lastname  string
+	// LanguageCode is the language of the Telegram client, Lang the
+	// language replies are written in
+	LanguageCode string
+	Lang         string
+	Message      *tgbotapi.Message
+	Args         []string
+	Flags        map[string]string
+}
+
+// T translates a message into the language of the user.
+func (c *CommandContext) T(key string, vars ...any) string {
+	return T(c.Lang, key, vars...)
+}
+
+// Command describes a bot command; the command table drives dispatch,
+// usage strings, /help and the menu published through setMyCommands.
+type Command struct {
+	Name        string
+	Args        []ArgSpec
+	Flags       []ArgSpec
+	Description string
+	Help        string
+	Permission  Permission
+	Handler     func(b *TelegramBot, c *CommandContext) error
+}
+
+var (
+	// chatFlag lets alert commands target a group or channel from a private chat
+	chatFlag = ArgSpec{Name: "chat", Type: ArgString}
+	// validityFlags limit how long and when an alert is checked
+	validityFlags = []ArgSpec{{Name: "expires", Type: ArgString}, {Name: "window", Type: ArgString}}
+
+	commands      []*Command
+	commandByName = make(map[string]*Command)
+)
+
+func init() {
+	commands = []*Command{
+		{
+			Name:        "start",
+			Args:        []ArgSpec{{Name: "invite_code", Type: ArgString, Optional: true}},
+			Description: "Register with the bot",
+			Handler:     (*TelegramBot).registerUser,
+		},
+		{
+			Name:        "help",
+			Args:        []ArgSpec{{Name: "command", Type: ArgString, Optional: true}},
+			Description: "List commands or show help for one",
+			Handler:     (*TelegramBot).help,
+		},
+		{
+			Name: "createalert",
+			Args: []ArgSpec{
+				{Name: "ticker", Type: ArgSymbol},
+				{Name: "target_price|trail|high|low|reenter|ladder", Type: ArgNumber, Keywords: []string{"trail", BreakoutHigh, BreakoutLow, BreakoutReenter, "ladder"}},
+				{Name: "description", Type: ArgText, Optional: true},
+			},
+			Flags:       append([]ArgSpec{{Name: "note", Type: ArgString}, {Name: "urgent", Type: ArgString}, chatFlag}, validityFlags...),
+			Description: "Create a price alert",
+			Help:        "The alert triggers once the live price of the ticker reaches target_price.\nQuote a description with spaces or pass it as --note=\"...\".\nPass --urgent to deliver the alert during your quiet hours.\nTrailing stops: /createalert <ticker> trail <distance|pct> [long|short] [description] follows the highest price (the lowest for short) and fires when the price turns back by the distance, e.g. /createalert btc trail 3%.\nBreakouts: /createalert <ticker> high|low [days] [description] triggers when the price breaks today's high or low, or the high or low of the last days sessions, e.g. /createalert eurusd high 20; /createalert <ticker> reenter triggers when the price comes back into the range of the previous session after trading outside of it. Forex sessions roll at 17:00 New York time, futures at 17:00 Chicago time and cryptos at midnight UTC.\nLadders: /createalert <ticker> ladder <price> <price>... [description] takes 2 to 10 levels, all above or all below the price and ordered away from it; each level triggers once, in order, and the alert stays active until the last one is hit, e.g. /createalert btc ladder 70000 72000 75000 take profits. Level 2 of alert #12 is #12.2 in /updatealert and /deletealert.\nPass --expires=7d or --expires=2024-12-31 to archive the alert after a while, and --window=london or --window=\"weekdays 08:00-16:00\" to only check it at those times; see /help validity.\nAlerts belong to the chat they are created in; use --chat=@channel to manage the alerts of a channel.",
+			Permission:  PermManageAlerts,
+			Handler:     (*TelegramBot).createAlert,
+		},
+		{
+			Name:        "compoundalert",
+			Args:        []ArgSpec{{Name: "condition", Type: ArgText}},
+			Flags:       append([]ArgSpec{{Name: "note", Type: ArgString}, {Name: "urgent", Type: ArgString}, chatFlag}, validityFlags...),
+			Description: "Create an alert on a combination of prices",
+			Help:        "The alert triggers once the condition holds for the live prices of all its tickers at the same moment.\nCompare tickers with >, >=, < and <=, or give a move in percent from the current price such as -5%, and join them with and, or and parentheses; and binds tighter than or.\nIndicators compare the candles of a timeframe (15m, 1h, 4h or 1d): close, sma(n), rsi(n) and bollinger bands with inside|outside bb(n,width), e.g. eurusd 1h close > sma(50), btc 1h rsi(14) < 30 or btc 1h price outside bb(20,2).\nExamples: /compoundalert xauusd > 2400 and dxy < 104, /compoundalert btc -5% or eth -5% --note=\"crypto dip\"\nThe condition must not hold yet when the alert is created.",
+			Permission:  PermManageAlerts,
+			Handler:     (*TelegramBot).createCompoundAlert,
+		},
+		{
+			Name: "movealert",
+			Args: []ArgSpec{
+				{Name: "ticker|cryptos|feature|forex|synthetic", Type: ArgSymbol},
+				{Name: "percent", Type: ArgString},
+				{Name: "window", Type: ArgString},
+				{Name: "description", Type: ArgText, Optional: true},
+			},
+			Flags:       append([]ArgSpec{{Name: "note", Type: ArgString}, {Name: "urgent", Type: ArgString}, chatFlag}, validityFlags...),
+			Description: "Create an alert on rapid moves",
+			Help:        "The alert triggers whenever the ticker, or any ticker of the category, moves by the percentage within the window, measured from the lowest price of the window for rises and the highest for falls.\nPrefix the percentage with + or - to only watch rises or falls; the window runs from 5m to 24h.\nExamples: /movealert cryptos 8% 30m, /movealert eurusd -0.5% 15m --urgent\nThe alert keeps watching once it triggered; a sustained move is only notified again after it faded to half the percentage.",
+			Permission:  PermManageAlerts,
+			Handler:     (*TelegramBot).createMoveAlert,
+		},
+		{
+			Name:        "viewalerts",
+			Args:        []ArgSpec{{Name: "ticker", Type: ArgSymbol, Optional: true}},
+			Flags:       []ArgSpec{{Name: "archived", Type: ArgString}, chatFlag},
+			Description: "View your alerts",
+			Help:        "Optionally filter the alerts by ticker.\nExpired alerts are archived and only shown with --archived.",
+			Permission:  PermViewAlerts,
+			Handler:     (*TelegramBot).viewAlerts,
+		},
+		{
+			Name:        "updatealert",
+			Args:        []ArgSpec{{Name: "number", Type: ArgAlertRef}, {Name: "target_price", Type: ArgNumber}},
+			Flags:       []ArgSpec{chatFlag},
+			Description: "Change the target price of an alert",
+			Help:        "The start price of the alert is reset to the current live price.\nMove a pending level of a ladder alert with its number, such as /updatealert 12.3 75000.",
+			Permission:  PermManageAlerts,
+			Handler:     (*TelegramBot).updateAlert,
+		},
+		{
+			Name:        "urgent",
+			Args:        []ArgSpec{{Name: "number", Type: ArgInteger}, {Name: "on|off", Type: ArgString, Optional: true}},
+			Flags:       []ArgSpec{chatFlag},
+			Description: "Deliver an alert during quiet hours",
+			Permission:  PermManageAlerts,
+			Handler:     (*TelegramBot).markUrgent,
+		},
+		{
+			Name:        "validity",
+			Args:        []ArgSpec{{Name: "number", Type: ArgInteger}},
+			Flags:       append(validityFlags, chatFlag),
+			Description: "Set when an alert expires or is checked",
+			Help:        "--expires takes a duration such as 12h or 7d, a date such as 2024-12-31, which expires at its end, or a date and time such as 2024-12-31T18:00, in your timezone; expired alerts are archived and you are notified.\n--window takes a market session (sydney, tokyo, london or newyork) or [days] [HH:MM-HH:MM] [timezone], such as weekdays 08:00-16:00, mon,wed,fri or daily 22:00-02:00 Europe/Berlin; outside the window the alert is not checked. Times are in your timezone unless one is given.\nPass off to clear either; a new expiry restores an archived alert.\nExample: /validity 3 --expires=3d --window=\"weekdays 08:00-16:00\"",
+			Permission:  PermManageAlerts,
+			Handler:     (*TelegramBot).setAlertValidity,
+		},
+		{
+			Name:        "deletealert",
+			Args:        []ArgSpec{{Name: "number", Type: ArgAlertRef}},
+			Flags:       []ArgSpec{chatFlag},
+			Description: "Delete an alert",
+			Help:        "Remove a pending level of a ladder alert with its number, such as /deletealert 12.3; the levels after it move up.",
+			Permission:  PermManageAlerts,
+			Handler:     (*TelegramBot).deleteAlert,
+		},
+		{
+			Name: "position",
+			Args: []ArgSpec{
+				{Name: "ticker", Type: ArgSymbol},
+				{Name: "long|short", Type: ArgString, Keywords: []string{"long", "short"}},
+				{Name: "size", Type: ArgNumber},
+				{Name: "entry", Type: ArgNumber},
+			},
+			Flags:       []ArgSpec{{Name: "stop", Type: ArgString}},
+			Description: "Record a position",
+			Help:        "Records the position you hold on the ticker, one per ticker; recording a ticker again replaces its position. The size is in units of the ticker, so P&L is in its quote currency.\nPass --stop=<price> to measure P&L in R, the loss at the stop, and --stop=off to remove it.\nExample: /position btc long 0.5 60000 --stop=58000",
+			Permission:  PermManageAlerts,
+			Handler:     (*TelegramBot).recordPosition,
+		},
+		{
+			Name:        "positions",
+			Description: "View your positions and their P&L",
+			Help:        "Shows the unrealized P&L of every position at the live price, and the total per currency.",
+			Permission:  PermViewAlerts,
+			Handler:     (*TelegramBot).viewPositions,
+		},
+		{
+			Name:        "closeposition",
+			Args:        []ArgSpec{{Name: "ticker", Type: ArgSymbol}},
+			Description: "Close a position",
+			Help:        "Deletes the position and its P&L alerts.",
+			Permission:  PermManageAlerts,
+			Handler:     (*TelegramBot).closePosition,
+		},
+		{
+			Name: "pnlalert",
+			Args: []ArgSpec{
+				{Name: "ticker", Type: ArgSymbol},
+				{Name: "amount|nR", Type: ArgString},
+				{Name: "description", Type: ArgText, Optional: true},
+			},
+			Flags:       append([]ArgSpec{{Name: "note", Type: ArgString}, {Name: "urgent", Type: ArgString}, chatFlag}, validityFlags...),
+			Description: "Create an alert on the P&L of a position",
+			Help:        "The alert triggers once the P&L of your position on the ticker reaches the amount: losses such as -500 at or below it, profits such as +1000 at or above it. Amounts ending in R are multiples of the risk to the stop of the position, such as +2R or -1R.\nExamples: /pnlalert btc -500 --urgent, /pnlalert eurusd +2R take profit\nThe alert follows the position when you record it again, and is deleted with /closeposition.",
+			Permission:  PermManageAlerts,
+			Handler:     (*TelegramBot).createPnLAlert,
+		},
+		{
+			Name:        "viewsymbols",
+			Args:        []ArgSpec{{Name: "cryptos|feature|forex|synthetic|search", Type: ArgSymbol, Optional: true}},
+			Description: "View available symbols",
+			Help:        "Filter by category or by a part of the symbol or name.\nSynthetic tickers are the ratio a/b or the spread a-b of two symbols, such as gc1/si1 or eurusd-gbpusd; they work everywhere a symbol does.",
+			Permission:  PermViewSymbols,
+			Handler:     (*TelegramBot).viewSymbols,
+		},
+		{
+			Name:        "viewuser",
+			Description: "View your account",
+			Permission:  PermManageAccount,
+			Handler:     (*TelegramBot).viewUser,
+		},
+		{
+			Name:        "settings",
+			Args:        []ArgSpec{{Name: "setting", Type: ArgString, Optional: true}, {Name: "value", Type: ArgText, Optional: true}},
+			Description: "View or change your preferences",
+			Help:        "Settings: timezone (e.g. Europe/Berlin), language (auto or a language code), precision (auto or 0-8 decimals), cards (compact or verbose), quiet (22:00-07:00 or off) and gaps (on or off).\nDuring quiet hours alerts in your private chat are held back and delivered when they end, unless marked urgent.\nPrice alerts and trailing stops the market gaps through when it opens are watched again from the opening price instead of triggering; with gaps on you are told when that happens.\nExample: /settings quiet 23:00-07:30",
+			Permission:  PermManageAccount,
+			Handler:     (*TelegramBot).settings,
+		},
+		{
+			Name:        "calendar",
+			Description: "Show which markets are open and upcoming holidays",
+			Help:        "Forex trades from Sunday to Friday 17:00 New York time and futures from Sunday to Friday 16:00 Chicago time, with a break from 16:00 to 17:00 every day; cryptos never close. Closed markets are neither scraped nor checked.",
+			Permission:  PermViewAlerts,
+			Handler:     (*TelegramBot).marketCalendar,
+		},
+		{
+			Name:        "mydata",
+			Description: "Download everything stored about you",
+			Permission:  PermManageAccount,
+			Handler:     (*TelegramBot).myData,
+		},
+		{
+			Name:        "deleteuser",
+			Description: "Delete your account and alerts",
+			Help:        "Asks for a confirmation first. The account can be restored with /start for 7 days, then everything stored about you is deleted.",
+			Permission:  PermManageAccount,
+			Handler:     (*TelegramBot).deleteUser,
+		},
+		{
+			Name:        "viewusers",
+			Description: "View all users",
+			Permission:  PermViewUsers,
+			Handler:     (*TelegramBot).viewUsers,
+		},
+		{
+			Name:        "promote",
+			Args:        []ArgSpec{{Name: "user", Type: ArgString}, {Name: "role", Type: ArgString}},
+			Description: "Change the role of a user",
+			Help:        "Roles: admin, trader, viewer. The user is given by Telegram user id or @username.",
+			Permission:  PermManageRoles,
+			Handler:     (*TelegramBot).promoteUser,
+		},
+		{
+			Name:        "demote",
+			Args:        []ArgSpec{{Name: "user", Type: ArgString}},
+			Description: "Lower the role of a user by one step",
+			Permission:  PermManageRoles,
+			Handler:     (*TelegramBot).demoteUser,
+		},
+		{
+			Name:        "ban",
+			Args:        []ArgSpec{{Name: "user", Type: ArgString}},
+			Description: "Ban a user from the bot",
+			Permission:  PermManageRoles,
+			Handler:     (*TelegramBot).banUser,
+		},
+		{
+			Name:        "unban",
+			Args:        []ArgSpec{{Name: "user", Type: ArgString}},
+			Description: "Lift a ban, the user becomes a viewer",
+			Permission:  PermManageRoles,
+			Handler:     (*TelegramBot).unbanUser,
+		},
+		{
+			Name:        "stats",
+			Description: "Show bot statistics",
+			Permission:  PermViewStats,
+			Handler:     (*TelegramBot).viewStats,
+		},
+		{
+			Name: "broadcast",
+			Args: []ArgSpec{
+				{Name: "all|role:<role>|symbol:<symbol>", Type: ArgString},
+				{Name: "message", Type: ArgText, Optional: true},
+			},
+			Description: "Send an announcement to users",
+			Help:        "Reply to a message to broadcast it instead of typing the text. Shows a preview to confirm first. Users who blocked the bot are marked inactive and skipped afterwards.",
+			Permission:  PermBroadcast,
+			Handler:     (*TelegramBot).broadcast,
+		},
+		{
+			Name:        "quota",
+			Args:        []ArgSpec{{Name: "user", Type: ArgString}, {Name: "limit|reset", Type: ArgString, Optional: true}, {Name: "value|default", Type: ArgString, Optional: true}},
+			Description: "View or override the quotas of a user",
+			Help:        "Limits: max_active_alerts, max_alerts_per_symbol, commands_per_minute. A value of 0 means unlimited, default removes the override.\nExample: /quota @trader max_active_alerts 100",
+			Permission:  PermManageQuotas,
+			Handler:     (*TelegramBot).manageQuota,
+		},
+		{
+			Name:        "invite",
+			Flags:       []ArgSpec{{Name: "uses", Type: ArgInteger}, {Name: "expires", Type: ArgString}, {Name: "role", Type: ArgString}},
+			Description: "Create an invite link",
+			Help:        "Defaults: 1 use, expires in 7d, role trader. Example: /invite --uses=5 --expires=2w --role=viewer",
+			Permission:  PermManageInvites,
+			Handler:     (*TelegramBot).createInvite,
+		},
+		{
+			Name:        "invites",
+			Args:        []ArgSpec{{Name: "all", Type: ArgString, Optional: true}},
+			Description: "List active invites",
+			Help:        "Pass all to include revoked, expired and used up invites.",
+			Permission:  PermManageInvites,
+			Handler:     (*TelegramBot).viewInvites,
+		},
+		{
+			Name:        "revokeinvite",
+			Args:        []ArgSpec{{Name: "code", Type: ArgString}},
+			Description: "Revoke an invite",
+			Permission:  PermManageInvites,
+			Handler:     (*TelegramBot).revokeInvite,
+		},
+		{
+			Name:        "allow",
+			Args:        []ArgSpec{{Name: "user_id", Type: ArgInteger}},
+			Description: "Allow a Telegram user id to register",
+			Permission:  PermManageAllowlist,
+			Handler:     (*TelegramBot).allowUser,
+		},
+		{
+			Name:        "disallow",
+			Args:        []ArgSpec{{Name: "user_id", Type: ArgInteger}},
+			Description: "Remove a Telegram user id from the allowlist",
+			Permission:  PermManageAllowlist,
+			Handler:     (*TelegramBot).disallowUser,
+		},
+		{
+			Name:        "export",
+			Args:        []ArgSpec{{Name: "json|csv", Type: ArgSymbol, Optional: true}},
+			Description: "Export your alerts and settings",
+			Help:        "JSON includes your settings, CSV only the alerts. Both can be imported again with /import.",
+			Permission:  PermViewAlerts,
+			Handler:     (*TelegramBot).exportAlerts,
+		},
+		{
+			Name:        "import",
+			Description: "Import alerts from a JSON or CSV file",
+			Help:        "Send the file with /import as caption, or reply to the file with /import. A preview of the changes is shown to confirm first; unknown symbols, invalid prices and duplicates are skipped.",
+			Permission:  PermManageAlerts,
+			Handler:     (*TelegramBot).importAlerts,
+		},
+		{
+			Name:        "exportall",
+			Description: "Export the whole database as JSON",
+			Permission:  PermExportAll,
+			Handler:     (*TelegramBot).exportDatabase,
+		},
+	}
+	for _, cmd := range commands {
+		commandByName[cmd.Name] = cmd
+	}
+}
+
+func (cmd *Command) usage() string {
+	usage := "/" + cmd.Name
+	for _, arg := range cmd.Args {
+		usage += " " + arg.String()
+	}
+	for _, flag := range cmd.Flags {
+		usage += fmt.Sprintf(" [--%s=...]", flag.Name)
+	}
+	return usage
+}
+
+// description returns the description of the command in a language; the
+// command table holds the English texts, the catalogs the translations.
+func (cmd *Command) description(lang string) string {
+	if msg, exist := catalogs[lang]["cmd."+cmd.Name]; exist {
+		return msg.Other
+	}
+	return cmd.Description
+}
+
+func (cmd *Command) helpText(lang string) string {
+	if msg, exist := catalogs[lang]["cmd."+cmd.Name+".help"]; exist {
+		return msg.Other
+	}
+	return cmd.Help
+}
+
+func (cmd *Command) helpString(lang string) string {
+	help := fmt.Sprintf("%s\n%s", cmd.usage(), cmd.description(lang))
+	if text := cmd.helpText(lang); text != "" {
+		help += "\n\n" + text
+	}
+	return help
+}
+
+// visibleCommands returns the commands a user with the given role is
+// allowed to run.
+func visibleCommands(role Role) []*Command {
+	var visible []*Command
+	for _, cmd := range commands {
+		if !role.Can(cmd.Permission) {
+			continue
+		}
+		visible = append(visible, cmd)
+	}
+	return visible
+}
+
+func botCommands(cmds []*Command, lang string) []tgbotapi.BotCommand {
+	var botCmds []tgbotapi.BotCommand
+	for _, cmd := range cmds {
+		botCmds = append(botCmds, tgbotapi.BotCommand{Command: cmd.Name, Description: cmd.description(lang)})
+	}
+	return botCmds
+}
+
+// publishCommands registers the command menu; the default menu lists the
+// trader commands in every language and admins get a chat scoped menu with
+// their commands.
+func (b *TelegramBot) publishCommands() error {
+	for _, lang := range languages() {
+		config := tgbotapi.NewSetMyCommands(botCommands(visibleCommands(RoleTrader), lang)...)
+		if lang != defaultLanguage {
+			config.LanguageCode = lang
+		}
+		if _, err := b.bot.Request(config); err != nil {
+			return err
+		}
+	}
+	users, err := b.store.GetUsers()
+	if err != nil {
+		return err
+	}
+	for _, u := range users {
+		if !u.Role.IsAdmin() {
+			continue
+		}
+		if err := b.publishUserCommands(&u); err != nil {
+			log.Printf("Error publishing admin commands for %d: %s", u.UserId, err.Error())
+		}
+	}
+	return nil
+}
+
+// publishUserCommands refreshes the chat scoped menu of a user after their
+// role changed.
+func (b *TelegramBot) publishUserCommands(user *User) error {
+	scope := tgbotapi.NewBotCommandScopeChat(user.UserId)
+	if !user.Role.IsAdmin() {
+		_, err := b.bot.Request(tgbotapi.NewDeleteMyCommandsWithScope(scope))
+		return err
+	}
+	lang := b.language(user.UserId, user.LanguageCode)
+	_, err := b.bot.Request(tgbotapi.NewSetMyCommandsWithScope(scope, botCommands(visibleCommands(user.Role), lang)...))
+	return err
+}
+
+func (b *TelegramBot) sendUsage(c *CommandContext) error {
+	return b.sendMessage(c.ChatId, c.T("command.usage", "usage", c.Command.usage()))
+}
+
+// userRole returns the role of a user, or an empty role for users who are
+// not registered.
+func (b *TelegramBot) userRole(userId int64) Role {
+	user, err := b.store.GetUserByUserId(userId)
+	if err != nil {
+		return ""
+	}
+	return user.Role
+}
+
+// authorize is the middleware run before every command handler: it loads the
+// user into the context and checks the role against the command permission.
+// It returns false when the user has been told why the command was refused.
+func (b *TelegramBot) authorize(c *CommandContext) (bool, error) {
+	if c.Command.Permission == PermNone {
+		return true, nil
+	}
+	user, err := b.checkUser(c.UserId, c.ChatId, c.Lang)
+	if user == nil {
+		return false, err
+	}
+	if user.Role == RoleBanned {
+		return false, b.sendMessage(c.ChatId, c.T("user.banned"))
+	}
+	if c.LanguageCode != "" && c.LanguageCode != user.LanguageCode {
+		// notifications use the language of the client the user last used
+		if err := b.store.SetUserLanguageCode(user.UserId, c.LanguageCode); err != nil {
+			log.Printf("Error storing the language of %d: %s", user.UserId, err.Error())
+		}
+		user.LanguageCode = c.LanguageCode
+	}
+	// users can still get their data while the account waits to be deleted
+	if user.DeleteAt != nil && c.Command.Name != "mydata" {
+		return false, b.sendMessage(c.ChatId, c.T("account.scheduled", "date", user.DeleteAt.Format("2006-01-02")))
+	}
+	if !user.Role.Can(c.Command.Permission) {
+		return false, b.sendMessage(c.ChatId, c.T("command.permission_denied"))
+	}
+	c.User = user
+	return true, nil
+}
+
+func (b *TelegramBot) help(c *CommandContext) error {
+	role := b.userRole(c.UserId)
+	if len(c.Args) > 0 {
+		cmd, exist := commandByName[strings.TrimPrefix(c.Args[0], "/")]
+		if !exist || !role.Can(cmd.Permission) {
+			return b.sendMessage(c.ChatId, c.T("help.unknown", "command", c.Args[0]))
+		}
+		return b.sendMessage(c.ChatId, cmd.helpString(c.Lang))
+	}
+
+	var lines []string
+	for _, cmd := range visibleCommands(role) {
+		lines = append(lines, fmt.Sprintf("%s - %s", cmd.usage(), cmd.description(c.Lang)))
+	}
+	return b.sendMessage(c.ChatId, c.T("help.list", "commands", strings.Join(lines, "\n")))
+}
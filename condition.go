@@ -0,0 +1,688 @@
+package main
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"html"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// maxConditions caps the comparisons in one compound alert.
+const maxConditions = 8
+
+// Condition is a node of the expression tree of a compound alert: either a
+// group joining its children with and/or, or a comparison of the live price
+// of a symbol with a price.
+type Condition struct {
+	// Op is "and" or "or" for groups and empty for comparisons
+	Op       string      `json:"op,omitempty"`
+	Children []Condition `json:"children,omitempty"`
+	Symbol   string      `json:"symbol,omitempty"`
+	// Compare is one of >, >=, < and <=
+	Compare string  `json:"compare,omitempty"`
+	Price   float64 `json:"price,omitempty"`
+	// Percent is the move from the price From a comparison was written as,
+	// such as -5 for `btc -5%`
+	Percent float64 `json:"percent,omitempty"`
+	From    float64 `json:"from,omitempty"`
+	// Timeframe is the candle length of the indicators of a comparison
+	Timeframe string `json:"timeframe,omitempty"`
+	// Series is the indicator compared instead of the live price, and
+	// Against the one it is compared with instead of Price; bollinger
+	// bands are compared with inside and outside
+	Series  IndicatorSpec `json:"series,omitempty"`
+	Against IndicatorSpec `json:"against,omitempty"`
+}
+
+// ConditionError reports why a condition can't be parsed. Reason names the
+// message in the catalogs, compound.<reason>.
+type ConditionError struct {
+	Reason string
+	Token  string
+}
+
+func (e *ConditionError) Error() string {
+	return e.Localize(defaultLanguage)
+}
+
+func (e *ConditionError) Localize(lang string) string {
+	return T(lang, "compound."+e.Reason, "token", e.Token, "max", maxConditions, "max_period", maxIndicatorPeriod)
+}
+
+// parseCondition reads a condition such as
+// `xauusd > 2400 and (btc -5% or eth -5% from 3000)`. and binds tighter than
+// or, & and | may be used instead. Percent moves without a from price are
+// relative to the live price when the alert is created, see resolve.
+// Indicators are compared on the candles of a timeframe, as in
+// `eurusd 1h close > sma(50)`, `btc 1h rsi(14) < 30` or
+// `btc 1h price outside bb(20,2)`; the series defaults to the close.
+func parseCondition(text string) (Condition, error) {
+	p := &conditionParser{tokens: lexCondition(strings.ToLower(text))}
+	cond, err := p.parseOr()
+	if err != nil {
+		return Condition{}, err
+	}
+	if token := p.next(); token != "" {
+		return Condition{}, &ConditionError{Reason: "unexpected", Token: token}
+	}
+	return cond, nil
+}
+
+// lexCondition splits a condition into words, parentheses and operators;
+// operators need no spaces around them.
+func lexCondition(text string) []string {
+	var (
+		tokens  []string
+		current strings.Builder
+	)
+	flush := func() {
+		if current.Len() > 0 {
+			tokens = append(tokens, current.String())
+			current.Reset()
+		}
+	}
+	runes := []rune(text)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			flush()
+		case r == '(' || r == ')' || r == ',':
+			flush()
+			tokens = append(tokens, string(r))
+		case r == '&' || r == '|':
+			flush()
+			// && and || read as & and |
+			if i+1 < len(runes) && runes[i+1] == r {
+				i++
+			}
+			tokens = append(tokens, string(r))
+		case r == '<' || r == '>':
+			flush()
+			if i+1 < len(runes) && runes[i+1] == '=' {
+				i++
+				tokens = append(tokens, string(r)+"=")
+			} else {
+				tokens = append(tokens, string(r))
+			}
+		case (r == '+' || r == '-') && i+1 < len(runes) && (unicode.IsDigit(runes[i+1]) || runes[i+1] == '.'):
+			// a sign before a number starts a new word, as in btc-5%, while
+			// eurusd-gbpusd is a spread
+			flush()
+			current.WriteRune(r)
+		default:
+			current.WriteRune(r)
+		}
+	}
+	flush()
+	return tokens
+}
+
+type conditionParser struct {
+	tokens      []string
+	pos         int
+	comparisons int
+}
+
+// next consumes the next token, returning "" at the end.
+func (p *conditionParser) next() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	p.pos++
+	return p.tokens[p.pos-1]
+}
+
+func (p *conditionParser) peek() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *conditionParser) parseOr() (Condition, error) {
+	return p.parseGroup("or", "|", p.parseAnd)
+}
+
+func (p *conditionParser) parseAnd() (Condition, error) {
+	return p.parseGroup("and", "&", p.parseFactor)
+}
+
+// parseGroup reads operands joined by op, flattening nested groups of the
+// same op.
+func (p *conditionParser) parseGroup(op, symbol string, operand func() (Condition, error)) (Condition, error) {
+	group := Condition{Op: op}
+	for {
+		cond, err := operand()
+		if err != nil {
+			return Condition{}, err
+		}
+		if cond.Op == op {
+			group.Children = append(group.Children, cond.Children...)
+		} else {
+			group.Children = append(group.Children, cond)
+		}
+		if token := p.peek(); token != op && token != symbol {
+			break
+		}
+		p.pos++
+	}
+	if len(group.Children) == 1 {
+		return group.Children[0], nil
+	}
+	return group, nil
+}
+
+func (p *conditionParser) parseFactor() (Condition, error) {
+	token := p.next()
+	switch {
+	case token == "":
+		return Condition{}, &ConditionError{Reason: "incomplete"}
+	case token == "(":
+		cond, err := p.parseOr()
+		if err != nil {
+			return Condition{}, err
+		}
+		if token := p.next(); token != ")" {
+			if token == "" {
+				return Condition{}, &ConditionError{Reason: "incomplete"}
+			}
+			return Condition{}, &ConditionError{Reason: "unexpected", Token: token}
+		}
+		return cond, nil
+	case !isSymbolToken(token):
+		return Condition{}, &ConditionError{Reason: "unexpected", Token: token}
+	}
+
+	p.comparisons++
+	if p.comparisons > maxConditions {
+		return Condition{}, &ConditionError{Reason: "too_many"}
+	}
+	cond := Condition{Symbol: token}
+	if _, exist := timeframes[p.peek()]; exist {
+		cond.Timeframe = p.next()
+		switch name := p.peek(); name {
+		case "price":
+			p.pos++
+		case "close", "sma", "rsi":
+			series, err := p.parseIndicator()
+			if err != nil {
+				return Condition{}, err
+			}
+			cond.Series = series
+		default:
+			cond.Series = defaultIndicatorSpecs["close"]
+		}
+	}
+	switch compare := p.next(); compare {
+	case ">", ">=", "<", "<=":
+		cond.Compare = compare
+		if name := p.peek(); name == "close" || name == "sma" || name == "rsi" {
+			if cond.Timeframe == "" {
+				return Condition{}, &ConditionError{Reason: "no_timeframe", Token: name}
+			}
+			against, err := p.parseIndicator()
+			if err != nil {
+				return Condition{}, err
+			}
+			cond.Against = against
+			break
+		}
+		price, err := p.parsePrice()
+		if err != nil {
+			return Condition{}, err
+		}
+		cond.Price = price
+	case "inside", "outside":
+		if p.peek() != "bb" {
+			return Condition{}, &ConditionError{Reason: "unexpected", Token: p.peek()}
+		}
+		if cond.Timeframe == "" {
+			return Condition{}, &ConditionError{Reason: "no_timeframe", Token: "bb"}
+		}
+		against, err := p.parseIndicator()
+		if err != nil {
+			return Condition{}, err
+		}
+		cond.Compare, cond.Against = compare, against
+	case "":
+		return Condition{}, &ConditionError{Reason: "incomplete"}
+	default:
+		// a move in percent such as -5%, optionally from a given price
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(compare, "%"), 64)
+		if err != nil || cond.Timeframe != "" || !strings.HasSuffix(compare, "%") || (compare[0] != '+' && compare[0] != '-') || percent == 0 || percent <= -100 {
+			return Condition{}, &ConditionError{Reason: "unexpected", Token: compare}
+		}
+		cond.Percent = percent
+		if p.peek() == "from" {
+			p.pos++
+			token := p.peek()
+			from, err := p.parsePrice()
+			if err != nil {
+				return Condition{}, err
+			}
+			if from <= 0 {
+				return Condition{}, &ConditionError{Reason: "unexpected", Token: token}
+			}
+			cond.setFrom(from)
+		}
+	}
+	return cond, nil
+}
+
+// parseIndicator reads an indicator such as sma(50) or bb(20,2.5); left out
+// parameters take their defaults.
+func (p *conditionParser) parseIndicator() (IndicatorSpec, error) {
+	spec := defaultIndicatorSpecs[p.next()]
+	if spec.Name == "close" || p.peek() != "(" {
+		return spec, nil
+	}
+	p.pos++
+	token := p.next()
+	period, err := strconv.Atoi(token)
+	if err != nil || period < 2 || period > maxIndicatorPeriod {
+		if token == "" {
+			return spec, &ConditionError{Reason: "incomplete"}
+		}
+		return spec, &ConditionError{Reason: "invalid_period", Token: token}
+	}
+	spec.Period = period
+	if spec.Name == "bb" && p.peek() == "," {
+		p.pos++
+		token := p.next()
+		width, err := strconv.ParseFloat(token, 64)
+		if err != nil || !(width > 0) || width > 10 {
+			return spec, &ConditionError{Reason: "unexpected", Token: token}
+		}
+		spec.Width = width
+	}
+	if token := p.next(); token != ")" {
+		if token == "" {
+			return spec, &ConditionError{Reason: "incomplete"}
+		}
+		return spec, &ConditionError{Reason: "unexpected", Token: token}
+	}
+	return spec, nil
+}
+
+func (p *conditionParser) parsePrice() (float64, error) {
+	token := p.next()
+	if token == "" {
+		return 0, &ConditionError{Reason: "incomplete"}
+	}
+	price, err := strconv.ParseFloat(token, 64)
+	// spreads can be negative
+	if err != nil || math.IsNaN(price) || math.IsInf(price, 0) {
+		return 0, &ConditionError{Reason: "unexpected", Token: token}
+	}
+	return price, nil
+}
+
+// isSymbolToken reports whether a token can be a ticker symbol.
+func isSymbolToken(token string) bool {
+	letter := false
+	for _, r := range token {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune("./-", r) {
+			return false
+		}
+		letter = letter || unicode.IsLetter(r)
+	}
+	if _, exist := defaultIndicatorSpecs[token]; exist {
+		return false
+	}
+	return letter && token != "and" && token != "or" && token != "from" && token != "price"
+}
+
+// setFrom turns a percent move into a comparison with the price it reaches
+// from the given price.
+func (c *Condition) setFrom(from float64) {
+	c.From = from
+	c.Price = from * (1 + c.Percent/100)
+	c.Compare = ">="
+	if c.Percent < 0 {
+		c.Compare = "<="
+	}
+}
+
+// resolve checks that every symbol of the condition is in the snapshot and
+// measures percent moves without a from price from its live price.
+func (c *Condition) resolve(snapshot map[string]*Ticker) error {
+	if c.Op != "" {
+		for i := range c.Children {
+			if err := c.Children[i].resolve(snapshot); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	t, exist := lookupTicker(snapshot, c.Symbol)
+	if !exist {
+		return &ConditionError{Reason: "unknown_symbol", Token: c.Symbol}
+	}
+	if c.Percent != 0 && c.From == 0 {
+		c.setFrom(t.LivePrice)
+	}
+	return nil
+}
+
+// symbols returns the symbols the condition compares, in order of
+// appearance and without duplicates.
+func (c *Condition) symbols() []string {
+	var symbols []string
+	c.walk(func(leaf *Condition) {
+		for _, symbol := range symbols {
+			if symbol == leaf.Symbol {
+				return
+			}
+		}
+		symbols = append(symbols, leaf.Symbol)
+	})
+	return symbols
+}
+
+// walk calls fn with every comparison of the condition.
+func (c *Condition) walk(fn func(*Condition)) {
+	if c.Op == "" {
+		fn(c)
+		return
+	}
+	for i := range c.Children {
+		c.Children[i].walk(fn)
+	}
+}
+
+// holds evaluates the condition against the live prices of one snapshot of
+// the ticker registry. Comparisons on symbols missing from it don't hold.
+func (c *Condition) holds(snapshot map[string]*Ticker) bool {
+	switch c.Op {
+	case "and":
+		for i := range c.Children {
+			if !c.Children[i].holds(snapshot) {
+				return false
+			}
+		}
+		return true
+	case "or":
+		for i := range c.Children {
+			if c.Children[i].holds(snapshot) {
+				return true
+			}
+		}
+		return false
+	}
+	t, exist := lookupTicker(snapshot, c.Symbol)
+	return exist && c.compare(t)
+}
+
+// operands returns the value a comparison compares, the live price of t or
+// an indicator, and the prices it is compared with: Price, the value of an
+// indicator or the middle, lower and upper bollinger band. ok is false while
+// an indicator warms up.
+func (c *Condition) operands(t *Ticker) (value float64, against []float64, ok bool) {
+	value = t.LivePrice
+	if c.Series.Name != "" {
+		values, _, _ := indicatorValues(c.Symbol, c.Timeframe, c.Series)
+		if values == nil {
+			return 0, nil, false
+		}
+		value = values[0]
+	}
+	against = []float64{c.Price}
+	if c.Against.Name != "" {
+		if against, _, _ = indicatorValues(c.Symbol, c.Timeframe, c.Against); against == nil {
+			return 0, nil, false
+		}
+	}
+	return value, against, true
+}
+
+// compare reports whether the comparison holds for the live price of t and
+// the candles of its symbol, prices within half a tick.
+func (c *Condition) compare(t *Ticker) bool {
+	value, against, ok := c.operands(t)
+	if !ok {
+		return false
+	}
+	tolerance := t.Meta.Tolerance()
+	if c.Series.Name == "rsi" {
+		tolerance = 0
+	}
+	switch c.Compare {
+	case "inside":
+		return value >= against[1] && value <= against[2]
+	case "outside":
+		return value < against[1] || value > against[2]
+	case ">":
+		return value > against[0]+tolerance
+	case ">=":
+		return value >= against[0]-tolerance
+	case "<":
+		return value < against[0]-tolerance
+	default:
+		return value <= against[0]+tolerance
+	}
+}
+
+// warmingUp describes the indicators of the condition that don't have
+// enough candles for a value yet.
+func (c *Condition) warmingUp(lang string) []string {
+	var lines []string
+	c.walk(func(leaf *Condition) {
+		for _, spec := range []IndicatorSpec{leaf.Series, leaf.Against} {
+			if spec.Name == "" {
+				continue
+			}
+			if values, have, need := indicatorValues(leaf.Symbol, leaf.Timeframe, spec); values == nil {
+				remaining := time.Duration(need-have) * timeframes[leaf.Timeframe]
+				lines = append(lines, T(lang, "indicator.warming_up", "indicator", spec.Label(), "symbol", strings.ToUpper(leaf.Symbol), "timeframe", leaf.Timeframe, "have", have, "need", need, "time", formatDuration(remaining)))
+			}
+		}
+	})
+	return lines
+}
+
+// String renders the condition in the syntax parseCondition reads.
+func (c Condition) String() string {
+	if c.Op == "" {
+		if c.Symbol == "" {
+			return ""
+		}
+		if c.Percent != 0 && c.From == 0 {
+			return c.Symbol + " " + formatPercent(c.Percent)
+		}
+		if c.Percent != 0 {
+			return c.Symbol + " " + formatPercent(c.Percent) + " from " + strconv.FormatFloat(c.From, 'f', -1, 64)
+		}
+		s := c.Symbol
+		if c.Timeframe != "" {
+			series := c.Series.String()
+			if series == "" {
+				series = "price"
+			}
+			s += " " + c.Timeframe + " " + series
+		}
+		if c.Against.Name != "" {
+			return s + " " + c.Compare + " " + c.Against.String()
+		}
+		return s + " " + c.Compare + " " + strconv.FormatFloat(c.Price, 'f', -1, 64)
+	}
+	parts := make([]string, len(c.Children))
+	for i, child := range c.Children {
+		parts[i] = child.String()
+		if child.Op != "" {
+			parts[i] = "(" + parts[i] + ")"
+		}
+	}
+	return strings.Join(parts, " "+c.Op+" ")
+}
+
+func formatPercent(percent float64) string {
+	s := strconv.FormatFloat(percent, 'f', -1, 64) + "%"
+	if percent > 0 {
+		s = "+" + s
+	}
+	return s
+}
+
+// Value stores the condition in the syntax parseCondition reads.
+func (c Condition) Value() (driver.Value, error) {
+	return c.String(), nil
+}
+
+// Scan reads a condition stored by Value; price alerts store none.
+func (c *Condition) Scan(src any) error {
+	var text string
+	switch v := src.(type) {
+	case string:
+		text = v
+	case []byte:
+		text = string(v)
+	case nil:
+	default:
+		return fmt.Errorf("cannot scan %T into a condition", src)
+	}
+	if text == "" {
+		*c = Condition{}
+		return nil
+	}
+	cond, err := parseCondition(text)
+	if err != nil {
+		return err
+	}
+	*c = cond
+	return nil
+}
+
+// render appends the lines of the condition tree to lines, marking the
+// comparisons that hold in the snapshot.
+func (c *Condition) render(snapshot map[string]*Ticker, prefs *Preferences, lang, indent string, lines []string) []string {
+	if c.Op != "" {
+		lines = append(lines, indent+T(lang, "compound."+c.Op))
+		for i := range c.Children {
+			lines = c.Children[i].render(snapshot, prefs, lang, indent+"    ", lines)
+		}
+		return lines
+	}
+	price := func(p float64) string {
+		return prefs.FormatPrice(c.Symbol, p)
+	}
+	value := price
+	if c.Series.Name == "rsi" {
+		value = func(p float64) string {
+			return strconv.FormatFloat(p, 'f', 1, 64)
+		}
+	}
+	var (
+		against []float64
+		ready   bool
+	)
+	mark, now := "\u2B1C", T(lang, "compound.now", "price", "-")
+	if t, exist := lookupTicker(snapshot, c.Symbol); exist {
+		var current float64
+		if current, against, ready = c.operands(t); ready {
+			now = T(lang, "compound.now", "price", value(current))
+		} else {
+			now = T(lang, "indicator.warming")
+		}
+		if c.compare(t) {
+			mark = "\u2705"
+		}
+	}
+	subject := strings.ToUpper(c.Symbol)
+	if c.Timeframe != "" {
+		series := c.Series.Label()
+		if series == "" {
+			series = T(lang, "indicator.price")
+		}
+		subject += " " + c.Timeframe + " " + series
+	}
+	object := value(c.Price)
+	switch {
+	case c.Against.Name == "":
+	case ready && len(against) == 3:
+		object = c.Against.Label() + " " + price(against[1]) + "\u2013" + price(against[2])
+	case ready:
+		object = c.Against.Label() + " " + value(against[0])
+	default:
+		object = c.Against.Label()
+	}
+	line := fmt.Sprintf("%s%s %s %s %s", indent, mark, subject, c.Compare, object)
+	if c.Percent != 0 {
+		line += " " + T(lang, "compound.percent_from", "percent", formatPercent(c.Percent), "from", prefs.FormatPrice(c.Symbol, c.From))
+	}
+	return append(lines, line+" "+now)
+}
+
+// NewCompoundAlert creates an alert on a condition resolved against the
+// snapshot. Symbol holds the first symbol of the condition.
+func NewCompoundAlert(userId, chatId int64, description string, cond Condition) *Alert {
+	alert := NewAlert(userId, chatId, cond.symbols()[0], description, 0, 0)
+	alert.Kind = AlertCompound
+	alert.Condition = cond
+	return alert
+}
+
+// compoundString renders a compound alert as a card.
+func (a *Alert) compoundString(activeIcon string, prefs *Preferences, lang string) string {
+	if prefs.Cards == CardCompact {
+		return fmt.Sprintf("#%d [%s] %s %s", a.Number, strings.ToUpper(a.Condition.String()), activeIcon, a.Description)
+	}
+	symbols := strings.ToUpper(strings.Join(a.Condition.symbols(), "+"))
+	lines := []string{fmt.Sprintf("#%d [%s] %s %s", a.Number, symbols, activeIcon, a.Description)}
+	lines = a.Condition.render(snapshotTickers(), prefs, lang, "", lines)
+	lines = append(lines, a.Condition.warmingUp(lang)...)
+	lines = append(lines, T(lang, "alert.card_created", "time", prefs.FormatTime(a.CreatedAt)))
+	return strings.Join(lines, "\n")
+}
+
+// compoundTriggeredText is the notification of a compound alert whose
+// condition holds in the snapshot.
+func compoundTriggeredText(alert *Alert, snapshot map[string]*Ticker, prefs *Preferences, lang string) string {
+	var prices []string
+	for _, symbol := range alert.Condition.symbols() {
+		if t, exist := lookupTicker(snapshot, symbol); exist {
+			prices = append(prices, strings.ToUpper(symbol)+" "+prefs.FormatPrice(symbol, t.LivePrice))
+		}
+	}
+	return T(lang, "compound.triggered", "condition", html.EscapeString(strings.ToUpper(alert.Condition.String())), "prices", strings.Join(prices, ", "), "description", html.EscapeString(alert.Description))
+}
+
+// createCompoundAlert handles `/compoundalert <condition>`.
+func (b *TelegramBot) createCompoundAlert(c *CommandContext) error {
+	alertChatId, err := b.alertChat(c, true)
+	if alertChatId == 0 {
+		return err
+	}
+	cond, err := parseCondition(c.Args[0])
+	if err != nil {
+		return b.sendMessage(c.ChatId, err.(*ConditionError).Localize(c.Lang))
+	}
+	// the condition is checked against the prices it will be evaluated on
+	snapshot := snapshotTickers()
+	if err := cond.resolve(snapshot); err != nil {
+		return b.sendMessage(c.ChatId, err.(*ConditionError).Localize(c.Lang))
+	}
+	if cond.holds(snapshot) {
+		return b.sendMessage(c.ChatId, c.T("compound.holds"))
+	}
+	for _, symbol := range cond.symbols() {
+		if ok, err := b.checkAlertQuota(c, symbol); !ok {
+			return err
+		}
+	}
+
+	alert := NewCompoundAlert(c.UserId, alertChatId, c.Flags["note"], cond)
+	alert.Urgent = c.Flags["urgent"] == "true"
+	if ok, err := b.setValidity(c, alert); !ok {
+		return err
+	}
+	if err := b.store.CreateAlert(alert); err != nil {
+		return b.sendMessage(c.ChatId, c.T("alert.store_failed"))
+	}
+	lines := append([]string{c.T("compound.created", "condition", strings.ToUpper(cond.String()))}, cond.warmingUp(c.Lang)...)
+	return b.sendMessage(c.ChatId, strings.Join(lines, "\n"))
+}
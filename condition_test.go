@@ -0,0 +1,106 @@
+package main
+
+import "testing"
+
+func TestParseCondition(t *testing.T) {
+	tests := []struct {
+		text   string
+		want   string
+		reason string
+	}{
+		{text: "XAUUSD > 2400 AND dxy < 104", want: "xauusd > 2400 and dxy < 104"},
+		{text: "xauusd>=2400&&dxy<=104", want: "xauusd >= 2400 and dxy <= 104"},
+		{text: "btc -5% | eth -5% from 3000", want: "btc -5% or eth -5% from 3000"},
+		{text: "a > 1 or b > 2 and c > 3", want: "a > 1 or (b > 2 and c > 3)"},
+		{text: "(a > 1 or b > 2) and c > 3", want: "(a > 1 or b > 2) and c > 3"},
+		{text: "a > 1 and (b > 2 and c > 3)", want: "a > 1 and b > 2 and c > 3"},
+		{text: "btc+10% from 60000", want: "btc +10% from 60000"},
+		{text: "eurusd 1h close > sma(50)", want: "eurusd 1h close > sma(50)"},
+		{text: "eurusd 1h > 1.1", want: "eurusd 1h close > 1.1"},
+		{text: "btc 4h rsi < 30 or btc 1d price outside bb", want: "btc 4h rsi(14) < 30 or btc 1d price outside bb(20,2)"},
+		{text: "btc 15m inside bb(50, 2.5)", want: "btc 15m close inside bb(50,2.5)"},
+		{text: "btc > sma(20)", reason: "no_timeframe"},
+		{text: "btc outside bb", reason: "no_timeframe"},
+		{text: "btc 1h rsi(1) < 30", reason: "invalid_period"},
+		{text: "btc 1h sma(500) > 1", reason: "invalid_period"},
+		{text: "btc 1h close -5%", reason: "unexpected"},
+		{text: "btc 1h outside sma(20)", reason: "unexpected"},
+		{text: "", reason: "incomplete"},
+		{text: "xauusd >", reason: "incomplete"},
+		{text: "(xauusd > 2400", reason: "incomplete"},
+		{text: "xauusd > 2400 dxy < 104", reason: "unexpected"},
+		{text: "xauusd = 2400", reason: "unexpected"},
+		{text: "xauusd > 1e999", reason: "unexpected"},
+		{text: "btc -5% from -1", reason: "unexpected"},
+		{text: "eurusd-gbpusd < -0.1 and gc1/si1 > 90", want: "eurusd-gbpusd < -0.1 and gc1/si1 > 90"},
+		{text: "btc 5%", reason: "unexpected"},
+		{text: "btc -100%", reason: "unexpected"},
+		{text: "and > 1", reason: "unexpected"},
+		{text: "a>1 or b>1 or c>1 or d>1 or e>1 or f>1 or g>1 or h>1 or i>1", reason: "too_many"},
+	}
+	for _, tt := range tests {
+		cond, err := parseCondition(tt.text)
+		if tt.reason != "" {
+			if cerr, ok := err.(*ConditionError); !ok || cerr.Reason != tt.reason {
+				t.Errorf("parseCondition(%q) error = %v, want %s", tt.text, err, tt.reason)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseCondition(%q) error = %v", tt.text, err)
+			continue
+		}
+		if got := cond.String(); got != tt.want {
+			t.Errorf("parseCondition(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+		// the rendering reads back as the same condition
+		again, err := parseCondition(cond.String())
+		if err != nil || again.String() != tt.want {
+			t.Errorf("parseCondition(%q) = %q, %v, want %q", cond.String(), again.String(), err, tt.want)
+		}
+	}
+}
+
+func TestConditionHolds(t *testing.T) {
+	snapshot := map[string]*Ticker{
+		"xauusd": {Symbol: "xauusd", LivePrice: 2401.5, Meta: SymbolMeta{TickSize: 0.1}},
+		"dxy":    {Symbol: "dxy", LivePrice: 103.9, Meta: SymbolMeta{TickSize: 0.001}},
+		"btc":    {Symbol: "btc", LivePrice: 56900, Meta: SymbolMeta{TickSize: 0.01}},
+		"eth":    {Symbol: "eth", LivePrice: 3000, Meta: SymbolMeta{TickSize: 0.01}},
+	}
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{text: "xauusd > 2400 and dxy < 104", want: true},
+		{text: "xauusd > 2400 and dxy < 103.5", want: false},
+		{text: "xauusd >= 2401.5", want: true},
+		{text: "xauusd > 2401.5", want: false},
+		{text: "btc -5% from 60000 or eth -5% from 3200", want: true},
+		{text: "btc -5% from 59000 or eth -5% from 3100", want: false},
+		{text: "btc +5% from 50000 and (eth < 2500 or dxy < 104)", want: true},
+		{text: "xauusd > 2400 or sol > 100", want: true},
+		{text: "xauusd > 2400 and sol > 100", want: false},
+	}
+	for _, tt := range tests {
+		cond, err := parseCondition(tt.text)
+		if err != nil {
+			t.Fatalf("parseCondition(%q) error = %v", tt.text, err)
+		}
+		if got := cond.holds(snapshot); got != tt.want {
+			t.Errorf("%q holds = %t, want %t", tt.text, got, tt.want)
+		}
+	}
+
+	cond, _ := parseCondition("btc -5% or eth -5% from 3200")
+	if err := cond.resolve(snapshot); err != nil {
+		t.Fatalf("resolve() error = %v", err)
+	}
+	if got, want := cond.String(), "btc -5% from 56900 or eth -5% from 3200"; got != want {
+		t.Errorf("resolved condition = %q, want %q", got, want)
+	}
+	cond, _ = parseCondition("btc > 1 and sol > 1")
+	if err, ok := cond.resolve(snapshot).(*ConditionError); !ok || err.Reason != "unknown_symbol" || err.Token != "sol" {
+		t.Errorf("resolve() error = %v, want unknown_symbol sol", err)
+	}
+}
@@ -0,0 +1,816 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	exportVersion        = 1
+	importCallbackPrefix = "import:"
+	// largest file /import downloads
+	maxImportSize = 1 << 20
+	// longest alert description accepted from an import
+	maxImportDescription = 256
+	// how long an import preview can be confirmed
+	importPendingExpiry = 30 * time.Minute
+)
+
+// importError is a problem with an import file, described by a catalog
+// message so it can be shown in the language of the user.
+type importError struct {
+	key  string
+	vars []any
+}
+
+func (e *importError) Error() string {
+	return T(defaultLanguage, e.key, e.vars...)
+}
+
+func (e *importError) Localize(lang string) string {
+	return T(lang, e.key, e.vars...)
+}
+
+var csvHeader = []string{"symbol", "target_price", "description", "active", "created_at", "trail", "condition", "move", "breakout", "expires_at", "window", "ladder", "pnl"}
+
+// ExportSettings holds the account settings included in an export.
+type ExportSettings struct {
+	Role        Role         `json:"role"`
+	Quota       Quota        `json:"quota"`
+	Preferences *Preferences `json:"preferences"`
+}
+
+// ExportAlert is the portable form of an alert, without ids and numbers that
+// only make sense in one database.
+type ExportAlert struct {
+	Symbol      string  `json:"symbol"`
+	TargetPrice float64 `json:"target_price"`
+	Description string  `json:"description"`
+	Active      bool    `json:"active"`
+	Urgent      bool    `json:"urgent,omitempty"`
+	// Trail is set for trailing stops, as in `/createalert <symbol> trail`
+	Trail string `json:"trail,omitempty"`
+	// Condition is set for compound alerts, as in `/compoundalert`
+	Condition string `json:"condition,omitempty"`
+	// Move is set for move alerts, as in `/movealert`; Symbol may name a
+	// category then
+	Move string `json:"move,omitempty"`
+	// Breakout is set for breakout alerts, as in `/createalert <symbol> high 20`
+	Breakout string `json:"breakout,omitempty"`
+	// Ladder is set for ladder alerts, the levels as in `/createalert
+	// <symbol> ladder` with the time each hit one was hit, such as
+	// 1.1@2024-05-01T10:00:00Z 1.2
+	Ladder string `json:"ladder,omitempty"`
+	// PnL is set for P&L alerts, as in `/pnlalert <symbol> -500`; they are
+	// only imported for symbols with a position
+	PnL string `json:"pnl,omitempty"`
+	// ExpiresAt and Window limit how long and when the alert is checked,
+	// Window as in `/validity <number> --window=...`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Window    string     `json:"window,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+type UserExport struct {
+	Version    int            `json:"version"`
+	ExportedAt time.Time      `json:"exported_at"`
+	Settings   ExportSettings `json:"settings"`
+	Alerts     []ExportAlert  `json:"alerts"`
+}
+
+// ExportUser is a user in a database backup, without the password hash.
+type ExportUser struct {
+	User
+	// Password shadows the hash of User and is left empty, so it is omitted
+	Password string `json:"password,omitempty"`
+}
+
+// DatabaseExport is the full database backup admins get with /exportall.
+type DatabaseExport struct {
+	Version        int             `json:"version"`
+	ExportedAt     time.Time       `json:"exported_at"`
+	Users          []ExportUser    `json:"users"`
+	Alerts         []Alert         `json:"alerts"`
+	Invites        []Invite        `json:"invites"`
+	QuotaOverrides []QuotaOverride `json:"quota_overrides"`
+}
+
+func NewExportAlert(alert *Alert) ExportAlert {
+	export := ExportAlert{
+		Symbol:      alert.Symbol,
+		TargetPrice: alert.TargetPrice,
+		Description: alert.Description,
+		Active:      alert.Active,
+		Urgent:      alert.Urgent,
+		ExpiresAt:   alert.ExpiresAt,
+		CreatedAt:   alert.CreatedAt,
+	}
+	if alert.Window != (ActiveWindow{}) {
+		export.Window = alert.Window.String()
+	}
+	switch alert.Kind {
+	case AlertTrail:
+		export.Trail = alert.Trail.String()
+	case AlertCompound:
+		export.Condition = alert.Condition.String()
+	case AlertMove:
+		export.Move = alert.Move.String()
+	case AlertBreakout:
+		export.Breakout = alert.Breakout.String()
+	case AlertLadder:
+		export.Ladder = alert.Ladder.stored()
+	case AlertPnL:
+		export.PnL = alert.PnL.String()
+	}
+	return export
+}
+
+func exportAlertsCSV(alerts []ExportAlert) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write(csvHeader)
+	for _, a := range alerts {
+		var expiresAt string
+		if a.ExpiresAt != nil {
+			expiresAt = a.ExpiresAt.Format(time.RFC3339)
+		}
+		w.Write([]string{a.Symbol, strconv.FormatFloat(a.TargetPrice, 'f', -1, 64), a.Description, strconv.FormatBool(a.Active), a.CreatedAt.Format(time.RFC3339), a.Trail, a.Condition, a.Move, a.Breakout, expiresAt, a.Window, a.Ladder, a.PnL})
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// parseImportFile reads alerts from a JSON export or a CSV file with at
+// least the symbol and target_price columns.
+func parseImportFile(name string, data []byte) ([]ExportAlert, error) {
+	if strings.EqualFold(path.Ext(name), ".csv") {
+		return parseImportCSV(data)
+	}
+	var export UserExport
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, &importError{key: "import.invalid_json"}
+	}
+	return export.Alerts, nil
+}
+
+func parseImportCSV(data []byte) ([]ExportAlert, error) {
+	records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		return nil, &importError{key: "import.invalid_csv"}
+	}
+	if len(records) == 0 {
+		return nil, &importError{key: "import.empty_csv"}
+	}
+	columns := make(map[string]int)
+	for i, name := range records[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"symbol", "target_price"} {
+		if _, ok := columns[required]; !ok {
+			return nil, &importError{key: "import.missing_column", vars: []any{"column", required}}
+		}
+	}
+	get := func(record []string, column string) string {
+		if i, ok := columns[column]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var alerts []ExportAlert
+	for _, record := range records[1:] {
+		alert := ExportAlert{
+			Symbol:      get(record, "symbol"),
+			Description: get(record, "description"),
+			Active:      get(record, "active") != "false",
+			Trail:       get(record, "trail"),
+			Condition:   get(record, "condition"),
+			Move:        get(record, "move"),
+			Breakout:    get(record, "breakout"),
+			Ladder:      get(record, "ladder"),
+			PnL:         get(record, "pnl"),
+			Window:      get(record, "window"),
+		}
+		// invalid prices are reported per row by validateImport
+		alert.TargetPrice, _ = strconv.ParseFloat(get(record, "target_price"), 64)
+		if expiresAt, err := time.Parse(time.RFC3339, get(record, "expires_at")); err == nil {
+			alert.ExpiresAt = &expiresAt
+		}
+		alert.CreatedAt, _ = time.Parse(time.RFC3339, get(record, "created_at"))
+		alerts = append(alerts, alert)
+	}
+	return alerts, nil
+}
+
+// PendingImport is a validated import waiting for the user to confirm it.
+type PendingImport struct {
+	Id        string
+	UserId    int64
+	Alerts    []*Alert
+	CreatedAt time.Time
+}
+
+var (
+	pendingImportsMu sync.Mutex
+	pendingImports   = make(map[string]*PendingImport)
+)
+
+// importContext is what the rows of an import are resolved against: the
+// tickers of one snapshot and the positions and timezone of the user.
+type importContext struct {
+	userId   int64
+	snapshot map[string]*Ticker
+	// position returns the position of the user on a symbol
+	position func(symbol string) (*Position, error)
+	// zone is the timezone of windows that name none
+	zone string
+	lang string
+	now  time.Time
+}
+
+// importKind resolves a row of one kind of alert to the alert it creates
+// and how the preview shows it, or returns an *importError for the row.
+type importKind func(ctx *importContext, row ExportAlert) (*Alert, string, error)
+
+func rowError(key string, vars ...any) error {
+	return &importError{key: key, vars: vars}
+}
+
+// importKindOf returns how a row is resolved, by the one kind column it
+// sets; rows without one are price alerts.
+func importKindOf(row ExportAlert) (importKind, error) {
+	var kinds []importKind
+	for _, k := range []struct {
+		spec string
+		kind importKind
+	}{
+		{row.Trail, importTrail},
+		{row.Condition, importCompound},
+		{row.Move, importMove},
+		{row.Breakout, importBreakout},
+		{row.Ladder, importLadder},
+		{row.PnL, importPnL},
+	} {
+		if k.spec != "" {
+			kinds = append(kinds, k.kind)
+		}
+	}
+	switch len(kinds) {
+	case 0:
+		return importPrice, nil
+	case 1:
+		return kinds[0], nil
+	}
+	return nil, rowError("import.row_several_kinds")
+}
+
+// ticker returns the ticker of the symbol of a row.
+func (ctx *importContext) ticker(row ExportAlert) (*Ticker, error) {
+	t, exist := lookupTicker(ctx.snapshot, strings.ToLower(strings.TrimSpace(row.Symbol)))
+	if !exist {
+		return nil, rowError("import.row_unknown_symbol", "symbol", row.Symbol)
+	}
+	return t, nil
+}
+
+func importPrice(ctx *importContext, row ExportAlert) (*Alert, string, error) {
+	t, err := ctx.ticker(row)
+	if err != nil {
+		return nil, "", err
+	}
+	price := row.TargetPrice
+	if price <= 0 && t.Category != "synthetic" || math.IsInf(price, 0) || math.IsNaN(price) {
+		return nil, "", rowError("import.row_invalid_price")
+	}
+	if !t.Meta.OnTick(price) {
+		return nil, "", rowError("import.row_off_tick", "symbol", strings.ToUpper(t.Symbol), "tick", t.Meta.Format(t.Meta.TickSize))
+	}
+	alert := NewAlert(ctx.userId, ctx.userId, t.Symbol, row.Description, price, t.LivePrice)
+	return alert, strings.ToUpper(t.Symbol) + " " + strconv.FormatFloat(price, 'g', -1, 64), nil
+}
+
+// importTrail imports a trailing stop, whose stop follows the price from
+// now on.
+func importTrail(ctx *importContext, row ExportAlert) (*Alert, string, error) {
+	t, err := ctx.ticker(row)
+	if err != nil {
+		return nil, "", err
+	}
+	fields := strings.Fields(row.Trail)
+	trail, used, err := parseTrail(fields)
+	if err != nil || used < len(fields) {
+		return nil, "", rowError("import.row_invalid_trail")
+	}
+	alert := NewTrailingStop(ctx.userId, ctx.userId, t.Symbol, row.Description, trail, t.LivePrice)
+	if alert.TargetPrice <= 0 && t.Category != "synthetic" {
+		return nil, "", rowError("import.row_invalid_price")
+	}
+	return alert, strings.ToUpper(t.Symbol) + " trail " + trail.String(), nil
+}
+
+func importCompound(ctx *importContext, row ExportAlert) (*Alert, string, error) {
+	cond, err := parseCondition(row.Condition)
+	if err == nil {
+		err = cond.resolve(ctx.snapshot)
+	}
+	if err != nil {
+		return nil, "", rowError("import.row_invalid_condition")
+	}
+	return NewCompoundAlert(ctx.userId, ctx.userId, row.Description, cond), strings.ToUpper(cond.String()), nil
+}
+
+// importMove imports a move alert on a symbol or a whole category.
+func importMove(ctx *importContext, row ExportAlert) (*Alert, string, error) {
+	fields := strings.Fields(row.Move)
+	move, used, err := parseMove(fields)
+	if err != nil || used < len(fields) {
+		return nil, "", rowError("import.row_invalid_move")
+	}
+	scope, isCategory := moveCategories[strings.ToLower(strings.TrimSpace(row.Symbol))]
+	if !isCategory {
+		t, err := ctx.ticker(row)
+		if err != nil {
+			return nil, "", err
+		}
+		scope = t.Symbol
+	}
+	alert := NewMoveAlert(ctx.userId, ctx.userId, scope, row.Description, move)
+	return alert, moveScope(scope, ctx.lang) + " move " + move.String(), nil
+}
+
+func importBreakout(ctx *importContext, row ExportAlert) (*Alert, string, error) {
+	t, err := ctx.ticker(row)
+	if err != nil {
+		return nil, "", err
+	}
+	fields := strings.Fields(row.Breakout)
+	breakout, used, err := parseBreakout(fields)
+	if err != nil || used < len(fields) {
+		return nil, "", rowError("import.row_invalid_breakout")
+	}
+	alert := NewBreakoutAlert(ctx.userId, ctx.userId, t.Symbol, row.Description, breakout, t.LivePrice)
+	return alert, strings.ToUpper(t.Symbol) + " " + breakout.String(), nil
+}
+
+// importLadder imports a ladder alert with the levels it already hit.
+func importLadder(ctx *importContext, row ExportAlert) (*Alert, string, error) {
+	t, err := ctx.ticker(row)
+	if err != nil {
+		return nil, "", err
+	}
+	var ladder Ladder
+	err = ladder.Scan(row.Ladder)
+	if err == nil {
+		err = ladder.validate(t.LivePrice, t.Meta)
+	}
+	if err != nil {
+		return nil, "", rowError("import.row_invalid_ladder")
+	}
+	alert := NewLadderAlert(ctx.userId, ctx.userId, t.Symbol, row.Description, ladder, t.LivePrice)
+	return alert, strings.ToUpper(t.Symbol) + " ladder " + ladder.String(), nil
+}
+
+// importPnL imports a P&L alert on the position of the user; its target
+// must be neither reached nor unreachable, like in /pnlalert. Rows that
+// already triggered are skipped anyway and need no position.
+func importPnL(ctx *importContext, row ExportAlert) (*Alert, string, error) {
+	t, err := ctx.ticker(row)
+	if err != nil {
+		return nil, "", err
+	}
+	pnl, err := parsePnL(row.PnL)
+	alert := &Alert{Symbol: t.Symbol, Kind: AlertPnL, PnL: pnl}
+	if err == nil && row.Active {
+		var position *Position
+		if position, err = ctx.position(t.Symbol); err == nil {
+			alert, err = newPnLAlertAt(ctx.userId, ctx.userId, position, row.Description, pnl, t)
+		}
+	}
+	if err != nil {
+		return nil, "", rowError("import.row_invalid_pnl", "symbol", strings.ToUpper(t.Symbol))
+	}
+	return alert, strings.ToUpper(t.Symbol) + " P&L " + pnl.String(), nil
+}
+
+// resolve returns the alert a row creates with its validity, and how the
+// preview shows it.
+func (ctx *importContext) resolve(row ExportAlert) (*Alert, string, error) {
+	kind, err := importKindOf(row)
+	if err != nil {
+		return nil, "", err
+	}
+	var window ActiveWindow
+	if row.Window != "" {
+		if window, err = parseWindow(row.Window, ctx.zone); err != nil {
+			return nil, "", rowError("import.row_invalid_window")
+		}
+	}
+	alert, spec, err := kind(ctx, row)
+	if err != nil {
+		return nil, "", err
+	}
+	alert.Urgent = row.Urgent
+	alert.ExpiresAt, alert.Window = row.ExpiresAt, window
+	return alert, spec, nil
+}
+
+// importKey identifies an alert for the duplicate check of imports by its
+// symbol and what it watches.
+func importKey(a *Alert) string {
+	symbol := strings.ToLower(a.Symbol)
+	switch a.Kind {
+	case AlertTrail:
+		return symbol + "~" + a.Trail.String()
+	case AlertCompound:
+		return symbol + "~" + a.Condition.String()
+	case AlertMove:
+		return symbol + "~" + a.Move.String()
+	case AlertBreakout:
+		return symbol + "~" + a.Breakout.String()
+	case AlertLadder:
+		return symbol + "~" + a.Ladder.String()
+	case AlertPnL:
+		return symbol + "~pnl " + a.PnL.String()
+	}
+	return fmt.Sprintf("%s@%g", symbol, a.TargetPrice)
+}
+
+// validate checks every row and returns the alerts to create with a dry-run
+// diff: invalid rows, rows that expired or triggered and alerts the user
+// already has, active in existing or earlier in the file, are left out.
+func (ctx *importContext) validate(rows []ExportAlert, existing []Alert) ([]*Alert, []string) {
+	seen := make(map[string]bool)
+	for _, alert := range existing {
+		if alert.Active {
+			seen[importKey(&alert)] = true
+		}
+	}
+	var (
+		alerts                  []*Alert
+		diff                    []string
+		skipped, invalid, added int
+	)
+	for i, row := range rows {
+		if row.ExpiresAt != nil && !row.ExpiresAt.After(ctx.now) {
+			diff = append(diff, T(ctx.lang, "import.row_expired", "row", i+1, "symbol", strings.ToUpper(strings.TrimSpace(row.Symbol))))
+			skipped++
+			continue
+		}
+		alert, spec, err := ctx.resolve(row)
+		switch {
+		case err != nil:
+			rowErr := err.(*importError)
+			diff = append(diff, T(ctx.lang, rowErr.key, append([]any{"row", i + 1}, rowErr.vars...)...))
+			invalid++
+		case len(row.Description) > maxImportDescription:
+			diff = append(diff, T(ctx.lang, "import.row_long_description", "row", i+1, "max", maxImportDescription))
+			invalid++
+		case !row.Active || alert.Kind == AlertCompound && alert.Condition.holds(ctx.snapshot):
+			diff = append(diff, T(ctx.lang, "import.row_triggered", "row", i+1, "alert", spec))
+			skipped++
+		case seen[importKey(alert)]:
+			diff = append(diff, T(ctx.lang, "import.row_exists", "row", i+1, "alert", spec))
+			skipped++
+		default:
+			seen[importKey(alert)] = true
+			alerts = append(alerts, alert)
+			diff = append(diff, fmt.Sprintf("+ %s %s", spec, row.Description))
+			added++
+		}
+	}
+	diff = append(diff, "\n"+T(ctx.lang, "import.totals", "added", added, "skipped", skipped, "invalid", invalid))
+	return alerts, diff
+}
+
+// validateImport checks every row against the known tickers and the alerts
+// the user already has, and returns the alerts to create with a dry-run
+// diff for the user.
+func (b *TelegramBot) validateImport(user *User, rows []ExportAlert, lang string) ([]*Alert, []string, error) {
+	existing, err := b.store.GetAlertsByChatId(user.UserId)
+	if err != nil {
+		return nil, nil, err
+	}
+	ctx := &importContext{
+		userId:   user.UserId,
+		snapshot: snapshotTickers(),
+		position: func(symbol string) (*Position, error) { return b.store.GetPosition(user.UserId, symbol) },
+		zone:     b.preferences(user.UserId).Location().String(),
+		lang:     lang,
+		now:      time.Now(),
+	}
+	alerts, diff := ctx.validate(rows, existing)
+	return alerts, diff, nil
+}
+
+func (b *TelegramBot) exportAlerts(c *CommandContext) error {
+	alerts, err := b.store.GetAlertsByUserId(c.UserId)
+	if err != nil {
+		return err
+	}
+	quota, err := b.userQuota(c.User)
+	if err != nil {
+		return err
+	}
+	export := UserExport{
+		Version:    exportVersion,
+		ExportedAt: time.Now().UTC(),
+		Settings:   ExportSettings{Role: c.User.Role, Quota: quota, Preferences: b.preferences(c.UserId)},
+		Alerts:     []ExportAlert{},
+	}
+	for _, alert := range alerts {
+		export.Alerts = append(export.Alerts, NewExportAlert(&alert))
+	}
+
+	format := "json"
+	if len(c.Args) > 0 {
+		format = strings.ToLower(c.Args[0])
+	}
+	var data []byte
+	switch format {
+	case "json":
+		data, err = json.MarshalIndent(export, "", "  ")
+	case "csv":
+		data, err = exportAlertsCSV(export.Alerts)
+	default:
+		return b.sendUsage(c)
+	}
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("goalertify-alerts-%s.%s", export.ExportedAt.Format("2006-01-02"), format)
+	return b.sendDocument(c.ChatId, name, data, c.T("export.done", "count", len(export.Alerts)))
+}
+
+func (b *TelegramBot) exportDatabase(c *CommandContext) error {
+	export := DatabaseExport{Version: exportVersion, ExportedAt: time.Now().UTC()}
+	users, err := b.store.GetUsers()
+	if err != nil {
+		return err
+	}
+	for _, user := range users {
+		export.Users = append(export.Users, ExportUser{User: user})
+	}
+	if export.Alerts, err = b.store.GetAlerts(); err != nil {
+		return err
+	}
+	if export.Invites, err = b.store.GetInvites(); err != nil {
+		return err
+	}
+	if export.QuotaOverrides, err = b.store.GetQuotaOverrides(); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("goalertify-database-%s.json", export.ExportedAt.Format("2006-01-02"))
+	return b.sendDocument(c.ChatId, name, data, c.T("export.database_done", "users", len(export.Users), "alerts", len(export.Alerts)))
+}
+
+func (b *TelegramBot) sendDocument(chatId int64, name string, data []byte, caption string) error {
+	doc := tgbotapi.NewDocument(chatId, tgbotapi.FileBytes{Name: name, Bytes: data})
+	doc.Caption = caption
+	_, err := b.bot.Send(doc)
+	return err
+}
+
+// importAlerts handles /import sent as the caption of a document or as a
+// reply to one; otherwise it asks the user to reply with the file.
+func (b *TelegramBot) importAlerts(c *CommandContext) error {
+	doc := c.Message.Document
+	if doc == nil && c.Message.ReplyToMessage != nil {
+		doc = c.Message.ReplyToMessage.Document
+	}
+	if doc == nil {
+		msg := tgbotapi.NewMessage(c.ChatId, c.T("import.prompt"))
+		msg.ReplyMarkup = tgbotapi.ForceReply{ForceReply: true, Selective: true}
+		_, err := b.bot.Send(msg)
+		return err
+	}
+	return b.previewImport(c.ChatId, c.User, doc, c.Lang)
+}
+
+// isImportReply reports whether a message is a document sent in reply to
+// the import prompt, in any language.
+func (b *TelegramBot) isImportReply(message *tgbotapi.Message) bool {
+	reply := message.ReplyToMessage
+	if message.Document == nil || reply == nil || reply.From == nil || reply.From.ID != b.bot.Self.ID {
+		return false
+	}
+	for _, lang := range languages() {
+		if reply.Text == T(lang, "import.prompt") {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *TelegramBot) downloadDocument(doc *tgbotapi.Document) ([]byte, error) {
+	if doc.FileSize > maxImportSize {
+		return nil, &importError{key: "import.too_large", vars: []any{"max", formatBytes(maxImportSize)}}
+	}
+	url, err := b.bot.GetFileDirectURL(doc.FileID)
+	if err != nil {
+		return nil, err
+	}
+	res, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", res.Status)
+	}
+	return io.ReadAll(io.LimitReader(res.Body, maxImportSize))
+}
+
+// importOverQuota returns why creating the alerts of an import would exceed
+// the quota of the user, or "" when they fit. Compound alerts count on each
+// of their symbols, as when created.
+func (b *TelegramBot) importOverQuota(user *User, alerts []*Alert, lang string) (string, error) {
+	quota, err := b.userQuota(user)
+	if err != nil {
+		return "", err
+	}
+	if quota.MaxActiveAlerts != Unlimited {
+		count, err := b.store.CountActiveAlertsByUserId(user.UserId)
+		if err != nil {
+			return "", err
+		}
+		if count+len(alerts) > quota.MaxActiveAlerts {
+			return T(lang, "import.over_quota", "max", quota.MaxActiveAlerts), nil
+		}
+	}
+	if quota.MaxAlertsPerSymbol == Unlimited {
+		return "", nil
+	}
+	added := make(map[string]int)
+	for _, alert := range alerts {
+		symbols := []string{alert.Symbol}
+		if alert.Kind == AlertCompound {
+			symbols = alert.Condition.symbols()
+		}
+		for _, symbol := range symbols {
+			added[symbol]++
+		}
+	}
+	symbols := make([]string, 0, len(added))
+	for symbol := range added {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+	for _, symbol := range symbols {
+		count, err := b.store.CountActiveAlertsByUserIdAndSymbol(user.UserId, symbol)
+		if err != nil {
+			return "", err
+		}
+		if count+added[symbol] > quota.MaxAlertsPerSymbol {
+			return T(lang, "import.over_symbol_quota", "max", quota.MaxAlertsPerSymbol, "symbol", symbol), nil
+		}
+	}
+	return "", nil
+}
+
+func (b *TelegramBot) previewImport(chatId int64, user *User, doc *tgbotapi.Document, lang string) error {
+	data, err := b.downloadDocument(doc)
+	if err != nil {
+		if importErr, ok := err.(*importError); ok {
+			return b.sendMessage(chatId, importErr.Localize(lang))
+		}
+		return b.sendMessage(chatId, T(lang, "import.download_failed", "error", err.Error()))
+	}
+	rows, err := parseImportFile(doc.FileName, data)
+	if err != nil {
+		return b.sendMessage(chatId, err.(*importError).Localize(lang))
+	}
+	alerts, diff, err := b.validateImport(user, rows, lang)
+	if err != nil {
+		return err
+	}
+
+	preview := T(lang, "import.preview", "file", doc.FileName, "diff", strings.Join(diff, "\n"))
+	if len(alerts) == 0 {
+		return b.sendMessageInChunks(chatId, preview+"\n"+T(lang, "import.nothing"))
+	}
+	if reason, err := b.importOverQuota(user, alerts, lang); err != nil || reason != "" {
+		if err != nil {
+			return err
+		}
+		return b.sendMessageInChunks(chatId, preview+"\n"+reason)
+	}
+
+	buf := make([]byte, 6)
+	if _, err := rand.Read(buf); err != nil {
+		return err
+	}
+	pending := &PendingImport{Id: hex.EncodeToString(buf), UserId: user.UserId, Alerts: alerts, CreatedAt: time.Now()}
+	pendingImportsMu.Lock()
+	for id, stale := range pendingImports {
+		if time.Since(stale.CreatedAt) > importPendingExpiry {
+			delete(pendingImports, id)
+		}
+	}
+	pendingImports[pending.Id] = pending
+	pendingImportsMu.Unlock()
+
+	// the preview may need several messages, the buttons go on the last one
+	parts := SplitMessage(preview, 4000)
+	for _, part := range parts[:len(parts)-1] {
+		if err := b.sendMessage(chatId, part); err != nil {
+			return err
+		}
+	}
+	msg := tgbotapi.NewMessage(chatId, parts[len(parts)-1])
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(T(lang, "import.button", "count", len(alerts)), importCallbackPrefix+"confirm:"+pending.Id),
+			tgbotapi.NewInlineKeyboardButtonData(T(lang, "button.cancel"), importCallbackPrefix+"cancel:"+pending.Id),
+		),
+	)
+	_, err = b.bot.Send(msg)
+	return err
+}
+
+func (b *TelegramBot) handleImportButton(query *tgbotapi.CallbackQuery) {
+	action, id, _ := strings.Cut(strings.TrimPrefix(query.Data, importCallbackPrefix), ":")
+
+	pendingImportsMu.Lock()
+	pending, exist := pendingImports[id]
+	if exist && time.Since(pending.CreatedAt) > importPendingExpiry {
+		delete(pendingImports, id)
+		exist = false
+	}
+	if exist && pending.UserId == query.From.ID {
+		delete(pendingImports, id)
+	}
+	pendingImportsMu.Unlock()
+
+	lang := b.language(query.From.ID, query.From.LanguageCode)
+	var text string
+	switch {
+	case !exist:
+		text = T(lang, "import.not_pending")
+	case pending.UserId != query.From.ID:
+		b.bot.Send(tgbotapi.NewCallback(query.ID, T(lang, "import.not_owner")))
+		return
+	case action == "confirm":
+		// alerts created since the preview, or another import, count as well
+		user, err := b.store.GetUserByUserId(pending.UserId)
+		var reason string
+		if err == nil {
+			reason, err = b.importOverQuota(user, pending.Alerts, lang)
+		}
+		if err == nil && reason == "" {
+			err = b.store.CreateAlerts(pending.Alerts)
+		}
+		switch {
+		case err != nil:
+			text = T(lang, "import.store_failed")
+		case reason != "":
+			text = reason
+		default:
+			text = T(lang, "import.done", "count", len(pending.Alerts))
+		}
+	default:
+		text = T(lang, "import.cancelled")
+	}
+
+	b.bot.Send(tgbotapi.NewCallback(query.ID, ""))
+	b.bot.Send(tgbotapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID, text))
+}
+
+// importFromReply handles a document sent in reply to the import prompt.
+func (b *TelegramBot) importFromReply(message *tgbotapi.Message) error {
+	if !b.allowCommand(message.Chat.ID, message.From.ID, message.From.LanguageCode) {
+		return nil
+	}
+	// a reply is checked like /import itself, bans and pending deletions too
+	c := &CommandContext{
+		Command:      commandByName["import"],
+		ChatId:       message.Chat.ID,
+		ChatType:     message.Chat.Type,
+		UserId:       message.From.ID,
+		LanguageCode: message.From.LanguageCode,
+		Lang:         b.language(message.From.ID, message.From.LanguageCode),
+		Message:      message,
+	}
+	if ok, err := b.authorize(c); !ok {
+		return err
+	}
+	return b.previewImport(c.ChatId, c.User, message.Document, c.Lang)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"database/sql"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestImportCSVRoundTrip(t *testing.T) {
+	created := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	expires := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	alerts := []ExportAlert{
+		{Symbol: "eurusd", TargetPrice: 1.1, Description: "a note, with a comma", Active: true, CreatedAt: created, ExpiresAt: &expires, Window: "weekdays 08:00-16:00 Europe/Berlin"},
+		{Symbol: "btc", TargetPrice: 57000, Description: `a "quoted" note`, Active: true, CreatedAt: created, Trail: "5%"},
+		{Symbol: "btc", Description: "compound", CreatedAt: created, Condition: "btc > 60000 and eth < 3000"},
+		{Symbol: "crypto", Description: "move", Active: true, CreatedAt: created, Move: "±8% 30m"},
+		{Symbol: "eurusd", TargetPrice: 1.12, Active: true, CreatedAt: created, Breakout: "high 20"},
+		{Symbol: "eurusd", Active: true, CreatedAt: created, Ladder: "1.1@2024-05-01T10:00:00Z 1.2"},
+		{Symbol: "eurusd", TargetPrice: 1.05, Active: true, CreatedAt: created, PnL: "-500"},
+	}
+	data, err := exportAlertsCSV(alerts)
+	if err != nil {
+		t.Fatalf("exportAlertsCSV() error: %v", err)
+	}
+	if header, _, _ := strings.Cut(string(data), "\n"); header != strings.Join(csvHeader, ",") {
+		t.Errorf("exportAlertsCSV() header = %q, want %q", header, strings.Join(csvHeader, ","))
+	}
+	got, err := parseImportCSV(data)
+	if err != nil {
+		t.Fatalf("parseImportCSV() error: %v", err)
+	}
+	if !reflect.DeepEqual(got, alerts) {
+		t.Errorf("parseImportCSV(exportAlertsCSV()) = %+v, want %+v", got, alerts)
+	}
+}
+
+func TestParseImportCSV(t *testing.T) {
+	tests := []struct {
+		data string
+		want []ExportAlert
+		key  string
+	}{
+		// missing columns are empty and rows are active unless they say otherwise
+		{data: "Symbol,Target_Price\neurusd,1.1\n", want: []ExportAlert{{Symbol: "eurusd", TargetPrice: 1.1, Active: true}}},
+		{data: "symbol,target_price,active\nbtc,abc,false\n", want: []ExportAlert{{Symbol: "btc"}}},
+		{data: "symbol\neurusd\n", key: "import.missing_column"},
+		{data: "", key: "import.empty_csv"},
+		{data: "symbol,target_price\n\"eurusd,1.1\n", key: "import.invalid_csv"},
+	}
+	for _, tt := range tests {
+		got, err := parseImportCSV([]byte(tt.data))
+		if tt.key != "" {
+			if e, ok := err.(*importError); !ok || e.key != tt.key {
+				t.Errorf("parseImportCSV(%q) error = %v, want %s", tt.data, err, tt.key)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseImportCSV(%q) = %+v, %v, want %+v", tt.data, got, err, tt.want)
+		}
+	}
+}
+
+func TestValidateImport(t *testing.T) {
+	now := time.Date(2024, 5, 6, 12, 0, 0, 0, time.UTC)
+	past, future := now.Add(-time.Hour), now.Add(time.Hour)
+	ctx := &importContext{
+		userId: 1,
+		snapshot: map[string]*Ticker{
+			"eurusd": NewTicker("eurusd", "EUR/USD", "forex", 1.08, 1.09, 1.07),
+			"btc":    NewTicker("btc", "Bitcoin", "crypto", 60000, 61000, 59000),
+		},
+		position: func(symbol string) (*Position, error) { return nil, sql.ErrNoRows },
+		zone:     "Europe/Berlin",
+		lang:     "en",
+		now:      now,
+	}
+	existing := []Alert{*NewAlert(1, 1, "eurusd", "", 1.1, 1.08)}
+	tests := []struct {
+		name  string
+		row   ExportAlert
+		added bool
+		key   string
+		vars  []any
+	}{
+		{name: "price", row: ExportAlert{Symbol: "EURUSD", TargetPrice: 1.09, Active: true}, added: true},
+		{name: "same price", row: ExportAlert{Symbol: "eurusd", TargetPrice: 1.09, Active: true}, key: "import.row_exists", vars: []any{"alert", "EURUSD 1.09"}},
+		{name: "existing price", row: ExportAlert{Symbol: "eurusd", TargetPrice: 1.1, Active: true}, key: "import.row_exists", vars: []any{"alert", "EURUSD 1.1"}},
+		{name: "expired", row: ExportAlert{Symbol: "eurusd", TargetPrice: 1.07, Active: true, ExpiresAt: &past}, key: "import.row_expired", vars: []any{"symbol", "EURUSD"}},
+		{name: "not expired", row: ExportAlert{Symbol: "eurusd", TargetPrice: 1.07, Active: true, ExpiresAt: &future}, added: true},
+		{name: "triggered", row: ExportAlert{Symbol: "eurusd", TargetPrice: 1.06, Active: false}, key: "import.row_triggered", vars: []any{"alert", "EURUSD 1.06"}},
+		{name: "several kinds", row: ExportAlert{Symbol: "btc", Active: true, Trail: "5%", Breakout: "high 20"}, key: "import.row_several_kinds"},
+		{name: "trail", row: ExportAlert{Symbol: "btc", Active: true, Trail: "5%"}, added: true},
+		{name: "unknown symbol", row: ExportAlert{Symbol: "xyz", TargetPrice: 1, Active: true}, key: "import.row_unknown_symbol", vars: []any{"symbol", "xyz"}},
+		{name: "off tick", row: ExportAlert{Symbol: "eurusd", TargetPrice: 1.000001, Active: true}, key: "import.row_off_tick", vars: []any{"symbol", "EURUSD", "tick", "0.00001"}},
+		{name: "invalid window", row: ExportAlert{Symbol: "eurusd", TargetPrice: 1.05, Active: true, Window: "someday"}, key: "import.row_invalid_window"},
+		{name: "no position", row: ExportAlert{Symbol: "eurusd", Active: true, PnL: "-500"}, key: "import.row_invalid_pnl", vars: []any{"symbol", "EURUSD"}},
+	}
+	rows := make([]ExportAlert, len(tests))
+	for i, tt := range tests {
+		rows[i] = tt.row
+	}
+	alerts, diff := ctx.validate(rows, existing)
+
+	var added int
+	for i, tt := range tests {
+		if tt.added {
+			added++
+			if !strings.HasPrefix(diff[i], "+ ") {
+				t.Errorf("%s: diff = %q, want it added", tt.name, diff[i])
+			}
+			continue
+		}
+		if want := T("en", tt.key, append([]any{"row", i + 1}, tt.vars...)...); diff[i] != want {
+			t.Errorf("%s: diff = %q, want %q", tt.name, diff[i], want)
+		}
+	}
+	if len(alerts) != added {
+		t.Errorf("validate() created %d alerts, want %d", len(alerts), added)
+	}
+	// the window of a row without a zone is read in the zone of the user
+	window, _ := parseWindow("weekdays 08:00-16:00", "UTC")
+	alert, _, err := ctx.resolve(ExportAlert{Symbol: "eurusd", TargetPrice: 1.05, Active: true, Window: "weekdays 08:00-16:00"})
+	if err != nil || alert.Window.Zone != "Europe/Berlin" || alert.Window.Days != window.Days {
+		t.Errorf("resolve() window = %+v, %v, want it in Europe/Berlin", alert.Window, err)
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+//go:embed locales/*.json
+var localeFiles embed.FS
+
+// defaultLanguage is used when the language of a user has no catalog, and
+// for messages missing from the catalog of their language.
+const defaultLanguage = "en"
+
+// Message is one catalog entry. A plain JSON string sets Other; messages
+// that depend on a count are objects with the plural forms of the language.
+type Message struct {
+	Zero  string `json:"zero"`
+	One   string `json:"one"`
+	Other string `json:"other"`
+}
+
+func (m *Message) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		m.Other = text
+		return nil
+	}
+	type plural Message
+	return json.Unmarshal(data, (*plural)(m))
+}
+
+var catalogs = loadCatalogs()
+
+// loadCatalogs reads the embedded locales/<language>.json files; they ship
+// with the binary, so a broken catalog is a programming error.
+func loadCatalogs() map[string]map[string]Message {
+	entries, err := localeFiles.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+	loaded := make(map[string]map[string]Message)
+	for _, entry := range entries {
+		data, err := localeFiles.ReadFile("locales/" + entry.Name())
+		if err != nil {
+			panic(err)
+		}
+		var catalog map[string]Message
+		if err := json.Unmarshal(data, &catalog); err != nil {
+			panic(fmt.Sprintf("locales/%s: %s", entry.Name(), err))
+		}
+		loaded[strings.TrimSuffix(entry.Name(), path.Ext(entry.Name()))] = catalog
+	}
+	return loaded
+}
+
+// languages returns the languages with a catalog, sorted.
+func languages() []string {
+	var langs []string
+	for lang := range catalogs {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+// matchLanguage maps a Telegram language_code such as "de-AT" to a language
+// with a catalog, or returns the default language.
+func matchLanguage(code string) string {
+	lang, _, _ := strings.Cut(strings.ToLower(code), "-")
+	if _, exist := catalogs[lang]; exist {
+		return lang
+	}
+	return defaultLanguage
+}
+
+// pluralForm follows the CLDR cardinal rules for integers: Farsi uses "one"
+// for 0 and 1, English and German only for 1.
+func pluralForm(lang string, n int) string {
+	switch lang {
+	case "fa":
+		if n == 0 || n == 1 {
+			return "one"
+		}
+	default:
+		if n == 1 {
+			return "one"
+		}
+	}
+	return "other"
+}
+
+func (m Message) form(lang string, count int, counted bool) string {
+	if !counted {
+		return m.Other
+	}
+	if count == 0 && m.Zero != "" {
+		return m.Zero
+	}
+	if pluralForm(lang, count) == "one" && m.One != "" {
+		return m.One
+	}
+	return m.Other
+}
+
+// lookup returns the message for a key in the catalog of a language, falling
+// back to the default language.
+func lookup(lang, key string) (Message, bool) {
+	if msg, exist := catalogs[lang][key]; exist {
+		return msg, true
+	}
+	msg, exist := catalogs[defaultLanguage][key]
+	return msg, exist
+}
+
+// T translates a message. Variables are passed as name, value pairs and fill
+// {name} placeholders; a "count" variable selects the plural form.
+//
+//	T("de", "alerts.imported", "count", 3)
+func T(lang, key string, vars ...any) string {
+	msg, exist := lookup(lang, key)
+	if !exist {
+		return key
+	}
+	count, counted := 0, false
+	replacements := make([]string, 0, len(vars))
+	for i := 0; i+1 < len(vars); i += 2 {
+		name := fmt.Sprint(vars[i])
+		if name == "count" {
+			if n, ok := vars[i+1].(int); ok {
+				count, counted = n, true
+			}
+		}
+		replacements = append(replacements, "{"+name+"}", fmt.Sprint(vars[i+1]))
+	}
+	return strings.NewReplacer(replacements...).Replace(msg.form(lang, count, counted))
+}
+
+// language picks the language of a user: the saved preference, else the
+// language of their Telegram client.
+func (b *TelegramBot) language(userId int64, languageCode string) string {
+	if prefs := b.preferences(userId); prefs.Language != "" {
+		return matchLanguage(prefs.Language)
+	}
+	return matchLanguage(languageCode)
+}
+
+// userLanguage is language for messages not sent in reply to the user, using
+// the language code saved with the account.
+func (b *TelegramBot) userLanguage(userId int64) string {
+	var languageCode string
+	if user, err := b.store.GetUserByUserId(userId); err == nil {
+		languageCode = user.LanguageCode
+	}
+	return b.language(userId, languageCode)
+}
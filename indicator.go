@@ -0,0 +1,203 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// maxIndicatorPeriod is the longest period an indicator may use.
+const maxIndicatorPeriod = 200
+
+// IndicatorSpec names an indicator over the candle closes of a timeframe,
+// such as sma(50). The zero spec stands for the live price.
+type IndicatorSpec struct {
+	// Name is close, sma, rsi or bb
+	Name   string  `json:"name,omitempty"`
+	Period int     `json:"period,omitempty"`
+	Width  float64 `json:"width,omitempty"`
+}
+
+// defaultIndicatorSpecs holds the parameters used when a condition leaves
+// them out.
+var defaultIndicatorSpecs = map[string]IndicatorSpec{
+	"close": {Name: "close"},
+	"sma":   {Name: "sma", Period: 20},
+	"rsi":   {Name: "rsi", Period: 14},
+	"bb":    {Name: "bb", Period: 20, Width: 2},
+}
+
+// String renders the spec in the syntax conditions are written in.
+func (s IndicatorSpec) String() string {
+	switch s.Name {
+	case "", "close":
+		return s.Name
+	case "bb":
+		return "bb(" + strconv.Itoa(s.Period) + "," + strconv.FormatFloat(s.Width, 'f', -1, 64) + ")"
+	}
+	return s.Name + "(" + strconv.Itoa(s.Period) + ")"
+}
+
+// Label is the spec as shown on alert cards.
+func (s IndicatorSpec) Label() string {
+	return strings.ToUpper(s.String())
+}
+
+// need is the number of closed candles the indicator needs for a value.
+func (s IndicatorSpec) need() int {
+	switch s.Name {
+	case "sma", "bb":
+		return s.Period
+	case "rsi":
+		// RSI averages the changes between closes
+		return s.Period + 1
+	}
+	return 1
+}
+
+// newIndicator creates the incremental state of the indicator.
+func (s IndicatorSpec) newIndicator() Indicator {
+	switch s.Name {
+	case "sma":
+		return &SMA{window: newWindow(s.Period)}
+	case "rsi":
+		return &RSI{period: s.Period}
+	case "bb":
+		return &Bollinger{window: newWindow(s.Period), width: s.Width}
+	}
+	return &Close{}
+}
+
+// Indicator is computed incrementally from candle closes.
+type Indicator interface {
+	// Update takes in the close of the next candle
+	Update(close float64)
+	// Values returns the current values, or nil while warming up
+	Values() []float64
+}
+
+// Close is the close of the last candle.
+type Close struct {
+	close float64
+	ready bool
+}
+
+func (c *Close) Update(close float64) {
+	c.close, c.ready = close, true
+}
+
+func (c *Close) Values() []float64 {
+	if !c.ready {
+		return nil
+	}
+	return []float64{c.close}
+}
+
+// window keeps the last closes with their running sums.
+type window struct {
+	closes       []float64
+	next         int
+	full         bool
+	sum, sumSqrs float64
+}
+
+func newWindow(period int) window {
+	return window{closes: make([]float64, period)}
+}
+
+func (w *window) add(close float64) {
+	if w.full {
+		old := w.closes[w.next]
+		w.sum -= old
+		w.sumSqrs -= old * old
+	}
+	w.closes[w.next] = close
+	w.sum += close
+	w.sumSqrs += close * close
+	w.next = (w.next + 1) % len(w.closes)
+	w.full = w.full || w.next == 0
+}
+
+func (w *window) mean() float64 {
+	return w.sum / float64(len(w.closes))
+}
+
+// SMA is the simple moving average of the last Period closes.
+type SMA struct {
+	window window
+}
+
+func (s *SMA) Update(close float64) {
+	s.window.add(close)
+}
+
+func (s *SMA) Values() []float64 {
+	if !s.window.full {
+		return nil
+	}
+	return []float64{s.window.mean()}
+}
+
+// RSI is the relative strength index with Wilder's smoothing: the average
+// gain and loss start as the mean of the first period changes and then move
+// by 1/period of every further change.
+type RSI struct {
+	period           int
+	prev             float64
+	count            int
+	avgGain, avgLoss float64
+	sumGain, sumLoss float64
+}
+
+func (r *RSI) Update(close float64) {
+	r.count++
+	if r.count == 1 {
+		r.prev = close
+		return
+	}
+	gain, loss := max(close-r.prev, 0), max(r.prev-close, 0)
+	r.prev = close
+	n := float64(r.period)
+	switch changes := r.count - 1; {
+	case changes < r.period:
+		r.sumGain += gain
+		r.sumLoss += loss
+	case changes == r.period:
+		r.avgGain = (r.sumGain + gain) / n
+		r.avgLoss = (r.sumLoss + loss) / n
+	default:
+		r.avgGain = (r.avgGain*(n-1) + gain) / n
+		r.avgLoss = (r.avgLoss*(n-1) + loss) / n
+	}
+}
+
+func (r *RSI) Values() []float64 {
+	if r.count <= r.period {
+		return nil
+	}
+	if r.avgLoss == 0 {
+		return []float64{100}
+	}
+	return []float64{100 - 100/(1+r.avgGain/r.avgLoss)}
+}
+
+// Bollinger bands lie width standard deviations around the simple moving
+// average; Values returns the middle, lower and upper band.
+type Bollinger struct {
+	window window
+	width  float64
+}
+
+func (b *Bollinger) Update(close float64) {
+	b.window.add(close)
+}
+
+func (b *Bollinger) Values() []float64 {
+	if !b.window.full {
+		return nil
+	}
+	mean := b.window.mean()
+	variance := max(b.window.sumSqrs/float64(len(b.window.closes))-mean*mean, 0)
+	deviation := b.width * math.Sqrt(variance)
+	return []float64{mean, mean - deviation, mean + deviation}
+}
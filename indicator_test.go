@@ -0,0 +1,67 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestIndicators(t *testing.T) {
+	tests := []struct {
+		name   string
+		spec   IndicatorSpec
+		closes []float64
+		want   []float64
+	}{
+		{name: "close", spec: IndicatorSpec{Name: "close"}, closes: []float64{1, 2}, want: []float64{2}},
+		{name: "sma warming up", spec: IndicatorSpec{Name: "sma", Period: 3}, closes: []float64{1, 2}},
+		{name: "sma of the last closes", spec: IndicatorSpec{Name: "sma", Period: 3}, closes: []float64{1, 2, 3, 4}, want: []float64{3}},
+		{name: "rsi warming up", spec: IndicatorSpec{Name: "rsi", Period: 2}, closes: []float64{1, 2}},
+		{name: "rsi seeded", spec: IndicatorSpec{Name: "rsi", Period: 2}, closes: []float64{1, 2, 1.5}, want: []float64{100 - 100/(1+2.0)}},
+		{name: "rsi smoothed", spec: IndicatorSpec{Name: "rsi", Period: 2}, closes: []float64{1, 2, 1.5, 2.5}, want: []float64{100 - 100/(1+6.0)}},
+		{name: "rsi without losses", spec: IndicatorSpec{Name: "rsi", Period: 2}, closes: []float64{1, 2, 3}, want: []float64{100}},
+		{name: "bollinger bands", spec: IndicatorSpec{Name: "bb", Period: 3, Width: 2}, closes: []float64{9, 2, 4, 6}, want: []float64{4, 4 - 2*math.Sqrt(8.0/3), 4 + 2*math.Sqrt(8.0/3)}},
+	}
+	for _, tt := range tests {
+		indicator := tt.spec.newIndicator()
+		for _, close := range tt.closes {
+			indicator.Update(close)
+		}
+		got := indicator.Values()
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: values %v, want %v", tt.name, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if math.Abs(got[i]-tt.want[i]) > 1e-9 {
+				t.Errorf("%s: values %v, want %v", tt.name, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestCandleSeries(t *testing.T) {
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	series := &CandleSeries{timeframe: 15 * time.Minute, indicators: make(map[IndicatorSpec]Indicator)}
+	for i, price := range []float64{1.1, 1.3, 1.0, 1.2, 1.4} {
+		series.add(price, start.Add(time.Duration(i)*5*time.Minute))
+	}
+	want := Candle{OpenTime: start, Open: 1.1, High: 1.3, Low: 1.0, Close: 1.0}
+	if len(series.closed) != 1 || series.closed[0] != want {
+		t.Fatalf("closed candles %+v, want [%+v]", series.closed, want)
+	}
+	if series.current.Open != 1.2 || series.current.Close != 1.4 || series.current.High != 1.4 {
+		t.Errorf("current candle %+v, want open 1.2 and close 1.4", *series.current)
+	}
+
+	// a new indicator is seeded from the kept candles and follows new ones
+	sma := series.indicator(IndicatorSpec{Name: "sma", Period: 2})
+	if sma.Values() != nil {
+		t.Errorf("sma(2) of one candle = %v, want warming up", sma.Values())
+	}
+	series.add(1.5, start.Add(30*time.Minute))
+	if got := sma.Values(); len(got) != 1 || math.Abs(got[0]-1.2) > 1e-9 {
+		t.Errorf("sma(2) = %v, want [1.2]", got)
+	}
+}
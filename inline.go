@@ -0,0 +1,123 @@
+package main
+
+import (
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	// Telegram accepts at most 50 results per answer
+	inlinePageSize = 50
+	// how long Telegram and our own cache may keep an answer
+	inlineCacheTime = 30 * time.Second
+	// /start payload of the register button shown to unregistered users
+	inlineStartParameter = "inline"
+)
+
+type inlineCacheEntry struct {
+	tickers   []Ticker
+	expiresAt time.Time
+}
+
+// inlineCache keeps the sorted matches of recent queries so paging through
+// the results of one query is served from a consistent list.
+type inlineCache struct {
+	mu      sync.Mutex
+	entries map[string]inlineCacheEntry
+}
+
+var inlineResults = &inlineCache{entries: make(map[string]inlineCacheEntry)}
+
+func (c *inlineCache) get(query string) []Ticker {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for key, entry := range c.entries {
+		if now.After(entry.expiresAt) {
+			delete(c.entries, key)
+		}
+	}
+	if entry, ok := c.entries[query]; ok {
+		return entry.tickers
+	}
+
+	matches := matchTickers(query)
+	c.entries[query] = inlineCacheEntry{tickers: matches, expiresAt: now.Add(inlineCacheTime)}
+	return matches
+}
+
+// matchTickers returns copies of the tickers matching the query, symbols
+// starting with the query first, then alphabetically.
+func matchTickers(query string) []Ticker {
+	var matches []Ticker
+	for _, ticker := range snapshotTickers() {
+		if query == "" || strings.Contains(ticker.Symbol, query) || strings.Contains(ticker.Name, query) {
+			matches = append(matches, *ticker)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		pi := strings.HasPrefix(matches[i].Symbol, query)
+		pj := strings.HasPrefix(matches[j].Symbol, query)
+		if pi != pj {
+			return pi
+		}
+		return matches[i].Symbol < matches[j].Symbol
+	})
+	return matches
+}
+
+func (b *TelegramBot) handleInlineQuery(query *tgbotapi.InlineQuery) {
+	inlineConf := tgbotapi.InlineConfig{
+		InlineQueryID: query.ID,
+		CacheTime:     int(inlineCacheTime.Seconds()),
+		Results:       []interface{}{},
+	}
+
+	user, err := b.store.GetUserByUserId(query.From.ID)
+	if user == nil || !user.Role.Can(PermViewSymbols) {
+		if err != nil {
+			log.Printf("Error checking inline user %d: %s", query.From.ID, err.Error())
+		}
+		inlineConf.IsPersonal = true
+		inlineConf.SwitchPMText = T(matchLanguage(query.From.LanguageCode), "inline.register")
+		inlineConf.SwitchPMParameter = inlineStartParameter
+		if _, err := b.bot.Request(inlineConf); err != nil {
+			log.Printf("Error answering inline query: %s", err.Error())
+		}
+		return
+	}
+
+	// the quote cards are in the language of the user
+	inlineConf.IsPersonal = true
+	lang := b.language(query.From.ID, query.From.LanguageCode)
+
+	matches := inlineResults.get(strings.ToLower(strings.TrimSpace(query.Query)))
+
+	offset, err := strconv.Atoi(query.Offset)
+	if err != nil || offset < 0 || offset > len(matches) {
+		offset = 0
+	}
+	end := offset + inlinePageSize
+	if end < len(matches) {
+		inlineConf.NextOffset = strconv.Itoa(end)
+	} else {
+		end = len(matches)
+	}
+
+	for _, ticker := range matches[offset:end] {
+		article := tgbotapi.NewInlineQueryResultArticleHTML(ticker.Symbol, ticker.toTelegramString(lang), ticker.toQuoteString(lang))
+		article.Description = ticker.Name
+		inlineConf.Results = append(inlineConf.Results, article)
+	}
+
+	if _, err := b.bot.Request(inlineConf); err != nil {
+		log.Printf("Error answering inline query: %s", err.Error())
+	}
+}
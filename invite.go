@@ -0,0 +1,150 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInviteInvalid = errors.New("invite is invalid, expired, revoked or used up")
+
+const (
+	defaultInviteUses   = 1
+	defaultInviteExpiry = 7 * 24 * time.Hour
+)
+
+type Invite struct {
+	Code      string    `json:"code"`
+	CreatedBy int64     `json:"created_by"`
+	Role      Role      `json:"role"`
+	MaxUses   int       `json:"max_uses"`
+	Uses      int       `json:"uses"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Revoked   bool      `json:"revoked"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func GetCreateInvitesTable() string {
+	return `CREATE TABLE IF NOT EXISTS invites (
+		code TEXT PRIMARY KEY,
+		created_by INTEGER NOT NULL,
+		role TEXT NOT NULL,
+		max_uses INTEGER NOT NULL,
+		uses INTEGER NOT NULL DEFAULT 0,
+		expires_at TIMESTAMP NOT NULL,
+		revoked BOOLEAN NOT NULL DEFAULT FALSE,
+		created_at TIMESTAMP NOT NULL,
+		FOREIGN KEY (created_by) REFERENCES users (user_id)
+	);`
+}
+
+func NewInvite(createdBy int64, role Role, maxUses int, ttl time.Duration) (*Invite, error) {
+	// deep link payloads allow A-Z, a-z, 0-9, _ and - only
+	buf := make([]byte, 10)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	return &Invite{
+		Code:      base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(buf),
+		CreatedBy: createdBy,
+		Role:      role,
+		MaxUses:   maxUses,
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	}, nil
+}
+
+func (i *Invite) IsValid(now time.Time) bool {
+	return !i.Revoked && i.Uses < i.MaxUses && now.Before(i.ExpiresAt)
+}
+
+func (i *Invite) toTelegramString(botUsername, lang string) string {
+	var status string
+	switch {
+	case i.Revoked:
+		status = T(lang, "invite.status_revoked")
+	case i.Uses >= i.MaxUses:
+		status = T(lang, "invite.status_used_up")
+	case !time.Now().UTC().Before(i.ExpiresAt):
+		status = T(lang, "invite.status_expired")
+	default:
+		status = T(lang, "invite.status_active")
+	}
+	return T(lang, "invite.card", "code", i.Code, "status", status, "link", fmt.Sprintf("https://t.me/%s?start=%s", botUsername, i.Code),
+		"role", i.Role, "uses", i.Uses, "max_uses", i.MaxUses, "expires_at", i.ExpiresAt.Format(time.RFC3339), "created_by", i.CreatedBy)
+}
+
+func (b *TelegramBot) createInvite(c *CommandContext) error {
+	maxUses := defaultInviteUses
+	if usesStr, ok := c.Flags["uses"]; ok {
+		uses, _ := strconv.Atoi(usesStr)
+		if uses < 1 {
+			return b.sendMessage(c.ChatId, c.T("invite.invalid_uses"))
+		}
+		maxUses = uses
+	}
+	ttl := defaultInviteExpiry
+	if expiresStr, ok := c.Flags["expires"]; ok {
+		d, err := ParseDuration(expiresStr)
+		if err != nil || d <= 0 {
+			return b.sendMessage(c.ChatId, c.T("invite.invalid_expires"))
+		}
+		ttl = d
+	}
+	role := RoleTrader
+	if roleStr, ok := c.Flags["role"]; ok {
+		r, ok := ParseRole(roleStr)
+		if !ok || r == RoleBanned {
+			return b.sendMessage(c.ChatId, c.T("invite.invalid_role"))
+		}
+		role = r
+	}
+	if !c.User.Role.Outranks(role) {
+		return b.sendMessage(c.ChatId, c.T("invite.outranked"))
+	}
+
+	invite, err := NewInvite(c.UserId, role, maxUses, ttl)
+	if err != nil {
+		return err
+	}
+	if err := b.store.CreateInvite(invite); err != nil {
+		return b.sendMessage(c.ChatId, c.T("invite.store_failed"))
+	}
+	return b.sendMessage(c.ChatId, c.T("invite.created")+"\n\n"+invite.toTelegramString(b.bot.Self.UserName, c.Lang))
+}
+
+func (b *TelegramBot) viewInvites(c *CommandContext) error {
+	invites, err := b.store.GetInvites()
+	if err != nil {
+		return err
+	}
+	showAll := len(c.Args) > 0 && c.Args[0] == "all"
+	now := time.Now().UTC()
+	var inviteStrings []string
+	for _, invite := range invites {
+		if !showAll && !invite.IsValid(now) {
+			continue
+		}
+		inviteStrings = append(inviteStrings, invite.toTelegramString(b.bot.Self.UserName, c.Lang))
+	}
+	if len(inviteStrings) == 0 {
+		return b.sendMessage(c.ChatId, c.T("invite.none"))
+	}
+	return b.sendMessageInChunks(c.ChatId, strings.Join(inviteStrings, "\n\n"))
+}
+
+func (b *TelegramBot) revokeInvite(c *CommandContext) error {
+	if err := b.store.RevokeInvite(c.Args[0]); err != nil {
+		if err == sql.ErrNoRows {
+			return b.sendMessage(c.ChatId, c.T("invite.not_found"))
+		}
+		return err
+	}
+	return b.sendMessage(c.ChatId, c.T("invite.revoked"))
+}
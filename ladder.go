@@ -0,0 +1,326 @@
+package main
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"html"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxLadderLevels is the number of price levels a ladder alert may have.
+const maxLadderLevels = 10
+
+// LadderLevel is one price of a ladder alert and when it was hit, nil while
+// it is pending.
+type LadderLevel struct {
+	Price float64    `json:"price"`
+	HitAt *time.Time `json:"hit_at,omitempty"`
+}
+
+// Ladder is the ordered price levels of a ladder alert, such as the
+// take-profits of a position: ascending above the price when it was set, or
+// descending below it. The levels fire one after another, each once.
+type Ladder struct {
+	Levels []LadderLevel `json:"levels"`
+}
+
+var errInvalidLadder = errors.New("invalid ladder")
+
+// parseLadder reads the prices of a ladder from the start of fields,
+// returning the ladder and the number of fields it used.
+func parseLadder(fields []string) (Ladder, int, error) {
+	var ladder Ladder
+	for _, field := range fields {
+		price, err := strconv.ParseFloat(field, 64)
+		if err != nil {
+			break
+		}
+		ladder.Levels = append(ladder.Levels, LadderLevel{Price: price})
+	}
+	if len(ladder.Levels) < 2 || len(ladder.Levels) > maxLadderLevels {
+		return ladder, 0, errInvalidLadder
+	}
+	return ladder, len(ladder.Levels), nil
+}
+
+// String renders the levels in the syntax parseLadder reads.
+func (l Ladder) String() string {
+	var prices []string
+	for _, level := range l.Levels {
+		prices = append(prices, strconv.FormatFloat(level.Price, 'f', -1, 64))
+	}
+	return strings.Join(prices, " ")
+}
+
+// ascending reports whether the ladder climbs above the price it was set at.
+func (l Ladder) ascending() bool {
+	return l.Levels[len(l.Levels)-1].Price > l.Levels[0].Price
+}
+
+// next returns the index of the first pending level, or -1 once every level
+// was hit.
+func (l Ladder) next() int {
+	for i, level := range l.Levels {
+		if level.HitAt == nil {
+			return i
+		}
+	}
+	return -1
+}
+
+// validate checks that the levels are strictly ordered in one direction, on
+// the tick of meta, and that some are pending and lie beyond the live price.
+func (l Ladder) validate(livePrice float64, meta SymbolMeta) error {
+	if len(l.Levels) < 2 || len(l.Levels) > maxLadderLevels {
+		return errInvalidLadder
+	}
+	ascending := l.ascending()
+	for i, level := range l.Levels {
+		if !(level.Price > 0) || !meta.OnTick(level.Price) {
+			return errInvalidLadder
+		}
+		if i > 0 && (level.Price > l.Levels[i-1].Price) != ascending || i > 0 && level.Price == l.Levels[i-1].Price {
+			return errInvalidLadder
+		}
+	}
+	next := l.next()
+	if next < 0 {
+		return errInvalidLadder
+	}
+	if first := l.Levels[next].Price; ascending && first <= livePrice || !ascending && first >= livePrice {
+		return errInvalidLadder
+	}
+	return nil
+}
+
+// Value stores the levels in the syntax parseLadder reads, each hit one
+// followed by the time it was hit such as 1.1@2024-05-01T10:00:00Z.
+func (l Ladder) Value() (driver.Value, error) {
+	return l.stored(), nil
+}
+
+func (l Ladder) stored() string {
+	var levels []string
+	for _, level := range l.Levels {
+		s := strconv.FormatFloat(level.Price, 'f', -1, 64)
+		if level.HitAt != nil {
+			s += "@" + level.HitAt.UTC().Format(time.RFC3339)
+		}
+		levels = append(levels, s)
+	}
+	return strings.Join(levels, " ")
+}
+
+// Scan reads a ladder stored by Value; other alerts store none.
+func (l *Ladder) Scan(src any) error {
+	var text string
+	switch v := src.(type) {
+	case string:
+		text = v
+	case []byte:
+		text = string(v)
+	case nil:
+	default:
+		return fmt.Errorf("cannot scan %T into a ladder", src)
+	}
+	*l = Ladder{}
+	for _, field := range strings.Fields(text) {
+		priceText, hitText, hit := strings.Cut(field, "@")
+		price, err := strconv.ParseFloat(priceText, 64)
+		if err != nil {
+			return fmt.Errorf("stored ladder %q: %w", text, err)
+		}
+		level := LadderLevel{Price: price}
+		if hit {
+			hitAt, err := time.Parse(time.RFC3339, hitText)
+			if err != nil {
+				return fmt.Errorf("stored ladder %q: %w", text, err)
+			}
+			level.HitAt = &hitAt
+		}
+		l.Levels = append(l.Levels, level)
+	}
+	return nil
+}
+
+// climb marks the pending levels the price reached since the alert started
+// watching as hit, in order, and returns their indexes. The target of the
+// alert moves on to the next pending level, or stays at the last one.
+func (a *Alert) climb(tolerance float64, now time.Time) []int {
+	var hits []int
+	ascending := a.Ladder.ascending()
+	for i := a.Ladder.next(); i >= 0; i = a.Ladder.next() {
+		level := &a.Ladder.Levels[i]
+		if ascending && a.HighPrice < level.Price-tolerance || !ascending && a.LowPrice > level.Price+tolerance {
+			break
+		}
+		hitAt := now.UTC()
+		level.HitAt = &hitAt
+		hits = append(hits, i)
+	}
+	if next := a.Ladder.next(); next >= 0 {
+		a.TargetPrice = a.Ladder.Levels[next].Price
+	} else {
+		a.TargetPrice = a.Ladder.Levels[len(a.Ladder.Levels)-1].Price
+	}
+	return hits
+}
+
+// NewLadderAlert creates an alert on the pending levels of a ladder, watched
+// from livePrice.
+func NewLadderAlert(userId, chatId int64, symbol, description string, ladder Ladder, livePrice float64) *Alert {
+	alert := NewAlert(userId, chatId, symbol, description, ladder.Levels[ladder.next()].Price, livePrice)
+	alert.Kind = AlertLadder
+	alert.Ladder = ladder
+	return alert
+}
+
+// ladderString renders a ladder alert as a card, with a line per level.
+func (a *Alert) ladderString(activeIcon string, livePrice float64, prefs *Preferences, lang string) string {
+	price := func(p float64) string {
+		return prefs.FormatPrice(a.Symbol, p)
+	}
+	header := fmt.Sprintf("#%d [%s ladder %d/%d] %s", a.Number, strings.ToUpper(a.Symbol), a.Ladder.hit(), len(a.Ladder.Levels), activeIcon)
+	if prefs.Cards == CardCompact {
+		if a.Ladder.next() >= 0 {
+			header += " " + price(a.TargetPrice)
+		}
+		return header + " " + a.Description
+	}
+	lines := []string{header + " " + a.Description}
+	for i, level := range a.Ladder.Levels {
+		if level.HitAt != nil {
+			lines = append(lines, T(lang, "ladder.card_hit", "level", fmt.Sprintf("%d.%d", a.Number, i+1), "price", price(level.Price), "time", prefs.FormatTime(*level.HitAt)))
+			continue
+		}
+		lines = append(lines, T(lang, "ladder.card_pending", "level", fmt.Sprintf("%d.%d", a.Number, i+1), "price", price(level.Price), "distance", price(math.Abs(level.Price-livePrice))))
+	}
+	lines = append(lines, T(lang, "ladder.card_price", "price", price(livePrice)))
+	lines = append(lines, T(lang, "alert.card_created", "time", prefs.FormatTime(a.CreatedAt)))
+	return strings.Join(lines, "\n")
+}
+
+// ladderTriggeredText is the notification of the levels a ladder alert hit
+// in one check.
+func ladderTriggeredText(alert *Alert, hits []int, t *Ticker, prefs *Preferences, lang string) string {
+	var levels []string
+	for _, i := range hits {
+		levels = append(levels, fmt.Sprintf("#%d.%d %s", alert.Number, i+1, prefs.FormatPrice(alert.Symbol, alert.Ladder.Levels[i].Price)))
+	}
+	key := "ladder.triggered"
+	if alert.Ladder.next() < 0 {
+		key = "ladder.completed"
+	}
+	return T(lang, key, "symbol", alert.Symbol, "levels", strings.Join(levels, ", "), "price", prefs.FormatPrice(alert.Symbol, t.LivePrice), "hit", alert.Ladder.hit(), "count", len(alert.Ladder.Levels), "description", html.EscapeString(alert.Description))
+}
+
+// hit returns how many levels were hit, which are the first ones.
+func (l Ladder) hit() int {
+	if next := l.next(); next >= 0 {
+		return next
+	}
+	return len(l.Levels)
+}
+
+// createLadderAlert handles `/createalert <symbol> ladder <price> <price>...
+// [description]`.
+func (b *TelegramBot) createLadderAlert(c *CommandContext, alertChatId int64, t *Ticker) error {
+	var fields []string
+	if len(c.Args) > 2 {
+		fields = strings.Fields(c.Args[2])
+	}
+	ladder, used, err := parseLadder(fields)
+	if err == nil {
+		err = ladder.validate(t.LivePrice, t.Meta)
+	}
+	if err != nil {
+		return b.sendMessage(c.ChatId, c.T("ladder.invalid", "max", maxLadderLevels, "price", t.Meta.Format(t.LivePrice), "tick", t.Meta.Format(t.Meta.TickSize)))
+	}
+	description := strings.Join(fields[used:], " ")
+	if description == "" {
+		description = c.Flags["note"]
+	}
+
+	alert := NewLadderAlert(c.UserId, alertChatId, t.Symbol, description, ladder, t.LivePrice)
+	alert.Urgent = c.Flags["urgent"] == "true"
+	if ok, err := b.setValidity(c, alert); !ok {
+		return err
+	}
+	if err := b.store.CreateAlert(alert); err != nil {
+		return b.sendMessage(c.ChatId, c.T("alert.store_failed"))
+	}
+	return b.sendMessage(c.ChatId, c.T("ladder.created", "number", alert.Number, "count", len(ladder.Levels)))
+}
+
+// parseAlertRef reads an alert number, optionally with the number of one
+// level of a ladder alert, such as 12 or 12.3; level is 0 without one.
+func parseAlertRef(ref string) (number int32, level int, err error) {
+	numberText, levelText, hasLevel := strings.Cut(strings.TrimPrefix(ref, "#"), ".")
+	n, err := strconv.ParseInt(numberText, 10, 32)
+	if err != nil {
+		return 0, 0, err
+	}
+	if hasLevel {
+		if level, err = strconv.Atoi(levelText); err != nil || level < 1 {
+			return 0, 0, errInvalidLadder
+		}
+	}
+	return int32(n), level, nil
+}
+
+// editLadderLevel moves one pending level of a ladder alert to a new price,
+// or removes it when remove is set, and watches the price again from now.
+// It returns the message key of why the level can't be changed, or "".
+func (a *Alert) editLadderLevel(level int, price float64, remove bool, t *Ticker) string {
+	if level > len(a.Ladder.Levels) {
+		return "ladder.no_level"
+	}
+	if a.Ladder.Levels[level-1].HitAt != nil {
+		return "ladder.level_hit"
+	}
+	ladder := Ladder{Levels: append([]LadderLevel(nil), a.Ladder.Levels...)}
+	if remove {
+		ladder.Levels = append(ladder.Levels[:level-1], ladder.Levels[level:]...)
+		if ladder.next() < 0 {
+			return "ladder.last_level"
+		}
+	} else {
+		ladder.Levels[level-1].Price = price
+	}
+	if ladder.validate(t.LivePrice, t.Meta) != nil {
+		return "ladder.invalid_level"
+	}
+	a.Ladder = ladder
+	a.SetTarget(ladder.Levels[ladder.next()].Price, t.LivePrice)
+	a.UpdatedAt = time.Now().UTC()
+	return ""
+}
+
+// updateLadderLevel handles `/updatealert <number>.<level> <price>` and
+// `/deletealert <number>.<level>`, which removes the level.
+func (b *TelegramBot) updateLadderLevel(c *CommandContext, alert *Alert, level int, price float64, remove bool) error {
+	if alert.Kind != AlertLadder {
+		return b.sendMessage(c.ChatId, c.T("ladder.not_ladder", "number", alert.Number))
+	}
+	if level == 0 {
+		return b.sendMessage(c.ChatId, c.T("ladder.no_update", "number", alert.Number))
+	}
+	ticker, exists := getTicker(alert.Symbol)
+	if !exists {
+		return b.sendMessage(c.ChatId, c.T("alert.no_live_price"))
+	}
+	if key := alert.editLadderLevel(level, price, remove, ticker); key != "" {
+		return b.sendMessage(c.ChatId, c.T(key, "level", fmt.Sprintf("%d.%d", alert.Number, level), "price", ticker.Meta.Format(ticker.LivePrice), "tick", ticker.Meta.Format(ticker.Meta.TickSize)))
+	}
+	if err := b.store.UpdateAlert(alert); err != nil {
+		return err
+	}
+	if remove {
+		return b.sendMessage(c.ChatId, c.T("ladder.level_deleted", "level", fmt.Sprintf("%d.%d", alert.Number, level)))
+	}
+	return b.sendMessage(c.ChatId, c.T("ladder.level_updated", "level", fmt.Sprintf("%d.%d", alert.Number, level)))
+}
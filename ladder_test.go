@@ -0,0 +1,134 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseLadder(t *testing.T) {
+	meta := SymbolMeta{TickSize: 0.01}
+	tests := []struct {
+		fields []string
+		used   int
+		isErr  bool
+	}{
+		{fields: []string{"105", "110", "120", "take", "profits"}, used: 3},
+		{fields: []string{"95", "90"}, used: 2},
+		{fields: []string{"110"}, isErr: true},
+		// the levels must be ordered away from the price of 100
+		{fields: []string{"110", "105"}, isErr: true},
+		{fields: []string{"95", "105"}, isErr: true},
+		{fields: []string{"105", "105"}, isErr: true},
+		{fields: []string{"105", "110.005"}, isErr: true},
+		{fields: []string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10", "11"}, isErr: true},
+	}
+	for _, tt := range tests {
+		ladder, used, err := parseLadder(tt.fields)
+		if err == nil {
+			err = ladder.validate(100, meta)
+		}
+		if tt.isErr {
+			if err == nil {
+				t.Errorf("parseLadder(%q) expected an error", tt.fields)
+			}
+			continue
+		}
+		if err != nil || used != tt.used {
+			t.Errorf("parseLadder(%q) = %d, %v, want %d", tt.fields, used, err, tt.used)
+		}
+	}
+}
+
+func TestLadderClimb(t *testing.T) {
+	ladder, _, _ := parseLadder([]string{"105", "110", "120"})
+	alert := NewLadderAlert(1, 1, "btc", "", ladder, 100)
+	ticker := &Ticker{Meta: SymbolMeta{TickSize: 0.01}, LivePrice: 100, UpdatedAt: alert.WatchedSince}
+	steps := []struct {
+		price  float64
+		hits   int
+		target float64
+	}{
+		{price: 104, target: 105},
+		{price: 106, hits: 1, target: 110},
+		{price: 103, target: 110},
+		// a move through several levels hits them together, in order
+		{price: 121, hits: 2, target: 120},
+	}
+	for i, step := range steps {
+		ticker.PrevPrice, ticker.PrevUpdatedAt = ticker.LivePrice, ticker.UpdatedAt
+		ticker.RangeHigh, ticker.RangeLow = max(ticker.PrevPrice, step.price), min(ticker.PrevPrice, step.price)
+		ticker.LivePrice, ticker.UpdatedAt = step.price, alert.WatchedSince.Add(time.Duration(i+1)*time.Minute)
+		alert.observe(ticker)
+		hits := alert.climb(ticker.Meta.Tolerance(), ticker.UpdatedAt)
+		if len(hits) != step.hits || alert.TargetPrice != step.target {
+			t.Errorf("at %g: hits %v, target %g, want %d hits, %g", step.price, hits, alert.TargetPrice, step.hits, step.target)
+		}
+	}
+	if alert.Ladder.next() != -1 || alert.Ladder.hit() != 3 {
+		t.Errorf("ladder not completed: %+v", alert.Ladder)
+	}
+
+	// hit levels survive storage
+	var stored Ladder
+	if err := stored.Scan(alert.Ladder.stored()); err != nil || stored.hit() != 3 || stored.String() != "105 110 120" {
+		t.Errorf("Scan(%q) = %+v, %v", alert.Ladder.stored(), stored, err)
+	}
+}
+
+func TestEditLadderLevel(t *testing.T) {
+	ladder, _, _ := parseLadder([]string{"95", "90", "85"})
+	alert := NewLadderAlert(1, 1, "eurusd", "", ladder, 100)
+	hitAt := time.Now()
+	alert.Ladder.Levels[0].HitAt = &hitAt
+	ticker := &Ticker{Meta: SymbolMeta{TickSize: 0.01}, LivePrice: 94}
+
+	tests := []struct {
+		level  int
+		price  float64
+		remove bool
+		want   string
+	}{
+		{level: 1, price: 96, want: "ladder.level_hit"},
+		{level: 4, price: 80, want: "ladder.no_level"},
+		{level: 2, price: 84, want: "ladder.invalid_level"},
+		{level: 2, price: 95, want: "ladder.invalid_level"},
+		{level: 2, price: 92},
+		{level: 3, remove: true},
+		{level: 2, remove: true, want: "ladder.last_level"},
+	}
+	for _, tt := range tests {
+		if got := alert.editLadderLevel(tt.level, tt.price, tt.remove, ticker); got != tt.want {
+			t.Errorf("editLadderLevel(%d, %g, %t) = %q, want %q", tt.level, tt.price, tt.remove, got, tt.want)
+		}
+	}
+	if alert.Ladder.String() != "95 92" || alert.TargetPrice != 92 || alert.StartPrice != 94 {
+		t.Errorf("edited ladder %s, target %g from %g", alert.Ladder, alert.TargetPrice, alert.StartPrice)
+	}
+}
+
+func TestParseAlertRef(t *testing.T) {
+	tests := []struct {
+		ref    string
+		number int32
+		level  int
+		isErr  bool
+	}{
+		{ref: "12", number: 12},
+		{ref: "#12.3", number: 12, level: 3},
+		{ref: "12.0", isErr: true},
+		{ref: "12.", isErr: true},
+		{ref: "twelve", isErr: true},
+	}
+	for _, tt := range tests {
+		number, level, err := parseAlertRef(tt.ref)
+		if tt.isErr {
+			if err == nil {
+				t.Errorf("parseAlertRef(%q) expected an error", tt.ref)
+			}
+			continue
+		}
+		if err != nil || number != tt.number || level != tt.level {
+			t.Errorf("parseAlertRef(%q) = %d, %d, %v, want %d, %d", tt.ref, number, level, err, tt.number, tt.level)
+		}
+	}
+}
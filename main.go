@@ -39,7 +39,21 @@ func main() {
 		log.Panic("Could not stablish admin user.")
 	}
 
-	bot, err := NewTelegramBot(store, apiKey)
+	if err := LoadHolidays(HolidaysDirFromEnv()); err != nil {
+		log.Panic("Invalid holidays.", err)
+	}
+
+	allowedUserIds, err := AllowedUserIdsFromEnv()
+	if err != nil {
+		log.Panic("Invalid allowed userIds.", err)
+	}
+	for _, userId := range allowedUserIds {
+		if err := store.AddToAllowlist(userId, adminUserId); err != nil {
+			log.Panic("Could not allowlist user.", err)
+		}
+	}
+
+	bot, err := NewTelegramBot(store, apiKey, RegistrationModeFromEnv())
 	if err != nil {
 		log.Panic("Telegram bot does not initialized", err)
 	}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Move alert windows range from one scrape cycle to a day of quotes.
+const (
+	minMoveWindow = 5 * time.Minute
+	maxMoveWindow = 24 * time.Hour
+)
+
+// moveCategories maps the categories a move alert can watch as a whole, by
+// the names /viewsymbols filters on, to the category of their tickers.
+var moveCategories = map[string]string{
+	"crypto":    "crypto",
+	"cryptos":   "crypto",
+	"feature":   "feature",
+	"forex":     "forex",
+	"synthetic": "synthetic",
+}
+
+// Move is a change of the price by Percent within a window of Minutes,
+// measured from the lowest price of the window for rises and from the
+// highest for falls.
+type Move struct {
+	Percent float64 `json:"percent"`
+	// Direction is 1 for rises, -1 for falls and 0 for both
+	Direction int `json:"direction"`
+	Minutes   int `json:"minutes"`
+}
+
+var errInvalidMove = errors.New("invalid move")
+
+// parseMove reads `<[+|-|±]pct> <window>` from the start of fields, such as
+// `-8% 30m` or `5% 2h`, returning the move and the number of fields it used.
+func parseMove(fields []string) (Move, int, error) {
+	var move Move
+	if len(fields) < 2 {
+		return move, 0, errInvalidMove
+	}
+	value := strings.TrimSuffix(fields[0], "%")
+	switch {
+	case strings.HasPrefix(value, "+"):
+		move.Direction = 1
+	case strings.HasPrefix(value, "-"):
+		move.Direction = -1
+	}
+	value = strings.TrimLeft(value, "+-±")
+	percent, err := strconv.ParseFloat(value, 64)
+	if err != nil || !(percent > 0) || percent >= 100 {
+		return move, 0, errInvalidMove
+	}
+	move.Percent = percent
+
+	window, err := time.ParseDuration(strings.ToLower(fields[1]))
+	if err != nil || window%time.Minute != 0 || window < minMoveWindow || window > maxMoveWindow {
+		return move, 0, errInvalidMove
+	}
+	move.Minutes = int(window / time.Minute)
+	return move, 2, nil
+}
+
+// String renders the move in the syntax parseMove reads.
+func (m Move) String() string {
+	s := strconv.FormatFloat(m.Percent, 'f', -1, 64) + "% "
+	switch m.Direction {
+	case 1:
+		s = "+" + s
+	case -1:
+		s = "-" + s
+	}
+	if m.Minutes%60 == 0 {
+		return s + strconv.Itoa(m.Minutes/60) + "h"
+	}
+	return s + strconv.Itoa(m.Minutes) + "m"
+}
+
+func (m Move) window() time.Duration {
+	return time.Duration(m.Minutes) * time.Minute
+}
+
+// Quote is a live price sampled from the ticker registry.
+type Quote struct {
+	Price float64
+	At    time.Time
+}
+
+// swing returns how far in percent the last quote rose above the lowest and
+// fell below the highest price quoted within the window before it.
+func swing(quotes []Quote, window time.Duration) (rise, fall float64) {
+	if len(quotes) < 2 {
+		return 0, 0
+	}
+	last := quotes[len(quotes)-1]
+	low, high := last.Price, last.Price
+	for _, q := range quotes {
+		if q.At.Before(last.At.Add(-window)) {
+			continue
+		}
+		low, high = min(low, q.Price), max(high, q.Price)
+	}
+	// percentages of spreads crossing zero mean nothing
+	if low > 0 {
+		rise = (last.Price - low) / low * 100
+	}
+	if high > 0 {
+		fall = (high - last.Price) / high * 100
+	}
+	return rise, fall
+}
+
+// roundPercent rounds a measured move to hundredths of a percent.
+func roundPercent(percent float64) float64 {
+	return math.Round(percent*100) / 100
+}
+
+var (
+	// quotesMu guards quotes, recorded by the scraper and read by the alert
+	// checker
+	quotesMu sync.Mutex
+	// quotes keeps the quotes of the last maxMoveWindow per symbol
+	quotes = make(map[string][]Quote)
+)
+
+// recordQuotes appends the latest quote of every ticker in the snapshot to
+// its history, once per scrape cycle. Synthetic tickers outside the snapshot
+// are recorded once a move alert asked for them.
+func recordQuotes(snapshot map[string]*Ticker) {
+	quotesMu.Lock()
+	defer quotesMu.Unlock()
+
+	for symbol := range quotes {
+		lookupTicker(snapshot, symbol)
+	}
+	for symbol, t := range snapshot {
+		history := quotes[symbol]
+		if len(history) > 0 && !t.UpdatedAt.After(history[len(history)-1].At) {
+			continue
+		}
+		history = append(history, Quote{Price: t.LivePrice, At: t.UpdatedAt})
+		// drop the quotes no window reaches back to
+		i := sort.Search(len(history), func(i int) bool {
+			return !history[i].At.Before(t.UpdatedAt.Add(-maxMoveWindow))
+		})
+		quotes[symbol] = history[i:]
+	}
+}
+
+// recentSwing returns the swing of a symbol within the window.
+func recentSwing(symbol string, window time.Duration) (rise, fall float64) {
+	quotesMu.Lock()
+	defer quotesMu.Unlock()
+
+	history, exist := quotes[symbol]
+	if !exist {
+		quotes[symbol] = nil
+	}
+	return swing(history, window)
+}
+
+// FiredMoves are the tickers and directions, such as btc+ or eurusd-, a move
+// alert fired for until their move died down to half the percentage, so one
+// sustained move is notified once, across restarts as well.
+type FiredMoves map[string]bool
+
+// Value stores the fired moves as their sorted keys separated by spaces.
+func (f FiredMoves) Value() (driver.Value, error) {
+	keys := make([]string, 0, len(f))
+	for key := range f {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, " "), nil
+}
+
+// Scan reads fired moves stored by Value.
+func (f *FiredMoves) Scan(src any) error {
+	var text string
+	switch v := src.(type) {
+	case string:
+		text = v
+	case []byte:
+		text = string(v)
+	case nil:
+	default:
+		return fmt.Errorf("cannot scan %T into fired moves", src)
+	}
+	*f = FiredMoves{}
+	for _, key := range strings.Fields(text) {
+		(*f)[key] = true
+	}
+	return nil
+}
+
+// MoveHit is a ticker moving by at least the percentage of a move alert.
+type MoveHit struct {
+	Symbol  string
+	Price   float64
+	Percent float64
+}
+
+// detectMoves returns the tickers whose move in the window reached the
+// alert's percentage and were not notified for the same move yet, and
+// reports whether MovesFired changed.
+func (a *Alert) detectMoves(tickers []*Ticker) (hits []MoveHit, changed bool) {
+	m := a.Move
+	if a.MovesFired == nil {
+		a.MovesFired = FiredMoves{}
+	}
+	fired := a.MovesFired
+	for _, t := range tickers {
+		rise, fall := recentSwing(t.Symbol, m.window())
+		for _, d := range []struct {
+			key     string
+			sign    int
+			percent float64
+		}{{key: t.Symbol + "+", sign: 1, percent: rise}, {key: t.Symbol + "-", sign: -1, percent: fall}} {
+			if m.Direction != 0 && m.Direction != d.sign {
+				continue
+			}
+			switch {
+			case fired[d.key] && d.percent < m.Percent/2:
+				delete(fired, d.key)
+				changed = true
+			case !fired[d.key] && d.percent >= m.Percent:
+				fired[d.key] = true
+				changed = true
+				hits = append(hits, MoveHit{Symbol: t.Symbol, Price: t.LivePrice, Percent: roundPercent(float64(d.sign) * d.percent)})
+			}
+		}
+	}
+	return hits, changed
+}
+
+// moveTickers returns the fresh tickers a move alert watches: the tickers
+// of its category or its one symbol.
+func moveTickers(alert *Alert, snapshot map[string]*Ticker, now time.Time) []*Ticker {
+	var tickers []*Ticker
+	if category, exist := moveCategories[alert.Symbol]; exist {
+		for _, t := range snapshot {
+			if t.Category == category && !t.Stale(now) && marketOpen(t.Category, now) {
+				tickers = append(tickers, t)
+			}
+		}
+		sort.Slice(tickers, func(i, j int) bool { return tickers[i].Symbol < tickers[j].Symbol })
+	} else if t, exist := lookupTicker(snapshot, alert.Symbol); exist && !t.Stale(now) && closedSymbol([]string{alert.Symbol}, snapshot, now) == "" {
+		tickers = append(tickers, t)
+	}
+	return tickers
+}
+
+// NewMoveAlert creates an alert on moves of a symbol, or of every ticker of
+// a category.
+func NewMoveAlert(userId, chatId int64, scope, description string, move Move) *Alert {
+	alert := NewAlert(userId, chatId, scope, description, 0, 0)
+	alert.Kind = AlertMove
+	alert.Move = move
+	return alert
+}
+
+// moveScope is the symbol of a move alert, or its category as shown on cards.
+func moveScope(symbol, lang string) string {
+	if category, exist := moveCategories[symbol]; exist {
+		return T(lang, "move.category", "category", strings.ToUpper(category))
+	}
+	return strings.ToUpper(symbol)
+}
+
+// moveString renders a move alert as a card.
+func (a *Alert) moveString(activeIcon string, prefs *Preferences, lang string) string {
+	header := fmt.Sprintf("#%d [%s move %s] %s %s", a.Number, moveScope(a.Symbol, lang), a.Move, activeIcon, a.Description)
+	if prefs.Cards == CardCompact {
+		return header
+	}
+	lines := []string{header}
+	// the largest move the alert watches right now
+	var largest MoveHit
+	for _, t := range moveTickers(a, snapshotTickers(), time.Now()) {
+		rise, fall := recentSwing(t.Symbol, a.Move.window())
+		if a.Move.Direction >= 0 && rise > math.Abs(largest.Percent) {
+			largest = MoveHit{Symbol: t.Symbol, Price: t.LivePrice, Percent: roundPercent(rise)}
+		}
+		if a.Move.Direction <= 0 && fall > math.Abs(largest.Percent) {
+			largest = MoveHit{Symbol: t.Symbol, Price: t.LivePrice, Percent: roundPercent(-fall)}
+		}
+	}
+	if largest.Symbol != "" {
+		lines = append(lines, T(lang, "move.card_now", "symbol", strings.ToUpper(largest.Symbol), "move", formatPercent(largest.Percent), "price", prefs.FormatPrice(largest.Symbol, largest.Price)))
+	}
+	lines = append(lines, T(lang, "alert.card_created", "time", prefs.FormatTime(a.CreatedAt)))
+	return strings.Join(lines, "\n")
+}
+
+// moveTriggeredText is the notification of the tickers a move alert fired
+// for in one check.
+func moveTriggeredText(alert *Alert, hits []MoveHit, prefs *Preferences, lang string) string {
+	var lines []string
+	for _, hit := range hits {
+		lines = append(lines, T(lang, "move.hit", "symbol", strings.ToUpper(hit.Symbol), "move", formatPercent(hit.Percent), "price", prefs.FormatPrice(hit.Symbol, hit.Price)))
+	}
+	return T(lang, "move.triggered", "scope", moveScope(alert.Symbol, lang), "move", alert.Move.String(), "moves", strings.Join(lines, "\n"), "description", html.EscapeString(alert.Description))
+}
+
+// checkMoveAlert notifies the tickers a move alert fired for. Move alerts
+// stay active and keep watching once they fired.
+func (b *TelegramBot) checkMoveAlert(alert *Alert, snapshot map[string]*Ticker) {
+	if _, exist := moveCategories[alert.Symbol]; !exist {
+		if missing := missingSymbol([]string{alert.Symbol}, snapshot); missing != "" {
+			log.Println("Symbol not found:", missing, "id:", alert.Id)
+			b.sendMessage(alert.ChatId, T(b.userLanguage(alert.UserId), "alert.symbol_missing", "symbol", missing))
+			return
+		}
+	}
+	hits, changed := alert.detectMoves(moveTickers(alert, snapshot, time.Now()))
+	if changed {
+		if err := b.store.UpdateAlert(alert); err != nil {
+			log.Println("Error updating alert", err)
+		}
+	}
+	if len(hits) == 0 {
+		return
+	}
+	prefs, lang := b.preferences(alert.UserId), b.userLanguage(alert.UserId)
+	b.notify(alert, NotificationTrigger, moveTriggeredText(alert, hits, prefs, lang), prefs, lang)
+}
+
+// createMoveAlert handles `/movealert <ticker|category> <[+|-]pct> <window>
+// [description]`.
+func (b *TelegramBot) createMoveAlert(c *CommandContext) error {
+	alertChatId, err := b.alertChat(c, true)
+	if alertChatId == 0 {
+		return err
+	}
+	scope := c.Args[0]
+	if category, exist := moveCategories[scope]; exist {
+		scope = category
+	} else if t, exist := getTicker(scope); exist {
+		scope = t.Symbol
+	} else {
+		return b.sendMessage(c.ChatId, c.T("symbol.not_found"))
+	}
+	move, _, err := parseMove(c.Args[1:3])
+	if err != nil {
+		return b.sendMessage(c.ChatId, c.T("move.invalid", "min", int(minMoveWindow/time.Minute), "max", int(maxMoveWindow/time.Hour)))
+	}
+	if ok, err := b.checkAlertQuota(c, scope); !ok {
+		return err
+	}
+	description := c.Flags["note"]
+	if len(c.Args) > 3 {
+		description = c.Args[3]
+	}
+
+	alert := NewMoveAlert(c.UserId, alertChatId, scope, description, move)
+	alert.Urgent = c.Flags["urgent"] == "true"
+	if ok, err := b.setValidity(c, alert); !ok {
+		return err
+	}
+	if err := b.store.CreateAlert(alert); err != nil {
+		return b.sendMessage(c.ChatId, c.T("alert.store_failed"))
+	}
+	return b.sendMessage(c.ChatId, c.T("move.created", "scope", moveScope(scope, c.Lang), "move", move.String()))
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseMove(t *testing.T) {
+	tests := []struct {
+		fields []string
+		want   Move
+		isErr  bool
+	}{
+		{fields: []string{"8%", "30m"}, want: Move{Percent: 8, Minutes: 30}},
+		{fields: []string{"+2.5%", "1H"}, want: Move{Percent: 2.5, Direction: 1, Minutes: 60}},
+		{fields: []string{"-0.5", "1h30m"}, want: Move{Percent: 0.5, Direction: -1, Minutes: 90}},
+		{fields: []string{"±3%", "24h"}, want: Move{Percent: 3, Minutes: 24 * 60}},
+		{fields: []string{"8%"}, isErr: true},
+		{fields: []string{"0%", "30m"}, isErr: true},
+		{fields: []string{"100%", "30m"}, isErr: true},
+		{fields: []string{"8%", "4m"}, isErr: true},
+		{fields: []string{"8%", "25h"}, isErr: true},
+		{fields: []string{"8%", "90s"}, isErr: true},
+		{fields: []string{"8%", "soon"}, isErr: true},
+	}
+	for _, tt := range tests {
+		got, _, err := parseMove(tt.fields)
+		if tt.isErr {
+			if err == nil {
+				t.Errorf("parseMove(%q) expected an error", tt.fields)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("parseMove(%q) = %+v, %v, want %+v", tt.fields, got, err, tt.want)
+		}
+	}
+
+	// String renders what parseMove reads
+	for _, move := range []Move{{Percent: 8, Minutes: 30}, {Percent: 0.5, Direction: -1, Minutes: 90}, {Percent: 3, Direction: 1, Minutes: 120}} {
+		if got, _, err := parseMove(strings.Fields(move.String())); err != nil || got != move {
+			t.Errorf("parseMove(%q) = %+v, %v, want %+v", move.String(), got, err, move)
+		}
+	}
+}
+
+func TestMoveDetect(t *testing.T) {
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	ticker := &Ticker{Symbol: "btcusd"}
+	alert := NewMoveAlert(1, 1, "btcusd", "", Move{Percent: 8, Minutes: 30})
+	defer delete(quotes, "btcusd")
+
+	tests := []struct {
+		price float64
+		want  float64
+	}{
+		{price: 100},
+		{price: 104},
+		// 8% above the low of the window
+		{price: 108, want: 8},
+		// the same move keeps going and is not notified again
+		{price: 112},
+		{price: 115},
+		{price: 110},
+		// a fall from the high is a move of its own
+		{price: 105, want: -8.7},
+		// the low of 100 left the window and the rise faded below 4%
+		{price: 106},
+		// so a new rise from the low of 105 is notified again
+		{price: 115, want: 9.52},
+	}
+	for i, tt := range tests {
+		quotes["btcusd"] = append(quotes["btcusd"], Quote{Price: tt.price, At: start.Add(time.Duration(i) * 5 * time.Minute)})
+		ticker.LivePrice = tt.price
+		hits, _ := alert.detectMoves([]*Ticker{ticker})
+		switch {
+		case tt.want == 0 && len(hits) > 0:
+			t.Errorf("quote %d at %g: hits %+v, want none", i, tt.price, hits)
+		case tt.want != 0 && (len(hits) != 1 || hits[0].Percent != tt.want):
+			t.Errorf("quote %d at %g: hits %+v, want a move of %g", i, tt.price, hits, tt.want)
+		}
+	}
+	// the fired moves survive storage
+	value, _ := alert.MovesFired.Value()
+	var stored FiredMoves
+	if err := stored.Scan(value); err != nil || len(stored) != 1 || !stored["btcusd+"] {
+		t.Errorf("Scan(%q) = %v, %v", value, stored, err)
+	}
+}
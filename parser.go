@@ -0,0 +1,285 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var errUnterminatedQuote = errors.New("unterminated quote")
+
+// ParsedCommand is a tokenized command message such as
+// `/createalert@OurBot eurusd 1.1 "breakout retest" --note="x"`.
+type ParsedCommand struct {
+	Name    string
+	Mention string
+	Args    []string
+	// Rest[i] is Args[i] through the last argument joined as they were
+	// typed, keeping line breaks and spacing for free text.
+	Rest  []string
+	Flags map[string]string
+}
+
+// token is a word of a command message and the byte range it spans in it.
+type token struct {
+	value      string
+	start, end int
+}
+
+// ParseCommand splits a command message into its name, the optional bot
+// username it was addressed to, positional arguments and --flags. Double
+// quotes, single quotes opening a word and backslash escapes are honoured, so
+// apostrophes inside words are kept; the case of arguments is preserved.
+func ParseCommand(text string) (*ParsedCommand, error) {
+	tokens, err := tokenize(text)
+	if err != nil {
+		return nil, err
+	}
+	parsed := &ParsedCommand{Flags: make(map[string]string)}
+	if len(tokens) == 0 {
+		return parsed, nil
+	}
+
+	name := strings.TrimPrefix(tokens[0].value, "/")
+	if i := strings.Index(name, "@"); i >= 0 {
+		name, parsed.Mention = name[:i], name[i+1:]
+	}
+	parsed.Name = strings.ToLower(name)
+
+	var positional []int
+	flagsDone := false
+	for i, token := range tokens[1:] {
+		if flagsDone || !strings.HasPrefix(token.value, "--") {
+			parsed.Args = append(parsed.Args, token.value)
+			positional = append(positional, i+1)
+			continue
+		}
+		if token.value == "--" {
+			// everything after a bare -- is positional
+			flagsDone = true
+			continue
+		}
+		key, value, found := strings.Cut(token.value[2:], "=")
+		if !found {
+			value = "true"
+		}
+		parsed.Flags[strings.ToLower(key)] = value
+	}
+
+	// Rest joins the unquoted arguments, with the spacing typed between them
+	// or a single space where flags were left out
+	rest := ""
+	for i := len(positional) - 1; i >= 0; i-- {
+		if i < len(positional)-1 {
+			gap := " "
+			if next := positional[i+1]; next == positional[i]+1 {
+				gap = text[tokens[positional[i]].end:tokens[next].start]
+			}
+			rest = gap + rest
+		}
+		rest = parsed.Args[i] + rest
+		parsed.Rest = append([]string{rest}, parsed.Rest...)
+	}
+	return parsed, nil
+}
+
+func tokenize(text string) ([]token, error) {
+	var (
+		tokens  []token
+		current strings.Builder
+		start   int
+		quote   rune
+		escaped bool
+		inToken bool
+	)
+	begin := func(i int) {
+		if !inToken {
+			start, inToken = i, true
+		}
+	}
+	for i, r := range text {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			begin(i)
+			escaped = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '"' || r == '\'' && !inToken:
+			// an apostrophe inside a word is not a quote
+			begin(i)
+			quote = r
+		case unicode.IsSpace(r):
+			if inToken {
+				tokens = append(tokens, token{value: current.String(), start: start, end: i})
+				current.Reset()
+				inToken = false
+			}
+		default:
+			begin(i)
+			current.WriteRune(r)
+		}
+	}
+	if quote != 0 {
+		return nil, errUnterminatedQuote
+	}
+	if inToken {
+		tokens = append(tokens, token{value: current.String(), start: start, end: len(text)})
+	}
+	return tokens, nil
+}
+
+type ArgType int
+
+const (
+	// ArgString is a single word, kept as typed
+	ArgString ArgType = iota
+	// ArgSymbol is a ticker symbol, lowercased
+	ArgSymbol
+	// ArgNumber is a finite floating point number such as a price
+	ArgNumber
+	// ArgInteger is a whole number such as an alert number
+	ArgInteger
+	// ArgText consumes all remaining arguments as one free text argument
+	ArgText
+	// ArgAlertRef is an alert number, or the number of one level of a
+	// ladder alert such as 12.3
+	ArgAlertRef
+)
+
+// ArgSpec describes one positional argument or flag of a command.
+type ArgSpec struct {
+	Name     string
+	Type     ArgType
+	Optional bool
+	// Keywords are words accepted, lowercased, in place of a value of Type
+	Keywords []string
+}
+
+func (a ArgSpec) String() string {
+	if strings.HasPrefix(a.Name, "--") {
+		return a.Name
+	}
+	if a.Optional {
+		return "[" + a.Name + "]"
+	}
+	return "<" + a.Name + ">"
+}
+
+// ArgError reports a single invalid or missing argument. Reason names the
+// message in the catalogs, arg.<reason>.
+type ArgError struct {
+	Arg    string
+	Value  string
+	Reason string
+}
+
+const (
+	reasonNotNumber     = "not_number"
+	reasonNotInteger    = "not_integer"
+	reasonNotAlertRef   = "not_alert_ref"
+	reasonMissing       = "missing"
+	reasonUnexpected    = "unexpected"
+	reasonUnknownOption = "unknown_option"
+)
+
+func (e *ArgError) Error() string {
+	return e.Localize(defaultLanguage)
+}
+
+func (e *ArgError) Localize(lang string) string {
+	return T(lang, "arg."+e.Reason, "arg", e.Arg, "value", e.Value)
+}
+
+func normalizeArg(spec ArgSpec, value string) (string, error) {
+	for _, keyword := range spec.Keywords {
+		if strings.EqualFold(value, keyword) {
+			return keyword, nil
+		}
+	}
+	switch spec.Type {
+	case ArgSymbol:
+		return strings.ToLower(value), nil
+	case ArgNumber:
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil || math.IsNaN(number) || math.IsInf(number, 0) {
+			return "", &ArgError{Arg: spec.String(), Value: value, Reason: reasonNotNumber}
+		}
+	case ArgInteger:
+		if _, err := strconv.ParseInt(strings.TrimPrefix(value, "#"), 10, 32); err != nil {
+			return "", &ArgError{Arg: spec.String(), Value: value, Reason: reasonNotInteger}
+		}
+		return strings.TrimPrefix(value, "#"), nil
+	case ArgAlertRef:
+		if _, _, err := parseAlertRef(value); err != nil {
+			return "", &ArgError{Arg: spec.String(), Value: value, Reason: reasonNotAlertRef}
+		}
+		return strings.TrimPrefix(value, "#"), nil
+	}
+	return value, nil
+}
+
+// validateArgs checks args against specs and returns them normalized: symbols
+// lowercased, alert numbers without a leading # and a trailing ArgText taken
+// from rest, the text as typed, or joined into a single argument without it.
+func validateArgs(specs []ArgSpec, args, rest []string) ([]string, error) {
+	var normalized []string
+	for i, spec := range specs {
+		if i >= len(args) {
+			if spec.Optional {
+				break
+			}
+			return nil, &ArgError{Arg: spec.String(), Reason: reasonMissing}
+		}
+		value := args[i]
+		if spec.Type == ArgText {
+			value = strings.Join(args[i:], " ")
+			if i < len(rest) {
+				value = rest[i]
+			}
+		}
+		value, err := normalizeArg(spec, value)
+		if err != nil {
+			return nil, err
+		}
+		normalized = append(normalized, value)
+		if spec.Type == ArgText {
+			return normalized, nil
+		}
+	}
+	if len(args) > len(specs) {
+		return nil, &ArgError{Arg: "argument", Value: args[len(specs)], Reason: reasonUnexpected}
+	}
+	return normalized, nil
+}
+
+// validateFlags checks flags against specs and normalizes their values.
+func validateFlags(specs []ArgSpec, flags map[string]string) (map[string]string, error) {
+	normalized := make(map[string]string)
+	for key, value := range flags {
+		var spec *ArgSpec
+		for i := range specs {
+			if specs[i].Name == key {
+				spec = &specs[i]
+				break
+			}
+		}
+		if spec == nil {
+			return nil, &ArgError{Arg: "--" + key, Reason: reasonUnknownOption}
+		}
+		value, err := normalizeArg(ArgSpec{Name: "--" + key, Type: spec.Type, Optional: true}, value)
+		if err != nil {
+			return nil, err
+		}
+		normalized[key] = value
+	}
+	return normalized, nil
+}
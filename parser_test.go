@@ -0,0 +1,121 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		text  string
+		want  ParsedCommand
+		isErr bool
+	}{
+		{
+			text: "/createalert EURUSD 1.1 Breakout Retest",
+			want: ParsedCommand{Name: "createalert", Args: []string{"EURUSD", "1.1", "Breakout", "Retest"}, Rest: []string{"EURUSD 1.1 Breakout Retest", "1.1 Breakout Retest", "Breakout Retest", "Retest"}, Flags: map[string]string{}},
+		},
+		{
+			text: "/CreateAlert@OurBot  eurusd   1.1",
+			want: ParsedCommand{Name: "createalert", Mention: "OurBot", Args: []string{"eurusd", "1.1"}, Rest: []string{"eurusd   1.1", "1.1"}, Flags: map[string]string{}},
+		},
+		{
+			text: `/createalert eurusd 1.1 "Breakout  Retest" --note="it's here" --urgent`,
+			want: ParsedCommand{Name: "createalert", Args: []string{"eurusd", "1.1", "Breakout  Retest"}, Rest: []string{"eurusd 1.1 Breakout  Retest", "1.1 Breakout  Retest", "Breakout  Retest"}, Flags: map[string]string{"note": "it's here", "urgent": "true"}},
+		},
+		{
+			text: `/createalert eurusd 1.1 -- --not-a-flag 'single \' quoted'`,
+			want: ParsedCommand{Name: "createalert", Args: []string{"eurusd", "1.1", "--not-a-flag", "single ' quoted"}, Rest: []string{"eurusd 1.1 --not-a-flag single ' quoted", "1.1 --not-a-flag single ' quoted", "--not-a-flag single ' quoted", "single ' quoted"}, Flags: map[string]string{}},
+		},
+		{
+			// apostrophes inside words are not quotes and line breaks are kept
+			text: "/createalert eurusd 1.1 don't  miss\nthe 'retest'",
+			want: ParsedCommand{Name: "createalert", Args: []string{"eurusd", "1.1", "don't", "miss", "the", "retest"}, Rest: []string{"eurusd 1.1 don't  miss\nthe retest", "1.1 don't  miss\nthe retest", "don't  miss\nthe retest", "miss\nthe retest", "the retest", "retest"}, Flags: map[string]string{}},
+		},
+		{
+			// flags inside the text are not part of it
+			text: "/createalert eurusd 1.1 breakout --urgent retest",
+			want: ParsedCommand{Name: "createalert", Args: []string{"eurusd", "1.1", "breakout", "retest"}, Rest: []string{"eurusd 1.1 breakout retest", "1.1 breakout retest", "breakout retest", "retest"}, Flags: map[string]string{"urgent": "true"}},
+		},
+		{
+			// quotes are never part of the text, wherever the quoted words are
+			text: `/createalert eurusd 1.1 "my note"`,
+			want: ParsedCommand{Name: "createalert", Args: []string{"eurusd", "1.1", "my note"}, Rest: []string{"eurusd 1.1 my note", "1.1 my note", "my note"}, Flags: map[string]string{}},
+		},
+		{
+			text: `/createalert eurusd 1.1 "my note"  more`,
+			want: ParsedCommand{Name: "createalert", Args: []string{"eurusd", "1.1", "my note", "more"}, Rest: []string{"eurusd 1.1 my note  more", "1.1 my note  more", "my note  more", "more"}, Flags: map[string]string{}},
+		},
+		{
+			text: `/createalert eurusd 1.1 "my note" --urgent more`,
+			want: ParsedCommand{Name: "createalert", Args: []string{"eurusd", "1.1", "my note", "more"}, Rest: []string{"eurusd 1.1 my note more", "1.1 my note more", "my note more", "more"}, Flags: map[string]string{"urgent": "true"}},
+		},
+		{
+			text:  `/createalert eurusd "1.1`,
+			isErr: true,
+		},
+	}
+	for _, tt := range tests {
+		got, err := ParseCommand(tt.text)
+		if tt.isErr {
+			if err == nil {
+				t.Errorf("ParseCommand(%q) expected an error", tt.text)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseCommand(%q) unexpected error: %s", tt.text, err)
+			continue
+		}
+		if !reflect.DeepEqual(*got, tt.want) {
+			t.Errorf("ParseCommand(%q) = %+v, want %+v", tt.text, *got, tt.want)
+		}
+	}
+}
+
+func TestValidateArgs(t *testing.T) {
+	specs := commandByName["createalert"].Args
+	tests := []struct {
+		args  []string
+		rest  []string
+		want  []string
+		isErr bool
+	}{
+		{args: []string{"EURUSD", "1.1"}, want: []string{"eurusd", "1.1"}},
+		{args: []string{"EURUSD", "1.1", "Breakout", "Retest"}, rest: []string{"", "", "Breakout\n  Retest", "Retest"}, want: []string{"eurusd", "1.1", "Breakout\n  Retest"}},
+		{args: []string{"EURUSD", "1.1", "Breakout", "Retest"}, want: []string{"eurusd", "1.1", "Breakout Retest"}},
+		{args: []string{"EURUSD"}, isErr: true},
+		{args: []string{"EURUSD", "abc"}, isErr: true},
+		{args: []string{"EURUSD", "NaN"}, isErr: true},
+	}
+	for _, tt := range tests {
+		got, err := validateArgs(specs, tt.args, tt.rest)
+		if tt.isErr {
+			if err == nil {
+				t.Errorf("validateArgs(%q) expected an error", tt.args)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("validateArgs(%q) = %q, %v, want %q", tt.args, got, err, tt.want)
+		}
+	}
+}
+
+func FuzzParseCommand(f *testing.F) {
+	f.Add("/createalert eurusd 1.1 description")
+	f.Add(`/createalert@OurBot "eur usd" '1.1' --note="a \"b\"" -- --x`)
+	f.Add("/viewalerts\t\n  ")
+	f.Add("/")
+	f.Add(`\`)
+	f.Fuzz(func(t *testing.T, text string) {
+		parsed, err := ParseCommand(text)
+		if err != nil {
+			return
+		}
+		for _, cmd := range commands {
+			validateArgs(cmd.Args, parsed.Args, parsed.Rest)
+			validateFlags(cmd.Flags, parsed.Flags)
+		}
+	})
+}
@@ -0,0 +1,422 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxPositions is the number of positions a user may record.
+const maxPositions = 50
+
+// Position is a trade a user holds on a symbol, one per symbol. P&L is in
+// the quote currency of the symbol.
+type Position struct {
+	UserId int64   `json:"user_id"`
+	Symbol string  `json:"symbol"`
+	Short  bool    `json:"short"`
+	Size   float64 `json:"size"`
+	Entry  float64 `json:"entry"`
+	// Stop is the stop loss the risk of the position, 1R, is measured to,
+	// 0 without one
+	Stop      float64   `json:"stop"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func GetCreatePositionsTable() string {
+	return `CREATE TABLE IF NOT EXISTS positions (
+		user_id INTEGER NOT NULL,
+		symbol TEXT NOT NULL,
+		short BOOLEAN NOT NULL DEFAULT FALSE,
+		size REAL NOT NULL,
+		entry REAL NOT NULL,
+		stop REAL NOT NULL DEFAULT 0,
+		created_at TIMESTAMP NOT NULL,
+		updated_at TIMESTAMP NOT NULL,
+		PRIMARY KEY (user_id, symbol),
+		FOREIGN KEY (user_id) REFERENCES users (user_id)
+	);`
+}
+
+// side is long or short, as /position takes it.
+func (p *Position) side() string {
+	if p.Short {
+		return "short"
+	}
+	return "long"
+}
+
+// pnl is the unrealized profit or loss of the position at a price.
+func (p *Position) pnl(price float64) float64 {
+	if p.Short {
+		return (p.Entry - price) * p.Size
+	}
+	return (price - p.Entry) * p.Size
+}
+
+// risk is what the position loses at its stop, 0 without one.
+func (p *Position) risk() float64 {
+	if p.Stop == 0 {
+		return 0
+	}
+	return math.Abs(p.Entry-p.Stop) * p.Size
+}
+
+// PnL is the target of a P&L alert: an amount of money, or of R, the risk of
+// the position, when R is set. Losses are negative and trigger at or below
+// the amount, profits at or above it.
+type PnL struct {
+	Amount float64 `json:"amount"`
+	R      bool    `json:"r"`
+	// Short is the side of the position the target was set for
+	Short bool `json:"short"`
+}
+
+var (
+	errInvalidPnL     = errors.New("invalid P&L target")
+	errNoStop         = errors.New("position without a stop")
+	errPnLReached     = errors.New("P&L target already reached")
+	errPnLUnreachable = errors.New("P&L target at a price of zero or below")
+)
+
+// parsePnL reads a P&L target such as -500, +1000 or 2R.
+func parsePnL(s string) (PnL, error) {
+	var pnl PnL
+	if rest, found := strings.CutSuffix(strings.ToUpper(s), "R"); found {
+		pnl.R = true
+		s = rest
+	}
+	amount, err := strconv.ParseFloat(s, 64)
+	if err != nil || amount == 0 || math.IsInf(amount, 0) || math.IsNaN(amount) {
+		return pnl, errInvalidPnL
+	}
+	pnl.Amount = amount
+	return pnl, nil
+}
+
+// String renders the target in the syntax parsePnL reads.
+func (p PnL) String() string {
+	s := strconv.FormatFloat(p.Amount, 'f', -1, 64)
+	if p.Amount > 0 {
+		s = "+" + s
+	}
+	if p.R {
+		s += "R"
+	}
+	return s
+}
+
+// money returns the amount of money the target is at for a position.
+func (p PnL) money(position *Position) (float64, error) {
+	if !p.R {
+		return p.Amount, nil
+	}
+	if position.risk() == 0 {
+		return 0, errNoStop
+	}
+	return p.Amount * position.risk(), nil
+}
+
+// price returns the price the position makes the P&L of the target at.
+func (p PnL) price(position *Position) (float64, error) {
+	money, err := p.money(position)
+	if err != nil {
+		return 0, err
+	}
+	if position.Short {
+		return position.Entry - money/position.Size, nil
+	}
+	return position.Entry + money/position.Size, nil
+}
+
+// pnlReached reports whether the P&L reached the target since the alert
+// started watching: profits of longs and losses of shorts are made as the
+// price rises, so they need a high at or above the target price, the others
+// a low at or below it.
+func (a *Alert) pnlReached(tolerance float64) bool {
+	if (a.PnL.Amount > 0) != a.PnL.Short {
+		return a.HighPrice >= a.TargetPrice-tolerance
+	}
+	return a.LowPrice <= a.TargetPrice+tolerance
+}
+
+// NewPnLAlert creates an alert on the P&L of a position, watched from
+// livePrice.
+func NewPnLAlert(userId, chatId int64, position *Position, description string, pnl PnL, livePrice float64) (*Alert, error) {
+	pnl.Short = position.Short
+	target, err := pnl.price(position)
+	if err != nil {
+		return nil, err
+	}
+	alert := NewAlert(userId, chatId, position.Symbol, description, target, livePrice)
+	alert.Kind = AlertPnL
+	alert.PnL = pnl
+	return alert, nil
+}
+
+// newPnLAlertAt creates a P&L alert watched from the live price of t, for a
+// target the position is not at yet and the price of t can reach.
+func newPnLAlertAt(userId, chatId int64, position *Position, description string, pnl PnL, t *Ticker) (*Alert, error) {
+	money, err := pnl.money(position)
+	if err != nil {
+		return nil, err
+	}
+	if now := position.pnl(t.LivePrice); pnl.Amount > 0 && now >= money || pnl.Amount < 0 && now <= money {
+		return nil, errPnLReached
+	}
+	alert, err := NewPnLAlert(userId, chatId, position, description, pnl, t.LivePrice)
+	if err != nil {
+		return nil, err
+	}
+	if alert.TargetPrice <= 0 && t.Category != "synthetic" {
+		return nil, errPnLUnreachable
+	}
+	return alert, nil
+}
+
+// pnlString renders a P&L amount in the quote currency of a symbol, with R
+// when the position has a stop.
+func pnlString(position *Position, price float64, meta SymbolMeta) string {
+	pnl := position.pnl(price)
+	s := strings.TrimSpace(fmt.Sprintf("%+.2f %s", pnl, meta.QuoteCurrency))
+	if risk := position.risk(); risk > 0 {
+		s += fmt.Sprintf(" (%+.2fR)", pnl/risk)
+	}
+	return s
+}
+
+// pnlTriggeredText is the notification of a P&L alert, or "" when its
+// position is gone.
+func (b *TelegramBot) pnlTriggeredText(alert *Alert, t *Ticker, prefs *Preferences, lang string) string {
+	position, err := b.store.GetPosition(alert.UserId, alert.Symbol)
+	if err != nil {
+		return ""
+	}
+	return T(lang, "pnl.triggered", "position", positionLabel(position, prefs), "price", prefs.FormatPrice(alert.Symbol, t.LivePrice), "pnl", pnlString(position, t.LivePrice, t.Meta), "target", alert.PnL.String(), "description", html.EscapeString(alert.Description))
+}
+
+// positionLabel names a position as BTC long 0.5 @ 60000.
+func positionLabel(p *Position, prefs *Preferences) string {
+	return fmt.Sprintf("%s %s %s @ %s", strings.ToUpper(p.Symbol), p.side(), strconv.FormatFloat(p.Size, 'f', -1, 64), prefs.FormatPrice(p.Symbol, p.Entry))
+}
+
+// parsePrice reads a finite price, which may only be negative or zero for
+// the spreads of synthetic tickers.
+func parsePrice(s string, t *Ticker) (float64, bool) {
+	price, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsInf(price, 0) || math.IsNaN(price) || (price <= 0 && t.Category != "synthetic") {
+		return 0, false
+	}
+	return price, true
+}
+
+// recordPosition handles `/position <symbol> <long|short> <size> <entry>
+// [--stop=<price>]`. Recording a symbol again replaces its position and
+// moves the targets of its P&L alerts along.
+func (b *TelegramBot) recordPosition(c *CommandContext) error {
+	t, exist := getTicker(c.Args[0])
+	if !exist {
+		return b.sendMessage(c.ChatId, c.T("symbol.not_found"))
+	}
+	if c.Args[1] != "long" && c.Args[1] != "short" {
+		return b.sendUsage(c)
+	}
+	position := &Position{UserId: c.UserId, Symbol: t.Symbol, Short: c.Args[1] == "short", CreatedAt: time.Now().UTC()}
+	size, err := strconv.ParseFloat(c.Args[2], 64)
+	if err != nil || !(size > 0) || math.IsInf(size, 0) {
+		return b.sendMessage(c.ChatId, c.T("position.invalid_size"))
+	}
+	entry, ok := parsePrice(c.Args[3], t)
+	if !ok {
+		return b.sendMessage(c.ChatId, c.T("position.invalid_entry"))
+	}
+	position.Size, position.Entry = size, entry
+
+	existing, err := b.store.GetPosition(c.UserId, t.Symbol)
+	if err == nil {
+		position.CreatedAt, position.Stop = existing.CreatedAt, existing.Stop
+	} else {
+		positions, err := b.store.GetPositionsByUserId(c.UserId)
+		if err != nil {
+			return err
+		}
+		if len(positions) >= maxPositions {
+			return b.sendMessage(c.ChatId, c.T("position.limit", "max", maxPositions))
+		}
+	}
+	if value, exist := c.Flags["stop"]; exist {
+		position.Stop = 0
+		if value != "off" {
+			if position.Stop, ok = parsePrice(value, t); !ok {
+				return b.sendMessage(c.ChatId, c.T("position.invalid_stop"))
+			}
+		}
+	}
+	// the stop, also one kept from before, sits on the losing side of the entry
+	if position.Stop != 0 && (position.Stop == entry || (position.Stop > entry) != position.Short) {
+		return b.sendMessage(c.ChatId, c.T("position.invalid_stop"))
+	}
+
+	alerts, err := b.pnlAlerts(c.UserId, t.Symbol)
+	if err != nil {
+		return err
+	}
+	for _, alert := range alerts {
+		if _, err := alert.PnL.money(position); err != nil {
+			return b.sendMessage(c.ChatId, c.T("position.stop_needed", "number", alert.Number))
+		}
+	}
+	position.UpdatedAt = time.Now().UTC()
+	if err := b.store.SetPosition(position); err != nil {
+		return err
+	}
+	for _, alert := range alerts {
+		alert.PnL.Short = position.Short
+		target, _ := alert.PnL.price(position)
+		alert.SetTarget(target, t.LivePrice)
+		alert.UpdatedAt = time.Now().UTC()
+		if err := b.store.UpdateAlert(alert); err != nil {
+			log.Println("Error updating alert", err)
+		}
+	}
+	prefs := b.preferences(c.UserId)
+	return b.sendMessage(c.ChatId, c.T("position.recorded", "position", positionLabel(position, prefs), "pnl", pnlString(position, t.LivePrice, t.Meta)))
+}
+
+// pnlAlerts returns the P&L alerts of a user on the position of a symbol.
+func (b *TelegramBot) pnlAlerts(userId int64, symbol string) ([]*Alert, error) {
+	alerts, err := b.store.GetAlertsByUserId(userId)
+	if err != nil {
+		return nil, err
+	}
+	var pnlAlerts []*Alert
+	for i := range alerts {
+		if alerts[i].Kind == AlertPnL && alerts[i].Symbol == symbol {
+			pnlAlerts = append(pnlAlerts, &alerts[i])
+		}
+	}
+	return pnlAlerts, nil
+}
+
+// closePosition handles `/closeposition <symbol>`, which deletes the
+// position and its P&L alerts.
+func (b *TelegramBot) closePosition(c *CommandContext) error {
+	t, exist := getTicker(c.Args[0])
+	symbol := c.Args[0]
+	if exist {
+		symbol = t.Symbol
+	}
+	if _, err := b.store.GetPosition(c.UserId, symbol); err != nil {
+		return b.sendMessage(c.ChatId, c.T("position.not_found", "symbol", strings.ToUpper(symbol)))
+	}
+	alerts, err := b.pnlAlerts(c.UserId, symbol)
+	if err != nil {
+		return err
+	}
+	for _, alert := range alerts {
+		if err := b.store.DeleteAlert(alert.Id); err != nil {
+			return err
+		}
+	}
+	if err := b.store.DeletePosition(c.UserId, symbol); err != nil {
+		return err
+	}
+	return b.sendMessage(c.ChatId, c.T("position.closed", "symbol", strings.ToUpper(symbol), "alerts", len(alerts)))
+}
+
+// viewPositions handles /positions: the unrealized P&L of every position at
+// the live price, and the total per currency.
+func (b *TelegramBot) viewPositions(c *CommandContext) error {
+	positions, err := b.store.GetPositionsByUserId(c.UserId)
+	if err != nil {
+		return err
+	}
+	if len(positions) == 0 {
+		return b.sendMessage(c.ChatId, c.T("position.none"))
+	}
+	prefs := b.preferences(c.UserId)
+	totals := make(map[string]float64)
+	var blocks []string
+	for i := range positions {
+		p := &positions[i]
+		lines := []string{positionLabel(p, prefs)}
+		if p.Stop != 0 {
+			lines[0] += " " + c.T("position.card_stop", "stop", prefs.FormatPrice(p.Symbol, p.Stop))
+		}
+		t, exist := getTicker(p.Symbol)
+		if !exist {
+			lines = append(lines, c.T("position.card_no_price"))
+		} else {
+			lines = append(lines, c.T("position.card_pnl", "price", prefs.FormatPrice(p.Symbol, t.LivePrice), "pnl", pnlString(p, t.LivePrice, t.Meta)))
+			totals[t.Meta.QuoteCurrency] += p.pnl(t.LivePrice)
+		}
+		blocks = append(blocks, strings.Join(lines, "\n"))
+	}
+	currencies := make([]string, 0, len(totals))
+	for currency := range totals {
+		currencies = append(currencies, currency)
+	}
+	sort.Strings(currencies)
+	var total []string
+	for _, currency := range currencies {
+		total = append(total, strings.TrimSpace(fmt.Sprintf("%+.2f %s", totals[currency], currency)))
+	}
+	if len(total) > 0 {
+		blocks = append(blocks, c.T("position.total", "pnl", strings.Join(total, ", ")))
+	}
+	return b.sendMessageInChunks(c.ChatId, strings.Join(blocks, "\n\n"))
+}
+
+// createPnLAlert handles `/pnlalert <symbol> <amount|nR> [description]`.
+func (b *TelegramBot) createPnLAlert(c *CommandContext) error {
+	alertChatId, err := b.alertChat(c, true)
+	if alertChatId == 0 {
+		return err
+	}
+	t, exist := getTicker(c.Args[0])
+	if !exist {
+		return b.sendMessage(c.ChatId, c.T("symbol.not_found"))
+	}
+	position, err := b.store.GetPosition(c.UserId, t.Symbol)
+	if err != nil {
+		return b.sendMessage(c.ChatId, c.T("position.not_found", "symbol", strings.ToUpper(t.Symbol)))
+	}
+	if ok, err := b.checkAlertQuota(c, t.Symbol); !ok {
+		return err
+	}
+	pnl, err := parsePnL(c.Args[1])
+	if err != nil {
+		return b.sendMessage(c.ChatId, c.T("pnl.invalid"))
+	}
+	description := c.Flags["note"]
+	if len(c.Args) > 2 {
+		description = c.Args[2]
+	}
+	alert, err := newPnLAlertAt(c.UserId, alertChatId, position, description, pnl, t)
+	switch err {
+	case nil:
+	case errNoStop:
+		return b.sendMessage(c.ChatId, c.T("pnl.no_stop", "symbol", strings.ToUpper(t.Symbol)))
+	case errPnLReached:
+		return b.sendMessage(c.ChatId, c.T("pnl.reached", "pnl", pnlString(position, t.LivePrice, t.Meta)))
+	case errPnLUnreachable:
+		return b.sendMessage(c.ChatId, c.T("pnl.unreachable"))
+	default:
+		return err
+	}
+	alert.Urgent = c.Flags["urgent"] == "true"
+	if ok, err := b.setValidity(c, alert); !ok {
+		return err
+	}
+	if err := b.store.CreateAlert(alert); err != nil {
+		return b.sendMessage(c.ChatId, c.T("alert.store_failed"))
+	}
+	return b.sendMessage(c.ChatId, c.T("pnl.created", "number", alert.Number, "target", pnl.String(), "price", t.Meta.Format(alert.TargetPrice)))
+}
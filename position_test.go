@@ -0,0 +1,116 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParsePnL(t *testing.T) {
+	tests := []struct {
+		text  string
+		want  PnL
+		isErr bool
+	}{
+		{text: "-500", want: PnL{Amount: -500}},
+		{text: "+1000", want: PnL{Amount: 1000}},
+		{text: "2r", want: PnL{Amount: 2, R: true}},
+		{text: "-1.5R", want: PnL{Amount: -1.5, R: true}},
+		{text: "0", isErr: true},
+		{text: "R", isErr: true},
+		{text: "500usd", isErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parsePnL(tt.text)
+		if tt.isErr {
+			if err == nil {
+				t.Errorf("parsePnL(%q) expected an error", tt.text)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("parsePnL(%q) = %+v, %v, want %+v", tt.text, got, err, tt.want)
+			continue
+		}
+		// String renders what parsePnL reads
+		if again, err := parsePnL(got.String()); err != nil || again != got {
+			t.Errorf("parsePnL(%q) = %+v, %v, want %+v", got.String(), again, err, got)
+		}
+	}
+}
+
+func TestPnLAlert(t *testing.T) {
+	long := &Position{Symbol: "btc", Size: 0.5, Entry: 60000, Stop: 58000}
+	short := &Position{Symbol: "btc", Short: true, Size: 0.5, Entry: 60000}
+	tests := []struct {
+		name     string
+		position *Position
+		pnl      string
+		target   float64
+		prices   []float64
+		want     bool
+	}{
+		{name: "long loss", position: long, pnl: "-500", target: 59000, prices: []float64{59500, 58990}, want: true},
+		{name: "long loss not reached", position: long, pnl: "-500", target: 59000, prices: []float64{59500, 61000}},
+		{name: "long profit in R", position: long, pnl: "+2R", target: 64000, prices: []float64{62000, 64000}, want: true},
+		{name: "short loss", position: short, pnl: "-500", target: 61000, prices: []float64{61000}, want: true},
+		{name: "short profit not reached", position: short, pnl: "+500", target: 59000, prices: []float64{61000, 59100}},
+	}
+	for _, tt := range tests {
+		pnl, _ := parsePnL(tt.pnl)
+		alert, err := NewPnLAlert(1, 1, tt.position, "", pnl, 60000)
+		if err != nil || alert.TargetPrice != tt.target {
+			t.Errorf("%s: target %g, %v, want %g", tt.name, alert.TargetPrice, err, tt.target)
+			continue
+		}
+		ticker := &Ticker{Meta: SymbolMeta{TickSize: 0.01}, LivePrice: 60000, UpdatedAt: alert.WatchedSince}
+		var triggered bool
+		for i, price := range tt.prices {
+			ticker.PrevPrice, ticker.PrevUpdatedAt = ticker.LivePrice, ticker.UpdatedAt
+			ticker.RangeHigh, ticker.RangeLow = max(ticker.PrevPrice, price), min(ticker.PrevPrice, price)
+			ticker.LivePrice, ticker.UpdatedAt = price, alert.WatchedSince.Add(time.Duration(i+1)*time.Minute)
+			alert.observe(ticker)
+			triggered = alert.triggered(ticker)
+		}
+		if triggered != tt.want {
+			t.Errorf("%s: triggered %t, want %t", tt.name, triggered, tt.want)
+		}
+	}
+
+	// targets in R need a stop
+	if _, err := NewPnLAlert(1, 1, short, "", PnL{Amount: 1, R: true}, 60000); err != errNoStop {
+		t.Errorf("R target without a stop: %v", err)
+	}
+}
+
+func TestNewPnLAlertAt(t *testing.T) {
+	long := &Position{Symbol: "btc", Size: 0.5, Entry: 60000, Stop: 58000}
+	tests := []struct {
+		pnl  PnL
+		live float64
+		want error
+	}{
+		{pnl: PnL{Amount: -500}, live: 60000},
+		{pnl: PnL{Amount: -500}, live: 58500, want: errPnLReached},
+		{pnl: PnL{Amount: 2, R: true}, live: 64500, want: errPnLReached},
+		// a loss of 40000 is a price below zero
+		{pnl: PnL{Amount: -40000}, live: 60000, want: errPnLUnreachable},
+	}
+	for _, tt := range tests {
+		ticker := &Ticker{Symbol: "btc", Category: "crypto", LivePrice: tt.live}
+		if _, err := newPnLAlertAt(1, 1, long, "", tt.pnl, ticker); err != tt.want {
+			t.Errorf("newPnLAlertAt(%s) at %g = %v, want %v", tt.pnl, tt.live, err, tt.want)
+		}
+	}
+}
+
+func TestPnLString(t *testing.T) {
+	meta := SymbolMeta{QuoteCurrency: "USD"}
+	long := &Position{Size: 0.5, Entry: 60000, Stop: 58000}
+	if got, want := pnlString(long, 59000, meta), "-500.00 USD (-0.50R)"; got != want {
+		t.Errorf("pnlString = %q, want %q", got, want)
+	}
+	short := &Position{Short: true, Size: 2, Entry: 1.1}
+	if got, want := pnlString(short, 1.05, meta), "+0.10 USD"; got != want {
+		t.Errorf("pnlString = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,408 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+	// timezones must resolve on hosts without a zoneinfo database
+	_ "time/tzdata"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	settingsCallbackPrefix = "settings:"
+
+	// PrecisionAuto picks the number of decimals from the price of the symbol
+	PrecisionAuto = -1
+	maxPrecision  = 8
+
+	CardVerbose = "verbose"
+	CardCompact = "compact"
+)
+
+// supportedLanguages lists the languages users can choose, the empty
+// language follows the Telegram client.
+func supportedLanguages() []string {
+	return append([]string{""}, languages()...)
+}
+
+type Preferences struct {
+	UserId    int64  `json:"user_id"`
+	Timezone  string `json:"timezone"`
+	Language  string `json:"language"`
+	Precision int    `json:"precision"`
+	Cards     string `json:"cards"`
+	// QuietStart and QuietEnd are HH:MM in the timezone of the user, empty
+	// when quiet hours are off
+	QuietStart string `json:"quiet_start,omitempty"`
+	QuietEnd   string `json:"quiet_end,omitempty"`
+	// Gaps notifies the user of alerts re-armed because the market opened
+	// beyond their target
+	Gaps bool `json:"gaps"`
+}
+
+func GetCreatePreferencesTable() string {
+	return `CREATE TABLE IF NOT EXISTS preferences (
+		user_id INTEGER PRIMARY KEY,
+		timezone TEXT NOT NULL DEFAULT 'UTC',
+		language TEXT NOT NULL DEFAULT '',
+		precision INTEGER NOT NULL DEFAULT -1,
+		cards TEXT NOT NULL DEFAULT 'verbose',
+		quiet_start TEXT NOT NULL DEFAULT '',
+		quiet_end TEXT NOT NULL DEFAULT '',
+		gaps BOOLEAN NOT NULL DEFAULT FALSE,
+		FOREIGN KEY (user_id) REFERENCES users (user_id)
+	);`
+}
+
+func DefaultPreferences(userId int64) *Preferences {
+	return &Preferences{
+		UserId:    userId,
+		Timezone:  "UTC",
+		Precision: PrecisionAuto,
+		Cards:     CardVerbose,
+	}
+}
+
+func (p *Preferences) Location() *time.Location {
+	loc, err := time.LoadLocation(p.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+func (p *Preferences) FormatTime(t time.Time) string {
+	return t.In(p.Location()).Format("2006-01-02 15:04 MST")
+}
+
+// Decimals returns the number of decimals prices of a symbol are shown with.
+func (p *Preferences) Decimals(symbol string) int {
+	if p.Precision != PrecisionAuto {
+		return p.Precision
+	}
+	if t, exist := getTicker(symbol); exist {
+		return t.Meta.Decimals
+	}
+	return 5
+}
+
+func (p *Preferences) FormatPrice(symbol string, price float64) string {
+	return strconv.FormatFloat(price, 'f', p.Decimals(symbol), 64)
+}
+
+func (p *Preferences) PrecisionString() string {
+	if p.Precision == PrecisionAuto {
+		return "auto"
+	}
+	return strconv.Itoa(p.Precision)
+}
+
+func (p *Preferences) LanguageString() string {
+	if p.Language == "" {
+		return "auto"
+	}
+	return p.Language
+}
+
+func (p *Preferences) GapsString() string {
+	if p.Gaps {
+		return "on"
+	}
+	return "off"
+}
+
+func (p *Preferences) QuietHoursString() string {
+	if p.QuietStart == "" {
+		return "off"
+	}
+	return p.QuietStart + "-" + p.QuietEnd
+}
+
+// parseClock parses HH:MM into minutes after midnight.
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a time like 22:00", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// InQuietHours reports whether now falls in the quiet hours of the user; the
+// window may span midnight.
+func (p *Preferences) InQuietHours(now time.Time) bool {
+	if p.QuietStart == "" {
+		return false
+	}
+	start, err := parseClock(p.QuietStart)
+	if err != nil {
+		return false
+	}
+	end, err := parseClock(p.QuietEnd)
+	if err != nil {
+		return false
+	}
+	local := now.In(p.Location())
+	minute := local.Hour()*60 + local.Minute()
+	if start <= end {
+		return minute >= start && minute < end
+	}
+	return minute >= start || minute < end
+}
+
+func (p *Preferences) toTelegramString(lang string) string {
+	return T(lang, "settings.card", "timezone", p.Timezone, "language", p.LanguageString(), "precision", p.PrecisionString(), "cards", p.Cards, "quiet", p.QuietHoursString(), "gaps", p.GapsString())
+}
+
+// preferences returns the preferences of a user, or the defaults for users
+// who never changed them.
+func (b *TelegramBot) preferences(userId int64) *Preferences {
+	prefs, err := b.store.GetPreferences(userId)
+	if err != nil {
+		return DefaultPreferences(userId)
+	}
+	return prefs
+}
+
+func settingsMarkup(p *Preferences, lang string) tgbotapi.InlineKeyboardMarkup {
+	data := func(action string) string {
+		return fmt.Sprintf("%s%s:%d", settingsCallbackPrefix, action, p.UserId)
+	}
+	rows := [][]tgbotapi.InlineKeyboardButton{
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(T(lang, "settings.button_cards", "value", p.Cards), data("cards")),
+			tgbotapi.NewInlineKeyboardButtonData(T(lang, "settings.button_precision", "value", p.PrecisionString()), data("precision")),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(T(lang, "settings.button_language", "value", p.LanguageString()), data("language")),
+			tgbotapi.NewInlineKeyboardButtonData(T(lang, "settings.button_gaps", "value", p.GapsString()), data("gaps")),
+		),
+	}
+	if p.QuietStart != "" {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(T(lang, "settings.button_quiet_off"), data("quiet")),
+		))
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+// setPreference applies one /settings change and returns an error message
+// for the user when the value is invalid.
+func setPreference(p *Preferences, name, value, lang string) string {
+	switch name {
+	case "timezone", "tz":
+		loc, err := time.LoadLocation(value)
+		if err != nil || value == "" || value == "Local" {
+			return T(lang, "settings.invalid_timezone")
+		}
+		p.Timezone = loc.String()
+	case "language", "lang":
+		value = strings.ToLower(value)
+		if value == "auto" {
+			value = ""
+		}
+		for _, supported := range supportedLanguages() {
+			if supported == value {
+				p.Language = value
+				return ""
+			}
+		}
+		return T(lang, "settings.invalid_language", "languages", strings.Join(languages(), ", "))
+	case "precision":
+		if value == "auto" {
+			p.Precision = PrecisionAuto
+			return ""
+		}
+		precision, err := strconv.Atoi(value)
+		if err != nil || precision < 0 || precision > maxPrecision {
+			return T(lang, "settings.invalid_precision", "max", maxPrecision)
+		}
+		p.Precision = precision
+	case "cards":
+		if value != CardCompact && value != CardVerbose {
+			return T(lang, "settings.invalid_cards")
+		}
+		p.Cards = value
+	case "quiet":
+		if value == "off" {
+			p.QuietStart, p.QuietEnd = "", ""
+			return ""
+		}
+		start, end, found := strings.Cut(value, "-")
+		if !found {
+			return T(lang, "settings.invalid_quiet")
+		}
+		for _, clock := range []string{start, end} {
+			if _, err := parseClock(clock); err != nil {
+				return T(lang, "settings.invalid_clock", "value", clock)
+			}
+		}
+		if start == end {
+			return T(lang, "settings.quiet_empty")
+		}
+		p.QuietStart, p.QuietEnd = start, end
+	case "gaps":
+		switch strings.ToLower(value) {
+		case "on":
+			p.Gaps = true
+		case "off":
+			p.Gaps = false
+		default:
+			return T(lang, "settings.invalid_gaps")
+		}
+	default:
+		return T(lang, "settings.unknown")
+	}
+	return ""
+}
+
+func (b *TelegramBot) settings(c *CommandContext) error {
+	prefs := b.preferences(c.UserId)
+	if len(c.Args) == 1 {
+		return b.sendUsage(c)
+	}
+	if len(c.Args) == 2 {
+		if problem := setPreference(prefs, strings.ToLower(c.Args[0]), c.Args[1], c.Lang); problem != "" {
+			return b.sendMessage(c.ChatId, problem)
+		}
+		if err := b.store.SetPreferences(prefs); err != nil {
+			return b.sendMessage(c.ChatId, c.T("settings.store_failed"))
+		}
+	}
+	// the language may just have changed
+	lang := b.language(c.UserId, c.LanguageCode)
+	msg := tgbotapi.NewMessage(c.ChatId, prefs.toTelegramString(lang))
+	msg.ParseMode = tgbotapi.ModeHTML
+	msg.ReplyMarkup = settingsMarkup(prefs, lang)
+	_, err := b.bot.Send(msg)
+	return err
+}
+
+func (b *TelegramBot) handleSettingsButton(query *tgbotapi.CallbackQuery) {
+	action, id, _ := strings.Cut(strings.TrimPrefix(query.Data, settingsCallbackPrefix), ":")
+	userId, _ := strconv.ParseInt(id, 10, 64)
+	if userId != query.From.ID {
+		lang := b.language(query.From.ID, query.From.LanguageCode)
+		b.bot.Send(tgbotapi.NewCallback(query.ID, T(lang, "settings.not_owner")))
+		return
+	}
+
+	prefs := b.preferences(userId)
+	switch action {
+	case "cards":
+		if prefs.Cards == CardCompact {
+			prefs.Cards = CardVerbose
+		} else {
+			prefs.Cards = CardCompact
+		}
+	case "precision":
+		// auto, then 2 to maxPrecision decimals
+		switch {
+		case prefs.Precision == PrecisionAuto:
+			prefs.Precision = 2
+		case prefs.Precision >= maxPrecision:
+			prefs.Precision = PrecisionAuto
+		default:
+			prefs.Precision++
+		}
+	case "language":
+		supported, next := supportedLanguages(), 0
+		for i, lang := range supported {
+			if lang == prefs.Language {
+				next = (i + 1) % len(supported)
+			}
+		}
+		prefs.Language = supported[next]
+	case "quiet":
+		prefs.QuietStart, prefs.QuietEnd = "", ""
+	case "gaps":
+		prefs.Gaps = !prefs.Gaps
+	}
+
+	lang := b.language(userId, query.From.LanguageCode)
+	if err := b.store.SetPreferences(prefs); err != nil {
+		b.bot.Send(tgbotapi.NewCallback(query.ID, T(lang, "settings.store_failed")))
+		return
+	}
+	if prefs.Language != "" {
+		lang = matchLanguage(prefs.Language)
+	}
+	b.bot.Send(tgbotapi.NewCallback(query.ID, ""))
+	msg := tgbotapi.NewEditMessageTextAndMarkup(query.Message.Chat.ID, query.Message.MessageID, prefs.toTelegramString(lang), settingsMarkup(prefs, lang))
+	msg.ParseMode = tgbotapi.ModeHTML
+	b.bot.Send(msg)
+}
+
+// QueuedNotification is a trigger or expiry notice held back during the
+// quiet hours of the user, delivered when they end.
+type QueuedNotification struct {
+	Id        int64
+	AlertId   string
+	ChatId    int64
+	Kind      string
+	Text      string
+	CreatedAt time.Time
+	// Attempts counts the deliveries that failed so far
+	Attempts int
+}
+
+// maxQueuedAttempts is how often a queued notification is sent before it is
+// recorded as failed and dropped.
+const maxQueuedAttempts = 5
+
+func GetCreateQueuedNotificationsTable() string {
+	return `CREATE TABLE IF NOT EXISTS queued_notifications (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		alert_id TEXT NOT NULL,
+		chat_id INTEGER NOT NULL,
+		kind TEXT NOT NULL DEFAULT 'trigger',
+		text TEXT NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		created_at TIMESTAMP NOT NULL
+	);`
+}
+
+// deliverQueuedNotifications sends the notifications queued for users whose quiet
+// hours have ended.
+func (b *TelegramBot) deliverQueuedNotifications(now time.Time) {
+	queued, err := b.store.GetQueuedNotifications()
+	if err != nil {
+		log.Printf("Error retrieving queued notifications: %s", err.Error())
+		return
+	}
+	prefs := make(map[int64]*Preferences)
+	for _, q := range queued {
+		if _, exist := prefs[q.ChatId]; !exist {
+			prefs[q.ChatId] = b.preferences(q.ChatId)
+		}
+		if prefs[q.ChatId].InQuietHours(now) {
+			continue
+		}
+		msg := tgbotapi.NewMessage(q.ChatId, q.Text)
+		msg.ParseMode = tgbotapi.ModeHTML
+		_, err := b.bot.Send(msg)
+		if err != nil {
+			log.Printf("Error sending queued notification to chat %d: %s", q.ChatId, err.Error())
+			if isBlockedError(err) {
+				b.store.SetUserActive(q.ChatId, false)
+			} else if q.Attempts+1 < maxQueuedAttempts {
+				// retried on the next run, recorded once it is delivered or
+				// given up
+				if err := b.store.RetryQueuedNotification(q.Id); err != nil {
+					log.Println("Error updating queued notification", err)
+				}
+				continue
+			}
+		}
+		alert := &Alert{Id: q.AlertId, ChatId: q.ChatId}
+		if err := b.store.CreateNotification(NewNotification(alert, q.Kind, err)); err != nil {
+			log.Println("Error recording notification", err)
+		}
+		if err := b.store.DeleteQueuedNotification(q.Id); err != nil {
+			log.Println("Error deleting queued notification", err)
+		}
+	}
+}
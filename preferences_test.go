@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInQuietHours(t *testing.T) {
+	berlin := mustLoadLocation("Europe/Berlin")
+	tests := []struct {
+		name       string
+		start, end string
+		timezone   string
+		at         time.Time
+		want       bool
+	}{
+		{name: "off", timezone: "UTC", at: time.Date(2024, 5, 6, 23, 0, 0, 0, time.UTC)},
+		{name: "inside", start: "12:00", end: "14:00", timezone: "UTC", at: time.Date(2024, 5, 6, 12, 0, 0, 0, time.UTC), want: true},
+		{name: "end excluded", start: "12:00", end: "14:00", timezone: "UTC", at: time.Date(2024, 5, 6, 14, 0, 0, 0, time.UTC)},
+		{name: "before midnight", start: "22:00", end: "07:00", timezone: "UTC", at: time.Date(2024, 5, 6, 23, 30, 0, 0, time.UTC), want: true},
+		{name: "after midnight", start: "22:00", end: "07:00", timezone: "UTC", at: time.Date(2024, 5, 7, 6, 59, 0, 0, time.UTC), want: true},
+		{name: "morning after", start: "22:00", end: "07:00", timezone: "UTC", at: time.Date(2024, 5, 7, 7, 0, 0, 0, time.UTC)},
+		{name: "afternoon", start: "22:00", end: "07:00", timezone: "UTC", at: time.Date(2024, 5, 7, 15, 0, 0, 0, time.UTC)},
+		// 21:30 UTC is 23:30 in Berlin in summer
+		{name: "timezone of the user", start: "22:00", end: "07:00", timezone: "Europe/Berlin", at: time.Date(2024, 5, 6, 21, 30, 0, 0, time.UTC), want: true},
+		{name: "local time", start: "22:00", end: "07:00", timezone: "Europe/Berlin", at: time.Date(2024, 5, 6, 21, 30, 0, 0, berlin)},
+		{name: "invalid clock", start: "22:00", end: "7", timezone: "UTC", at: time.Date(2024, 5, 6, 23, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		p := &Preferences{Timezone: tt.timezone, QuietStart: tt.start, QuietEnd: tt.end}
+		if got := p.InQuietHours(tt.at); got != tt.want {
+			t.Errorf("%s: InQuietHours(%s) = %v, want %v", tt.name, tt.at, got, tt.want)
+		}
+	}
+}
+
+func TestSetPreference(t *testing.T) {
+	tests := []struct {
+		name, value string
+		want        Preferences
+		isErr       bool
+	}{
+		{name: "timezone", value: "Europe/Berlin", want: Preferences{Timezone: "Europe/Berlin", Precision: PrecisionAuto, Cards: CardVerbose}},
+		{name: "tz", value: "Mars/Olympus", isErr: true},
+		{name: "timezone", value: "Local", isErr: true},
+		{name: "language", value: "DE", want: Preferences{Timezone: "UTC", Language: "de", Precision: PrecisionAuto, Cards: CardVerbose}},
+		{name: "lang", value: "auto", want: Preferences{Timezone: "UTC", Precision: PrecisionAuto, Cards: CardVerbose}},
+		{name: "language", value: "xx", isErr: true},
+		{name: "precision", value: "2", want: Preferences{Timezone: "UTC", Precision: 2, Cards: CardVerbose}},
+		{name: "precision", value: "9", isErr: true},
+		{name: "cards", value: CardCompact, want: Preferences{Timezone: "UTC", Precision: PrecisionAuto, Cards: CardCompact}},
+		{name: "cards", value: "tiny", isErr: true},
+		{name: "quiet", value: "22:00-07:00", want: Preferences{Timezone: "UTC", Precision: PrecisionAuto, Cards: CardVerbose, QuietStart: "22:00", QuietEnd: "07:00"}},
+		{name: "quiet", value: "off", want: Preferences{Timezone: "UTC", Precision: PrecisionAuto, Cards: CardVerbose}},
+		{name: "quiet", value: "22:00", isErr: true},
+		{name: "quiet", value: "22:00-25:00", isErr: true},
+		{name: "quiet", value: "08:00-08:00", isErr: true},
+		{name: "gaps", value: "ON", want: Preferences{Timezone: "UTC", Precision: PrecisionAuto, Cards: CardVerbose, Gaps: true}},
+		{name: "gaps", value: "maybe", isErr: true},
+		{name: "colour", value: "blue", isErr: true},
+	}
+	for _, tt := range tests {
+		p := DefaultPreferences(0)
+		before := *p
+		msg := setPreference(p, tt.name, tt.value, "en")
+		if tt.isErr {
+			if msg == "" || *p != before {
+				t.Errorf("setPreference(%q, %q) = %q, %+v, want an error and no change", tt.name, tt.value, msg, *p)
+			}
+			continue
+		}
+		if msg != "" || *p != tt.want {
+			t.Errorf("setPreference(%q, %q) = %q, %+v, want %+v", tt.name, tt.value, msg, *p, tt.want)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"database/sql"
+	"strconv"
+)
+
+// Unlimited disables a quota.
+const Unlimited = 0
+
+type Quota struct {
+	MaxActiveAlerts    int `json:"max_active_alerts"`
+	MaxAlertsPerSymbol int `json:"max_alerts_per_symbol"`
+	CommandsPerMinute  int `json:"commands_per_minute"`
+}
+
+var roleQuotas = map[Role]Quota{
+	RoleOwner:  {MaxActiveAlerts: Unlimited, MaxAlertsPerSymbol: Unlimited, CommandsPerMinute: Unlimited},
+	RoleAdmin:  {MaxActiveAlerts: 200, MaxAlertsPerSymbol: 50, CommandsPerMinute: 60},
+	RoleTrader: {MaxActiveAlerts: 50, MaxAlertsPerSymbol: 10, CommandsPerMinute: 30},
+	// viewers and banned users cannot create alerts at all
+	RoleViewer: {CommandsPerMinute: 20},
+	RoleBanned: {CommandsPerMinute: 5},
+}
+
+// unregisteredCommandsPerMinute limits users who have not registered yet.
+const unregisteredCommandsPerMinute = 5
+
+// QuotaOverride holds the per user quotas set by admins; nil fields fall
+// back to the quota of the role.
+type QuotaOverride struct {
+	UserId             int64 `json:"user_id"`
+	MaxActiveAlerts    *int  `json:"max_active_alerts,omitempty"`
+	MaxAlertsPerSymbol *int  `json:"max_alerts_per_symbol,omitempty"`
+	CommandsPerMinute  *int  `json:"commands_per_minute,omitempty"`
+}
+
+func GetCreateQuotaOverridesTable() string {
+	return `CREATE TABLE IF NOT EXISTS quota_overrides (
+		user_id INTEGER PRIMARY KEY,
+		max_active_alerts INTEGER,
+		max_alerts_per_symbol INTEGER,
+		commands_per_minute INTEGER,
+		FOREIGN KEY (user_id) REFERENCES users (user_id)
+	);`
+}
+
+// field returns the override field for a quota name as used by /quota.
+func (o *QuotaOverride) field(name string) (**int, bool) {
+	switch name {
+	case "max_active_alerts":
+		return &o.MaxActiveAlerts, true
+	case "max_alerts_per_symbol":
+		return &o.MaxAlertsPerSymbol, true
+	case "commands_per_minute":
+		return &o.CommandsPerMinute, true
+	}
+	return nil, false
+}
+
+func EffectiveQuota(role Role, override *QuotaOverride) Quota {
+	quota := roleQuotas[role]
+	if override == nil {
+		return quota
+	}
+	if override.MaxActiveAlerts != nil {
+		quota.MaxActiveAlerts = *override.MaxActiveAlerts
+	}
+	if override.MaxAlertsPerSymbol != nil {
+		quota.MaxAlertsPerSymbol = *override.MaxAlertsPerSymbol
+	}
+	if override.CommandsPerMinute != nil {
+		quota.CommandsPerMinute = *override.CommandsPerMinute
+	}
+	return quota
+}
+
+func quotaLimitString(limit int, lang string) string {
+	if limit == Unlimited {
+		return T(lang, "quota.unlimited")
+	}
+	return strconv.Itoa(limit)
+}
+
+func (q Quota) toTelegramString(lang string) string {
+	return T(lang, "quota.card", "max_active_alerts", quotaLimitString(q.MaxActiveAlerts, lang),
+		"max_alerts_per_symbol", quotaLimitString(q.MaxAlertsPerSymbol, lang), "commands_per_minute", quotaLimitString(q.CommandsPerMinute, lang))
+}
+
+// userQuota returns the quota of a registered user, including overrides.
+func (b *TelegramBot) userQuota(user *User) (Quota, error) {
+	override, err := b.store.GetQuotaOverride(user.UserId)
+	if err != nil && err != sql.ErrNoRows {
+		return Quota{}, err
+	}
+	return EffectiveQuota(user.Role, override), nil
+}
+
+// allowCommand applies the per user command rate limit, telling the user
+// once when they hit it.
+func (b *TelegramBot) allowCommand(chatId, userId int64, languageCode string) bool {
+	perMinute := unregisteredCommandsPerMinute
+	if user, err := b.store.GetUserByUserId(userId); err == nil {
+		if quota, err := b.userQuota(user); err == nil {
+			perMinute = quota.CommandsPerMinute
+		}
+	}
+	allowed, warn := b.limiter.Allow(userId, perMinute)
+	if warn {
+		b.sendMessage(chatId, T(b.language(userId, languageCode), "quota.rate_limited", "count", perMinute))
+	}
+	return allowed
+}
+
+// checkAlertQuota tells the user and returns false when creating another
+// alert on the symbol would exceed their quota.
+func (b *TelegramBot) checkAlertQuota(c *CommandContext, symbol string) (bool, error) {
+	quota, err := b.userQuota(c.User)
+	if err != nil {
+		return false, err
+	}
+	if quota.MaxActiveAlerts != Unlimited {
+		count, err := b.store.CountActiveAlertsByUserId(c.UserId)
+		if err != nil {
+			return false, err
+		}
+		if count >= quota.MaxActiveAlerts {
+			return false, b.sendMessage(c.ChatId, c.T("quota.max_active", "max", quota.MaxActiveAlerts))
+		}
+	}
+	if quota.MaxAlertsPerSymbol != Unlimited {
+		count, err := b.store.CountActiveAlertsByUserIdAndSymbol(c.UserId, symbol)
+		if err != nil {
+			return false, err
+		}
+		if count >= quota.MaxAlertsPerSymbol {
+			return false, b.sendMessage(c.ChatId, c.T("quota.max_per_symbol", "max", quota.MaxAlertsPerSymbol, "symbol", symbol))
+		}
+	}
+	return true, nil
+}
+
+func (b *TelegramBot) manageQuota(c *CommandContext) error {
+	target, err := b.resolveUser(c.Args[0])
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return b.sendMessage(c.ChatId, c.T("user.not_found"))
+		}
+		return err
+	}
+	if len(c.Args) > 1 && !c.User.Role.Outranks(target.Role) {
+		return b.sendMessage(c.ChatId, c.T("quota.outranked"))
+	}
+
+	override, err := b.store.GetQuotaOverride(target.UserId)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			return err
+		}
+		override = &QuotaOverride{UserId: target.UserId}
+	}
+
+	switch {
+	case len(c.Args) == 1:
+		// only show the quota
+	case c.Args[1] == "reset":
+		if err := b.store.DeleteQuotaOverride(target.UserId); err != nil {
+			return err
+		}
+		override = nil
+	case len(c.Args) == 3:
+		field, ok := override.field(c.Args[1])
+		if !ok {
+			return b.sendUsage(c)
+		}
+		if c.Args[2] == "default" {
+			*field = nil
+		} else {
+			limit, err := strconv.Atoi(c.Args[2])
+			if err != nil || limit < 0 {
+				return b.sendMessage(c.ChatId, c.T("quota.invalid_limit"))
+			}
+			*field = &limit
+		}
+		if err := b.store.SetQuotaOverride(override); err != nil {
+			return err
+		}
+	default:
+		return b.sendUsage(c)
+	}
+
+	return b.sendMessage(c.ChatId, c.T("quota.of_user", "username", target.Username, "role", target.Role)+"\n"+EffectiveQuota(target.Role, override).toTelegramString(c.Lang))
+}
@@ -0,0 +1,44 @@
+package main
+
+import "testing"
+
+func TestEffectiveQuota(t *testing.T) {
+	intPtr := func(n int) *int { return &n }
+	tests := []struct {
+		name     string
+		role     Role
+		override *QuotaOverride
+		want     Quota
+	}{
+		{name: "role quota", role: RoleTrader, want: Quota{MaxActiveAlerts: 50, MaxAlertsPerSymbol: 10, CommandsPerMinute: 30}},
+		{name: "empty override", role: RoleTrader, override: &QuotaOverride{}, want: Quota{MaxActiveAlerts: 50, MaxAlertsPerSymbol: 10, CommandsPerMinute: 30}},
+		{name: "one field", role: RoleTrader, override: &QuotaOverride{MaxActiveAlerts: intPtr(100)}, want: Quota{MaxActiveAlerts: 100, MaxAlertsPerSymbol: 10, CommandsPerMinute: 30}},
+		{name: "unlimited", role: RoleViewer, override: &QuotaOverride{MaxAlertsPerSymbol: intPtr(Unlimited), CommandsPerMinute: intPtr(Unlimited)}, want: Quota{}},
+		{name: "all fields", role: RoleAdmin, override: &QuotaOverride{MaxActiveAlerts: intPtr(1), MaxAlertsPerSymbol: intPtr(2), CommandsPerMinute: intPtr(3)}, want: Quota{MaxActiveAlerts: 1, MaxAlertsPerSymbol: 2, CommandsPerMinute: 3}},
+	}
+	for _, tt := range tests {
+		if got := EffectiveQuota(tt.role, tt.override); got != tt.want {
+			t.Errorf("%s: EffectiveQuota(%s) = %+v, want %+v", tt.name, tt.role, got, tt.want)
+		}
+	}
+}
+
+func TestQuotaOverrideField(t *testing.T) {
+	var override QuotaOverride
+	limits := map[string]int{"max_active_alerts": 1, "max_alerts_per_symbol": 2, "commands_per_minute": 3}
+	for name, limit := range limits {
+		field, ok := override.field(name)
+		if !ok {
+			t.Errorf("field(%q) not found", name)
+			continue
+		}
+		*field = &limit
+	}
+	want := Quota{MaxActiveAlerts: 1, MaxAlertsPerSymbol: 2, CommandsPerMinute: 3}
+	if got := EffectiveQuota(RoleTrader, &override); got != want {
+		t.Errorf("EffectiveQuota() = %+v, want %+v", got, want)
+	}
+	if _, ok := override.field("max_symbols"); ok {
+		t.Errorf("field(%q) found, want unknown", "max_symbols")
+	}
+}
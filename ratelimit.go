@@ -0,0 +1,101 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// TokenBucket allows bursts of up to capacity events and refills at a steady
+// rate per second.
+type TokenBucket struct {
+	capacity float64
+	tokens   float64
+	rate     float64
+	last     time.Time
+}
+
+func NewTokenBucket(capacity int, per time.Duration, now time.Time) *TokenBucket {
+	return &TokenBucket{
+		capacity: float64(capacity),
+		tokens:   float64(capacity),
+		rate:     float64(capacity) / per.Seconds(),
+		last:     now,
+	}
+}
+
+func (tb *TokenBucket) Allow(now time.Time) bool {
+	tb.tokens += now.Sub(tb.last).Seconds() * tb.rate
+	if tb.tokens > tb.capacity {
+		tb.tokens = tb.capacity
+	}
+	tb.last = now
+	if tb.tokens < 1 {
+		return false
+	}
+	tb.tokens--
+	return true
+}
+
+// RateLimiter keeps one token bucket per user.
+type RateLimiter struct {
+	mu      sync.Mutex
+	buckets map[int64]*TokenBucket
+	// warned remembers when a user was last told about the limit so a
+	// flood of commands does not turn into a flood of replies
+	warned map[int64]time.Time
+	// pruned is when idle users were last dropped
+	pruned time.Time
+}
+
+func NewRateLimiter() *RateLimiter {
+	return &RateLimiter{
+		buckets: make(map[int64]*TokenBucket),
+		warned:  make(map[int64]time.Time),
+	}
+}
+
+// Allow takes a token from the bucket of the user, sized for perMinute
+// events. A perMinute of zero means unlimited. When the event is refused,
+// warn reports whether the user should be told.
+func (rl *RateLimiter) Allow(userId int64, perMinute int) (allowed bool, warn bool) {
+	if perMinute <= 0 {
+		return true, false
+	}
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := time.Now()
+	rl.prune(now)
+	bucket, exist := rl.buckets[userId]
+	if !exist || bucket.capacity != float64(perMinute) {
+		bucket = NewTokenBucket(perMinute, time.Minute, now)
+		rl.buckets[userId] = bucket
+	}
+	if bucket.Allow(now) {
+		return true, false
+	}
+	if now.Sub(rl.warned[userId]) < time.Minute {
+		return false, false
+	}
+	rl.warned[userId] = now
+	return false, true
+}
+
+// prune drops, at most once a minute, the buckets that refilled and the
+// warnings that ran out since, so users who went quiet are forgotten.
+func (rl *RateLimiter) prune(now time.Time) {
+	if now.Sub(rl.pruned) < time.Minute {
+		return
+	}
+	rl.pruned = now
+	for userId, bucket := range rl.buckets {
+		if now.Sub(bucket.last) >= time.Minute {
+			delete(rl.buckets, userId)
+		}
+	}
+	for userId, warned := range rl.warned {
+		if now.Sub(warned) >= time.Minute {
+			delete(rl.warned, userId)
+		}
+	}
+}
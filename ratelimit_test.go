@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	start := time.Date(2024, 5, 6, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		at   time.Duration
+		want bool
+	}{
+		{name: "first of the burst", at: 0, want: true},
+		{name: "second of the burst", at: 0, want: true},
+		{name: "third of the burst", at: 0, want: true},
+		{name: "burst used up", at: time.Second},
+		// 3 tokens a minute refill one every 20 seconds
+		{name: "one token refilled", at: 20 * time.Second, want: true},
+		{name: "refilled token used", at: 21 * time.Second},
+		{name: "never more than the capacity", at: 10 * time.Minute, want: true},
+	}
+	bucket := NewTokenBucket(3, time.Minute, start)
+	for _, tt := range tests {
+		if got := bucket.Allow(start.Add(tt.at)); got != tt.want {
+			t.Errorf("%s: Allow() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		bucket.Allow(start.Add(10 * time.Minute))
+	}
+	if bucket.Allow(start.Add(10 * time.Minute)) {
+		t.Errorf("Allow() refilled beyond the capacity of 3")
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	rl := NewRateLimiter()
+	tests := []struct {
+		name      string
+		userId    int64
+		perMinute int
+		allowed   bool
+		warn      bool
+	}{
+		{name: "first", userId: 1, perMinute: 2, allowed: true},
+		{name: "second", userId: 1, perMinute: 2, allowed: true},
+		{name: "refused and warned", userId: 1, perMinute: 2, warn: true},
+		{name: "refused again without a warning", userId: 1, perMinute: 2},
+		{name: "other users have their own bucket", userId: 2, perMinute: 2, allowed: true},
+		{name: "unlimited", userId: 1, perMinute: Unlimited, allowed: true},
+		// a new quota starts a new bucket
+		{name: "quota raised", userId: 1, perMinute: 5, allowed: true},
+	}
+	for _, tt := range tests {
+		allowed, warn := rl.Allow(tt.userId, tt.perMinute)
+		if allowed != tt.allowed || warn != tt.warn {
+			t.Errorf("%s: Allow(%d, %d) = %v, %v, want %v, %v", tt.name, tt.userId, tt.perMinute, allowed, warn, tt.allowed, tt.warn)
+		}
+	}
+
+	// users quiet for a minute are forgotten
+	rl.prune(time.Now().Add(2 * time.Minute))
+	if len(rl.buckets) != 0 || len(rl.warned) != 0 {
+		t.Errorf("prune() kept %d buckets and %d warnings, want none", len(rl.buckets), len(rl.warned))
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+type Role string
+
+const (
+	RoleOwner  Role = "owner"
+	RoleAdmin  Role = "admin"
+	RoleTrader Role = "trader"
+	RoleViewer Role = "viewer"
+	RoleBanned Role = "banned"
+)
+
+type Permission string
+
+const (
+	// PermNone marks commands anyone may use, registered or not
+	PermNone            Permission = ""
+	PermViewSymbols     Permission = "view_symbols"
+	PermViewAlerts      Permission = "view_alerts"
+	PermManageAlerts    Permission = "manage_alerts"
+	PermManageAccount   Permission = "manage_account"
+	PermViewUsers       Permission = "view_users"
+	PermManageRoles     Permission = "manage_roles"
+	PermManageAllowlist Permission = "manage_allowlist"
+	PermManageInvites   Permission = "manage_invites"
+	PermManageQuotas    Permission = "manage_quotas"
+	PermBroadcast       Permission = "broadcast"
+	PermViewStats       Permission = "view_stats"
+	PermExportAll       Permission = "export_all"
+)
+
+var rolePermissions = map[Role][]Permission{
+	RoleOwner:  {PermViewSymbols, PermViewAlerts, PermManageAlerts, PermManageAccount, PermViewUsers, PermManageRoles, PermManageAllowlist, PermManageInvites, PermManageQuotas, PermBroadcast, PermViewStats, PermExportAll},
+	RoleAdmin:  {PermViewSymbols, PermViewAlerts, PermManageAlerts, PermManageAccount, PermViewUsers, PermManageRoles, PermManageAllowlist, PermManageInvites, PermManageQuotas, PermBroadcast, PermViewStats, PermExportAll},
+	RoleTrader: {PermViewSymbols, PermViewAlerts, PermManageAlerts, PermManageAccount},
+	RoleViewer: {PermViewSymbols, PermViewAlerts, PermManageAccount},
+	RoleBanned: {},
+}
+
+// roleRanks orders the roles; a user may only change the role of users
+// ranked below them, and only to a role ranked below their own.
+var roleRanks = map[Role]int{
+	RoleBanned: 0,
+	RoleViewer: 1,
+	RoleTrader: 2,
+	RoleAdmin:  3,
+	RoleOwner:  4,
+}
+
+func ParseRole(s string) (Role, bool) {
+	role := Role(strings.ToLower(s))
+	_, ok := roleRanks[role]
+	return role, ok
+}
+
+func (r Role) Can(p Permission) bool {
+	if p == PermNone {
+		return true
+	}
+	for _, perm := range rolePermissions[r] {
+		if perm == p {
+			return true
+		}
+	}
+	return false
+}
+
+func (r Role) IsAdmin() bool {
+	return r == RoleOwner || r == RoleAdmin
+}
+
+func (r Role) Outranks(other Role) bool {
+	return roleRanks[r] > roleRanks[other]
+}
+
+// demoted returns the role one step below r, never demoting into banned.
+func (r Role) demoted() Role {
+	switch r {
+	case RoleOwner:
+		return RoleAdmin
+	case RoleAdmin:
+		return RoleTrader
+	default:
+		return RoleViewer
+	}
+}
+
+type RegistrationMode string
+
+const (
+	// RegistrationOpen lets any Telegram user register with /start
+	RegistrationOpen RegistrationMode = "open"
+	// RegistrationAllowlist only lets allowlisted user ids or invited users
+	// register
+	RegistrationAllowlist RegistrationMode = "allowlist"
+	// RegistrationInvite only lets users with an invite link register
+	RegistrationInvite RegistrationMode = "invite"
+)
+
+// RegistrationModeFromEnv reads REGISTRATION_MODE, defaulting to the
+// allowlist so a fresh deployment is never open to everyone.
+func RegistrationModeFromEnv() RegistrationMode {
+	switch RegistrationMode(strings.ToLower(os.Getenv("REGISTRATION_MODE"))) {
+	case RegistrationOpen:
+		return RegistrationOpen
+	case RegistrationInvite:
+		return RegistrationInvite
+	default:
+		return RegistrationAllowlist
+	}
+}
+
+// AllowedUserIdsFromEnv reads the comma separated ALLOWED_USER_IDS.
+func AllowedUserIdsFromEnv() ([]int64, error) {
+	var userIds []int64
+	for _, part := range strings.Split(os.Getenv("ALLOWED_USER_IDS"), ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		userId, err := strconv.ParseInt(part, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		userIds = append(userIds, userId)
+	}
+	return userIds, nil
+}
+
+// resolveUser finds a registered user by Telegram user id or @username.
+func (b *TelegramBot) resolveUser(ref string) (*User, error) {
+	if userId, err := strconv.ParseInt(ref, 10, 64); err == nil {
+		return b.store.GetUserByUserId(userId)
+	}
+	return b.store.GetUserByUsername(strings.TrimPrefix(ref, "@"))
+}
+
+// changeRole applies newRole to the role of a user; newRole returns the
+// catalog key of a refusal when the change is not possible.
+func (b *TelegramBot) changeRole(c *CommandContext, ref string, newRole func(current Role) (Role, string)) error {
+	target, err := b.resolveUser(ref)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return b.sendMessage(c.ChatId, c.T("user.not_found"))
+		}
+		return err
+	}
+	if target.UserId == c.User.UserId {
+		return b.sendMessage(c.ChatId, c.T("role.own"))
+	}
+	if !c.User.Role.Outranks(target.Role) {
+		return b.sendMessage(c.ChatId, c.T("role.outranked"))
+	}
+	role, refusal := newRole(target.Role)
+	if refusal != "" {
+		return b.sendMessage(c.ChatId, c.T(refusal))
+	}
+	if !c.User.Role.Outranks(role) {
+		return b.sendMessage(c.ChatId, c.T("role.assign_outranked"))
+	}
+
+	if err := b.store.UpdateUserRole(target.UserId, role); err != nil {
+		return err
+	}
+	target.Role = role
+	if err := b.publishUserCommands(target); err != nil {
+		log.Printf("Error publishing commands for %d: %s", target.UserId, err.Error())
+	}
+	if err := b.sendMessage(target.UserId, T(b.language(target.UserId, target.LanguageCode), "role.changed", "role", role)); err != nil {
+		log.Printf("Error notifying %d about the role change: %s", target.UserId, err.Error())
+	}
+	return b.sendMessage(c.ChatId, c.T("role.changed_user", "username", target.Username, "role", role))
+}
+
+func (b *TelegramBot) promoteUser(c *CommandContext) error {
+	return b.changeRole(c, c.Args[0], func(current Role) (Role, string) {
+		role, ok := ParseRole(c.Args[1])
+		if !ok || role == RoleBanned {
+			return "", "role.invalid"
+		}
+		return role, ""
+	})
+}
+
+func (b *TelegramBot) demoteUser(c *CommandContext) error {
+	return b.changeRole(c, c.Args[0], func(current Role) (Role, string) {
+		if current == RoleViewer || current == RoleBanned {
+			return "", "role.lowest"
+		}
+		return current.demoted(), ""
+	})
+}
+
+func (b *TelegramBot) banUser(c *CommandContext) error {
+	return b.changeRole(c, c.Args[0], func(current Role) (Role, string) {
+		if current == RoleBanned {
+			return "", "role.already_banned"
+		}
+		return RoleBanned, ""
+	})
+}
+
+func (b *TelegramBot) unbanUser(c *CommandContext) error {
+	return b.changeRole(c, c.Args[0], func(current Role) (Role, string) {
+		if current != RoleBanned {
+			return "", "role.not_banned"
+		}
+		return RoleViewer, ""
+	})
+}
+
+func (b *TelegramBot) allowUser(c *CommandContext) error {
+	userId, _ := strconv.ParseInt(c.Args[0], 10, 64)
+	if err := b.store.AddToAllowlist(userId, c.UserId); err != nil {
+		return err
+	}
+	return b.sendMessage(c.ChatId, c.T("allowlist.added", "user_id", userId))
+}
+
+func (b *TelegramBot) disallowUser(c *CommandContext) error {
+	userId, _ := strconv.ParseInt(c.Args[0], 10, 64)
+	if err := b.store.RemoveFromAllowlist(userId); err != nil {
+		return err
+	}
+	return b.sendMessage(c.ChatId, c.T("allowlist.removed", "user_id", userId))
+}
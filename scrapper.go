@@ -1,54 +1,214 @@
 package main
 
 import (
+	"fmt"
 	"log"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
 )
 
-var tickers = make(map[string]*Ticker)
+var (
+	// tickersMu guards the ticker registry; the scrapers of every source
+	// update it concurrently
+	tickersMu sync.RWMutex
+	tickers   = make(map[string]*Ticker)
+)
+
+// getTicker returns a copy of the ticker of a symbol, or the synthetic
+// ticker derived from its inputs.
+func getTicker(symbol string) (*Ticker, bool) {
+	tickersMu.RLock()
+	defer tickersMu.RUnlock()
+
+	t, exist := tickers[symbol]
+	if !exist {
+		return deriveSynthetic(symbol, tickers)
+	}
+	ticker := *t
+	return &ticker, true
+}
+
+// snapshotTickers returns a copy of the ticker registry taken under one
+// lock, so alerts over several symbols see their prices at the same moment.
+func snapshotTickers() map[string]*Ticker {
+	tickersMu.RLock()
+	defer tickersMu.RUnlock()
+
+	snapshot := make(map[string]*Ticker, len(tickers))
+	for symbol, t := range tickers {
+		ticker := *t
+		snapshot[symbol] = &ticker
+	}
+	for _, s := range builtinSynthetics {
+		if t, exist := deriveSynthetic(s.Symbol, snapshot); exist {
+			snapshot[s.Symbol] = t
+		}
+	}
+	return snapshot
+}
+
+// staleSymbol returns the first of the symbols whose ticker in the snapshot
+// is stale, or "" when all of them are fresh.
+func staleSymbol(symbols []string, snapshot map[string]*Ticker, now time.Time) string {
+	for _, symbol := range symbols {
+		if t, exist := lookupTicker(snapshot, symbol); exist && t.Stale(now) {
+			return symbol
+		}
+	}
+	return ""
+}
+
+// lookupTicker returns the ticker of a symbol in a snapshot, deriving
+// synthetic tickers from the prices in the snapshot.
+func lookupTicker(snapshot map[string]*Ticker, symbol string) (*Ticker, bool) {
+	if t, exist := snapshot[symbol]; exist {
+		return t, true
+	}
+	t, exist := deriveSynthetic(symbol, snapshot)
+	if exist {
+		snapshot[symbol] = t
+	}
+	return t, exist
+}
+
+// missingSymbol returns the first of the symbols without a ticker in the
+// snapshot, or "" when all of them have one.
+func missingSymbol(symbols []string, snapshot map[string]*Ticker) string {
+	for _, symbol := range symbols {
+		if _, exist := lookupTicker(snapshot, symbol); !exist {
+			return symbol
+		}
+	}
+	return ""
+}
+
+// SourceHealth tracks the outcome of scraping one source page.
+type SourceHealth struct {
+	Url         string
+	Category    string
+	LastSuccess time.Time
+	LastError   string
+	LastErrorAt time.Time
+	Rows        int
+	Failures    int
+}
+
+var (
+	sourceHealthMu sync.Mutex
+	sourceHealth   = make(map[string]*SourceHealth)
+)
+
+func recordScrape(url, category string, rows int, err error) {
+	sourceHealthMu.Lock()
+	defer sourceHealthMu.Unlock()
+
+	health, exist := sourceHealth[url]
+	if !exist {
+		health = &SourceHealth{Url: url, Category: category}
+		sourceHealth[url] = health
+	}
+	if err != nil {
+		health.LastError = err.Error()
+		health.LastErrorAt = time.Now().UTC()
+		health.Failures++
+		return
+	}
+	health.LastSuccess = time.Now().UTC()
+	health.Rows = rows
+	health.Failures = 0
+}
+
+// scraperHealth returns a copy of the health of every source.
+func scraperHealth() []SourceHealth {
+	sourceHealthMu.Lock()
+	defer sourceHealthMu.Unlock()
+
+	var healths []SourceHealth
+	for _, health := range sourceHealth {
+		healths = append(healths, *health)
+	}
+	sort.Slice(healths, func(i, j int) bool { return healths[i].Url < healths[j].Url })
+	return healths
+}
+
+func (h *SourceHealth) toTelegramString(now time.Time, lang string) string {
+	source := h.Category + " " + h.Url[strings.LastIndex(strings.TrimSuffix(h.Url, "/"), "/")+1:]
+	if h.Failures == 0 {
+		return T(lang, "stats.source_ok", "source", source, "rows", h.Rows, "ago", formatDuration(now.Sub(h.LastSuccess)))
+	}
+	return T(lang, "stats.source_failing", "source", source, "count", h.Failures, "error", h.LastError)
+}
 
 func StartScrapping() {
 	for {
-		scrapForex()
-		scrapFeatures()
+		// the quotes of the previous cycle make the candles of indicators
+		// and the history move alerts look back on
+		snapshot := snapshotTickers()
+		sampleCandles(snapshot)
+		recordQuotes(snapshot)
+		checkBuiltinSynthetics(snapshot)
+		// closed markets keep showing their last prices, which are not
+		// scraped until they open again
+		now := time.Now()
+		if marketOpen("forex", now) {
+			scrapForex()
+		}
+		if marketOpen("feature", now) {
+			scrapFeatures()
+		}
 		scrapCryptos()
 		time.Sleep(5 * time.Minute) // 1-minute interval
 	}
 }
 
 func scrapForex() {
-	go scrap("https://www.tradingview.com/markets/currencies/rates-major/", processForex)
-	go scrap("https://www.tradingview.com/markets/currencies/rates-minor/", processForex)
+	go scrap("https://www.tradingview.com/markets/currencies/rates-major/", "forex", processForex)
+	go scrap("https://www.tradingview.com/markets/currencies/rates-minor/", "forex", processForex)
 }
 
 func scrapFeatures() {
-	go scrap("https://www.tradingview.com/markets/futures/quotes-metals/", processFeatures)
-	go scrap("https://www.tradingview.com/markets/futures/quotes-energy/", processFeatures)
+	go scrap("https://www.tradingview.com/markets/futures/quotes-metals/", "feature", processFeatures)
+	go scrap("https://www.tradingview.com/markets/futures/quotes-energy/", "feature", processFeatures)
 }
 
 func scrapCryptos() {
-	go scrap("https://www.tradingview.com/markets/cryptocurrencies/prices-all/", processCryptos)
+	go scrap("https://www.tradingview.com/markets/cryptocurrencies/prices-all/", "crypto", processCryptos)
 }
 
-func scrap(url string, processFunc func(*goquery.Selection)) {
+func scrap(url, category string, processFunc func(*goquery.Selection)) {
 	res, err := http.Get(url)
 	if err != nil {
 		log.Println("Error gettomg URL:", err)
+		recordScrape(url, category, 0, err)
+		return
 	}
 	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		recordScrape(url, category, 0, fmt.Errorf("unexpected status %s", res.Status))
+		return
+	}
 
 	doc, err := goquery.NewDocumentFromReader(res.Body)
 	if err != nil {
 		log.Println("Error reading docuemnt:", err)
+		recordScrape(url, category, 0, err)
+		return
 	}
-	doc.Find("tbody tr").Each(func(index int, row *goquery.Selection) {
+	rows := doc.Find("tbody tr")
+	rows.Each(func(index int, row *goquery.Selection) {
 		processFunc(row)
 	})
+	if rows.Length() == 0 {
+		recordScrape(url, category, 0, fmt.Errorf("no table rows found"))
+		return
+	}
+	recordScrape(url, category, rows.Length(), nil)
 }
 
 func processForex(row *goquery.Selection) {
@@ -120,7 +280,9 @@ func processPrices(symbol, name, livePriceStr, dailyHighStr, dailyLowStr, catego
 		}
 	}
 
-	ticker, exists := tickers[symbol]
+	tickersMu.Lock()
+	defer tickersMu.Unlock()
+	ticker, exists := tickers[strings.ToLower(symbol)]
 	if exists {
 		ticker.Update(livePrice, dailyHigh, dailyLow)
 
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// maxSessionDays is the number of sessions kept per symbol, enough for the
+// longest new-high and new-low alerts.
+const maxSessionDays = 60
+
+// SessionRoll is the local time the trading day of a category rolls over.
+type SessionRoll struct {
+	Location *time.Location
+	Hour     int
+}
+
+// sessionRolls holds the categories whose trading day doesn't roll at
+// midnight UTC: forex rolls at 17:00 New York time and the futures with the
+// CME Globex session at 17:00 Chicago time.
+var sessionRolls = map[string]SessionRoll{
+	"forex":   {Location: mustLoadLocation("America/New_York"), Hour: 17},
+	"feature": {Location: mustLoadLocation("America/Chicago"), Hour: 17},
+}
+
+func mustLoadLocation(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		panic(err)
+	}
+	return loc
+}
+
+// sessionStart returns when the session of a category trading at a time
+// started.
+func sessionStart(category string, at time.Time) time.Time {
+	roll, exist := sessionRolls[category]
+	if !exist {
+		roll = SessionRoll{Location: time.UTC}
+	}
+	local := at.In(roll.Location)
+	start := time.Date(local.Year(), local.Month(), local.Day(), roll.Hour, 0, 0, 0, roll.Location)
+	if local.Before(start) {
+		start = start.AddDate(0, 0, -1)
+	}
+	return start
+}
+
+// tradingDay names the session of a category trading at a time after the
+// day it ends on, so the forex session opening Sunday 17:00 New York time
+// is Monday's.
+func tradingDay(category string, at time.Time) string {
+	start := sessionStart(category, at)
+	if _, exist := sessionRolls[category]; exist {
+		start = start.AddDate(0, 0, 1)
+	}
+	return start.Format(time.DateOnly)
+}
+
+// Session is the range a symbol traded in during one trading day.
+type Session struct {
+	Symbol    string    `json:"symbol"`
+	Day       string    `json:"day"`
+	Open      float64   `json:"open"`
+	High      float64   `json:"high"`
+	Low       float64   `json:"low"`
+	Close     float64   `json:"close"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func GetCreateSessionsTable() string {
+	return `CREATE TABLE IF NOT EXISTS sessions (
+		symbol TEXT NOT NULL,
+		day TEXT NOT NULL,
+		open REAL NOT NULL,
+		high REAL NOT NULL,
+		low REAL NOT NULL,
+		close REAL NOT NULL,
+		updated_at TIMESTAMP NOT NULL,
+		PRIMARY KEY (symbol, day)
+	);`
+}
+
+// quoteRange returns the extremes of the latest quote of a ticker: the
+// prices traded since the previous quote when that one belongs to the same
+// session, otherwise only the live price.
+func quoteRange(t *Ticker) (high, low float64) {
+	if tradingDay(t.Category, t.PrevUpdatedAt) == tradingDay(t.Category, t.UpdatedAt) {
+		return t.RangeHigh, t.RangeLow
+	}
+	return t.LivePrice, t.LivePrice
+}
+
+// foldSession takes the latest quote of a ticker into its sessions, newest
+// first, and reports whether the current session changed.
+func foldSession(history []Session, t *Ticker) ([]Session, bool) {
+	day := tradingDay(t.Category, t.UpdatedAt)
+	if len(history) > 0 && history[0].Day > day {
+		return history, false
+	}
+	if len(history) == 0 || history[0].Day != day {
+		s := Session{Symbol: t.Symbol, Day: day, Open: t.LivePrice, High: t.LivePrice, Low: t.LivePrice, Close: t.LivePrice, UpdatedAt: t.UpdatedAt}
+		// a session first seen well after it started, such as after a
+		// restart, takes the daily range of the source, which has rolled
+		// over by then
+		if t.UpdatedAt.Sub(sessionStart(t.Category, t.UpdatedAt)) > staleAfter && t.DailyLow > 0 && t.DailyLow <= t.LivePrice && t.DailyHigh >= t.LivePrice {
+			s.High, s.Low = t.DailyHigh, t.DailyLow
+		}
+		history = append([]Session{s}, history...)
+		if len(history) > maxSessionDays {
+			history = history[:maxSessionDays]
+		}
+		return history, true
+	}
+	s := &history[0]
+	if !t.UpdatedAt.After(s.UpdatedAt) {
+		return history, false
+	}
+	high, low := quoteRange(t)
+	s.High, s.Low = max(s.High, high), min(s.Low, low)
+	s.Close, s.UpdatedAt = t.LivePrice, t.UpdatedAt
+	return history, true
+}
+
+var (
+	// sessionsMu guards sessions, recorded by the alert checker and read
+	// when alerts are created or shown
+	sessionsMu sync.Mutex
+	// sessions caches the latest sessions per symbol, newest first, as
+	// loaded from the store
+	sessions = make(map[string][]Session)
+)
+
+// loadSessions returns the cached sessions of a symbol, loading them from
+// the store on first use. The caller holds sessionsMu.
+func (b *TelegramBot) loadSessions(symbol string) []Session {
+	history, exist := sessions[symbol]
+	if !exist {
+		var err error
+		history, err = b.store.GetSessions(symbol, maxSessionDays)
+		if err != nil {
+			log.Println("Error retrieving sessions", err)
+			return nil
+		}
+		sessions[symbol] = history
+	}
+	return history
+}
+
+// sessionHistory returns a copy of the sessions of a symbol, newest first.
+func (b *TelegramBot) sessionHistory(symbol string) []Session {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+
+	return append([]Session(nil), b.loadSessions(symbol)...)
+}
+
+// cachedSessions returns a copy of the sessions of a symbol the alert
+// checker loaded, newest first.
+func cachedSessions(symbol string) []Session {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+
+	return append([]Session(nil), sessions[symbol]...)
+}
+
+// recordSessions takes the quotes of a snapshot into the sessions of their
+// symbols and stores the sessions that changed, so the ranges of previous
+// days survive restarts.
+func (b *TelegramBot) recordSessions(snapshot map[string]*Ticker) {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+
+	for symbol, t := range snapshot {
+		history, changed := foldSession(b.loadSessions(symbol), t)
+		if !changed {
+			continue
+		}
+		sessions[symbol] = history
+		if err := b.store.SaveSession(&history[0]); err != nil {
+			log.Println("Error storing session", err)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTradingDay(t *testing.T) {
+	newYork := mustLoadLocation("America/New_York")
+	tests := []struct {
+		category string
+		at       time.Time
+		want     string
+	}{
+		{category: "forex", at: time.Date(2024, 5, 1, 16, 59, 0, 0, newYork), want: "2024-05-01"},
+		{category: "forex", at: time.Date(2024, 5, 1, 17, 0, 0, 0, newYork), want: "2024-05-02"},
+		// the roll follows New York daylight saving time
+		{category: "forex", at: time.Date(2024, 1, 10, 21, 59, 0, 0, time.UTC), want: "2024-01-10"},
+		{category: "forex", at: time.Date(2024, 1, 10, 22, 0, 0, 0, time.UTC), want: "2024-01-11"},
+		{category: "forex", at: time.Date(2024, 7, 10, 21, 0, 0, 0, time.UTC), want: "2024-07-11"},
+		// the week opens on Sunday evening with Monday's session
+		{category: "forex", at: time.Date(2024, 5, 5, 18, 0, 0, 0, newYork), want: "2024-05-06"},
+		{category: "feature", at: time.Date(2024, 5, 1, 17, 30, 0, 0, newYork), want: "2024-05-01"},
+		{category: "feature", at: time.Date(2024, 5, 1, 18, 0, 0, 0, newYork), want: "2024-05-02"},
+		{category: "crypto", at: time.Date(2024, 5, 1, 23, 59, 0, 0, time.UTC), want: "2024-05-01"},
+		{category: "crypto", at: time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC), want: "2024-05-02"},
+	}
+	for _, tt := range tests {
+		if got := tradingDay(tt.category, tt.at); got != tt.want {
+			t.Errorf("tradingDay(%s, %s) = %s, want %s", tt.category, tt.at, got, tt.want)
+		}
+	}
+}
+
+func TestFoldSession(t *testing.T) {
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	ticker := &Ticker{Symbol: "btcusd", Category: "crypto"}
+	quote := func(at time.Time, price, high, low float64) {
+		ticker.PrevUpdatedAt, ticker.UpdatedAt = ticker.UpdatedAt, at
+		ticker.LivePrice, ticker.RangeHigh, ticker.RangeLow = price, high, low
+	}
+
+	// a session first seen after a restart takes the daily range of the source
+	ticker.DailyHigh, ticker.DailyLow = 105, 95
+	quote(start, 100, 100, 100)
+	history, changed := foldSession(nil, ticker)
+	if want := (Session{Symbol: "btcusd", Day: "2024-05-01", Open: 100, High: 105, Low: 95, Close: 100, UpdatedAt: start}); !changed || len(history) != 1 || history[0] != want {
+		t.Fatalf("first session %+v, want %+v", history, want)
+	}
+	quote(start.Add(5*time.Minute), 104, 107, 100)
+	history, _ = foldSession(history, ticker)
+	if s := history[0]; s.High != 107 || s.Low != 95 || s.Close != 104 {
+		t.Errorf("session %+v, want high 107, low 95 and close 104", s)
+	}
+	if _, changed := foldSession(history, ticker); changed {
+		t.Errorf("the same quote changed the session")
+	}
+
+	// the prices traded before midnight belong to the previous session
+	quote(start.Add(14*time.Hour), 110, 112, 90)
+	history, _ = foldSession(history, ticker)
+	if len(history) != 2 || history[0].Day != "2024-05-02" || history[0].High != 110 || history[0].Low != 110 || history[1].High != 107 {
+		t.Errorf("sessions %+v, want a new session at 110", history)
+	}
+}
+
+func TestBreakout(t *testing.T) {
+	now := time.Date(2024, 5, 3, 12, 0, 0, 0, time.UTC)
+	history := []Session{
+		{Day: "2024-05-03", High: 105, Low: 98},
+		{Day: "2024-05-02", High: 110, Low: 100},
+		{Day: "2024-05-01", High: 108, Low: 90},
+	}
+	tests := []struct {
+		name     string
+		breakout Breakout
+		prices   []float64
+		want     bool
+	}{
+		{name: "today's high", breakout: Breakout{Side: BreakoutHigh, Days: 1}, prices: []float64{106}, want: true},
+		{name: "at today's high", breakout: Breakout{Side: BreakoutHigh, Days: 1}, prices: []float64{105}},
+		{name: "below the 2-day high", breakout: Breakout{Side: BreakoutHigh, Days: 2}, prices: []float64{106}},
+		{name: "3-day low", breakout: Breakout{Side: BreakoutLow, Days: 3}, prices: []float64{89.5}, want: true},
+		{name: "4-day low warming up", breakout: Breakout{Side: BreakoutLow, Days: 4}, prices: []float64{80}},
+		{name: "inside the previous range", breakout: Breakout{Side: BreakoutReenter}, prices: []float64{104}},
+		{name: "still outside", breakout: Breakout{Side: BreakoutReenter}, prices: []float64{99, 98}},
+		{name: "back inside", breakout: Breakout{Side: BreakoutReenter}, prices: []float64{99, 101}, want: true},
+	}
+	for _, tt := range tests {
+		alert := NewBreakoutAlert(1, 1, "btcusd", "", tt.breakout, tt.prices[0])
+		alert.WatchedSince = now.Add(-time.Hour)
+		var triggered bool
+		for i, price := range tt.prices {
+			ticker := &Ticker{Symbol: "btcusd", Category: "crypto", LivePrice: price, RangeHigh: price, RangeLow: price, PrevUpdatedAt: now.Add(time.Duration(i-1) * 5 * time.Minute), UpdatedAt: now.Add(time.Duration(i) * 5 * time.Minute)}
+			_, triggered = alert.breakoutTriggered(ticker, history)
+		}
+		if triggered != tt.want {
+			t.Errorf("%s: triggered %t, want %t", tt.name, triggered, tt.want)
+		}
+	}
+
+	// the first quote of a session has no high of today to break
+	if _, ok := (Breakout{Side: BreakoutHigh, Days: 1}).level(history, "2024-05-04"); ok {
+		t.Errorf("today's high of a new session is known")
+	}
+	if level, ok := (Breakout{Side: BreakoutHigh, Days: 2}).level(history, "2024-05-04"); !ok || level != 105 {
+		t.Errorf("2-day high of a new session = %g, %t, want 105", level, ok)
+	}
+}
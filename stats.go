@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// startedAt is used to report the uptime of the bot.
+var startedAt = time.Now().UTC()
+
+// Notification records one message sent because of an alert, so triggers and
+// delivery failures can be reported.
+type Notification struct {
+	Id        int64     `json:"id"`
+	AlertId   string    `json:"alert_id"`
+	ChatId    int64     `json:"chat_id"`
+	Kind      string    `json:"kind"`
+	Delivered bool      `json:"delivered"`
+	Error     string    `json:"error"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Notification kinds: an alert that fired, one archived on expiry, or one
+// re-armed after the market gapped through its target.
+const (
+	NotificationTrigger = "trigger"
+	NotificationExpiry  = "expiry"
+	NotificationGap     = "gap"
+)
+
+func GetCreateNotificationsTable() string {
+	return `CREATE TABLE IF NOT EXISTS notifications (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		alert_id TEXT,
+		chat_id INTEGER,
+		kind TEXT NOT NULL,
+		delivered BOOLEAN NOT NULL,
+		error TEXT,
+		created_at TIMESTAMP NOT NULL
+	);`
+}
+
+func NewNotification(alert *Alert, kind string, sendErr error) *Notification {
+	n := &Notification{
+		AlertId:   alert.Id,
+		ChatId:    alert.ChatId,
+		Kind:      kind,
+		Delivered: sendErr == nil,
+		CreatedAt: time.Now().UTC(),
+	}
+	if sendErr != nil {
+		n.Error = sendErr.Error()
+	}
+	return n
+}
+
+type SymbolCount struct {
+	Symbol string
+	Count  int
+}
+
+// Stats holds the figures the store can compute for /stats.
+type Stats struct {
+	TotalUsers       int
+	ActiveUsers      int
+	ActiveAlerts     int
+	TriggeredAlerts  int
+	ArchivedAlerts   int
+	AlertsBySymbol   []SymbolCount
+	Triggers24h      int
+	Triggers7d       int
+	Failures24h      int
+	Failures7d       int
+	DatabaseSizeByte int64
+}
+
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Minute)
+	days := d / (24 * time.Hour)
+	d -= days * 24 * time.Hour
+	hours := d / time.Hour
+	d -= hours * time.Hour
+	return fmt.Sprintf("%dd %dh %dm", days, hours, d/time.Minute)
+}
+
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
+
+func sortedCounts(counts map[string]int) []string {
+	var keys []string
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var lines []string
+	for _, key := range keys {
+		lines = append(lines, fmt.Sprintf("  %s: %d", key, counts[key]))
+	}
+	return lines
+}
+
+func (b *TelegramBot) viewStats(c *CommandContext) error {
+	now := time.Now().UTC()
+	stats, err := b.store.GetStats(now)
+	if err != nil {
+		return err
+	}
+
+	alertsByCategory := make(map[string]int)
+	for _, sc := range stats.AlertsBySymbol {
+		category := c.T("stats.unknown_category")
+		if t, exist := getTicker(sc.Symbol); exist {
+			category = t.Category
+		} else if name, exist := moveCategories[sc.Symbol]; exist {
+			// move alerts on a whole category
+			category = name
+		}
+		alertsByCategory[category] += sc.Count
+	}
+	tickersByCategory := make(map[string]int)
+	for _, t := range snapshotTickers() {
+		tickersByCategory[t.Category]++
+	}
+
+	var lines []string
+	lines = append(lines,
+		c.T("stats.users", "total", stats.TotalUsers, "active", stats.ActiveUsers),
+		c.T("stats.alerts", "active", stats.ActiveAlerts, "triggered", stats.TriggeredAlerts, "archived", stats.ArchivedAlerts),
+		c.T("stats.alerts_by_category"))
+	lines = append(lines, sortedCounts(alertsByCategory)...)
+
+	lines = append(lines, c.T("stats.most_watched"))
+	for i, sc := range stats.AlertsBySymbol {
+		if i == 10 {
+			break
+		}
+		lines = append(lines, fmt.Sprintf("  %s: %d", strings.ToUpper(sc.Symbol), sc.Count))
+	}
+
+	lines = append(lines,
+		c.T("stats.triggers", "day", stats.Triggers24h, "week", stats.Triggers7d),
+		c.T("stats.failures", "day", stats.Failures24h, "week", stats.Failures7d),
+		c.T("stats.scraper_health"))
+	for _, health := range scraperHealth() {
+		lines = append(lines, "  "+health.toTelegramString(now, c.Lang))
+	}
+
+	lines = append(lines, c.T("stats.tickers_by_category"))
+	lines = append(lines, sortedCounts(tickersByCategory)...)
+	lines = append(lines,
+		c.T("stats.database_size", "size", formatBytes(stats.DatabaseSizeByte)),
+		c.T("stats.uptime", "uptime", formatDuration(now.Sub(startedAt))))
+
+	return b.sendMessageInChunks(c.ChatId, strings.Join(lines, "\n"))
+}
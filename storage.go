@@ -3,6 +3,7 @@ package main
 import (
 	"database/sql"
 	"log"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -11,19 +12,63 @@ type Storage interface {
 	GetUser(id string) (*User, error)
 	GetUserByUserId(userId int64) (*User, error)
 	GetUsers() ([]User, error)
+	GetUserByUsername(username string) (*User, error)
 	CreateUser(user User) error
 	UpdateUser(id string, user User) error
+	UpdateUserRole(userId int64, role Role) error
+	SetUserActive(userId int64, active bool) error
+	SetUserLanguageCode(userId int64, languageCode string) error
+	ScheduleUserDeletion(userId int64, deleteAt *time.Time) error
+	GetUsersScheduledForDeletion() ([]User, error)
+	GetUserIdsWithAlertsOnSymbol(symbol string) ([]int64, error)
+
+	IsAllowlisted(userId int64) (bool, error)
+	AddToAllowlist(userId, addedBy int64) error
+	RemoveFromAllowlist(userId int64) error
+
+	GetQuotaOverride(userId int64) (*QuotaOverride, error)
+	GetQuotaOverrides() ([]QuotaOverride, error)
+	SetQuotaOverride(override *QuotaOverride) error
+	DeleteQuotaOverride(userId int64) error
+
+	CreateInvite(invite *Invite) error
+	GetInvites() ([]Invite, error)
+	RevokeInvite(code string) error
+	RedeemInvite(code string, user *User) error
 
 	GetAlert(id string) (*Alert, error)
 	GetAlerts() ([]Alert, error)
+	GetAlertsByChatId(chatId int64) ([]Alert, error)
 	GetAlertsByUserId(userId int64) ([]Alert, error)
-	GetAlertByNumber(userId int64, number int32) (*Alert, error)
-	GetAlertsByUserIdAndSymbol(userId int64, symbol string) ([]Alert, error)
+	GetNotificationsByUserId(userId int64) ([]Notification, error)
+	GetAlertByNumber(chatId int64, number int32) (*Alert, error)
+	GetAlertsByChatIdAndSymbol(chatId int64, symbol string) ([]Alert, error)
+	CountActiveAlertsByUserId(userId int64) (int, error)
+	CountActiveAlertsByUserIdAndSymbol(userId int64, symbol string) (int, error)
 	CreateAlert(alert *Alert) error
+	CreateAlerts(alerts []*Alert) error
 	UpdateAlert(alert *Alert) error
 	DeleteAlert(id string) error
 
 	DeleteUserAndAlerts(userId int64) error
+
+	GetPreferences(userId int64) (*Preferences, error)
+	SetPreferences(p *Preferences) error
+
+	CreateNotification(n *Notification) error
+	QueueNotification(q *QueuedNotification) error
+	GetQueuedNotifications() ([]QueuedNotification, error)
+	RetryQueuedNotification(id int64) error
+	DeleteQueuedNotification(id int64) error
+	GetStats(now time.Time) (*Stats, error)
+
+	SaveSession(session *Session) error
+	GetSessions(symbol string, limit int) ([]Session, error)
+
+	GetPosition(userId int64, symbol string) (*Position, error)
+	GetPositionsByUserId(userId int64) ([]Position, error)
+	SetPosition(p *Position) error
+	DeletePosition(userId int64, symbol string) error
 }
 
 type SqliteStore struct {
@@ -52,21 +97,199 @@ func (s *SqliteStore) Init() error {
 		return err
 	}
 
+	// users created before roles existed keep their admin flag as the admin
+	// role and become traders otherwise, the env admin is promoted to owner
+	// by StablishAdmin
+	if err := s.addColumnIfNotExists("users", "role", "TEXT"); err != nil {
+		return err
+	}
+	if legacy, err := s.hasColumn("users", "is_admin"); err != nil {
+		return err
+	} else if legacy {
+		if _, err := s.db.Exec(`UPDATE users SET role = ? WHERE role IS NULL AND is_admin = TRUE`, RoleAdmin); err != nil {
+			return err
+		}
+	}
+	if _, err := s.db.Exec(`UPDATE users SET role = ? WHERE role IS NULL`, RoleTrader); err != nil {
+		return err
+	}
+
+	if err := s.addColumnIfNotExists("users", "invited_by", "INTEGER"); err != nil {
+		return err
+	}
+
+	// users who blocked the bot are marked inactive
+	if err := s.addColumnIfNotExists("users", "active", "BOOLEAN NOT NULL DEFAULT TRUE"); err != nil {
+		return err
+	}
+
+	if err := s.addColumnIfNotExists("users", "delete_at", "TIMESTAMP"); err != nil {
+		return err
+	}
+
+	if err := s.addColumnIfNotExists("users", "language_code", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+
+	// create table for quota overrides
+	if _, err := s.db.Exec(GetCreateQuotaOverridesTable()); err != nil {
+		return err
+	}
+
+	// create table for invites
+	if _, err := s.db.Exec(GetCreateInvitesTable()); err != nil {
+		return err
+	}
+
+	// create table for allowlist
+	if _, err := s.db.Exec(GetCreateAllowlistTable()); err != nil {
+		return err
+	}
+
+	// create table for notifications
+	if _, err := s.db.Exec(GetCreateNotificationsTable()); err != nil {
+		return err
+	}
+
+	// create table for preferences
+	if _, err := s.db.Exec(GetCreatePreferencesTable()); err != nil {
+		return err
+	}
+
+	if err := s.addColumnIfNotExists("preferences", "gaps", "BOOLEAN NOT NULL DEFAULT FALSE"); err != nil {
+		return err
+	}
+
+	// create table for notifications held back during quiet hours
+	if _, err := s.db.Exec(GetCreateQueuedNotificationsTable()); err != nil {
+		return err
+	}
+
+	// create table for the daily ranges of symbols
+	if _, err := s.db.Exec(GetCreateSessionsTable()); err != nil {
+		return err
+	}
+
+	// create table for the positions of users
+	if _, err := s.db.Exec(GetCreatePositionsTable()); err != nil {
+		return err
+	}
+
 	// create table for alerts
 	_, err = s.db.Exec(GetCreateAlertsTable())
 	if err != nil {
 		return err
 	}
+	// alerts created before chat ownership belong to the creator's private chat
+	if err := s.addColumnIfNotExists("alerts", "chat_id", "INTEGER"); err != nil {
+		return err
+	}
+	if _, err := s.db.Exec(`UPDATE alerts SET chat_id = user_id WHERE chat_id IS NULL`); err != nil {
+		return err
+	}
+	if err := s.addColumnIfNotExists("alerts", "urgent", "BOOLEAN NOT NULL DEFAULT FALSE"); err != nil {
+		return err
+	}
+	// older alerts watch the price from their start price on
+	if err := s.addColumnIfNotExists("alerts", "high_price", "REAL NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := s.addColumnIfNotExists("alerts", "low_price", "REAL NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := s.addColumnIfNotExists("alerts", "watched_since", "TIMESTAMP"); err != nil {
+		return err
+	}
+	if _, err := s.db.Exec(`UPDATE alerts SET high_price = start_price, low_price = start_price, watched_since = updated_at WHERE watched_since IS NULL`); err != nil {
+		return err
+	}
+	if err := s.addColumnIfNotExists("alerts", "kind", "TEXT NOT NULL DEFAULT 'price'"); err != nil {
+		return err
+	}
+	if err := s.addColumnIfNotExists("alerts", "trail_distance", "REAL NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := s.addColumnIfNotExists("alerts", "trail_percent", "BOOLEAN NOT NULL DEFAULT FALSE"); err != nil {
+		return err
+	}
+	if err := s.addColumnIfNotExists("alerts", "trail_short", "BOOLEAN NOT NULL DEFAULT FALSE"); err != nil {
+		return err
+	}
+	if err := s.addColumnIfNotExists("alerts", "condition", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := s.addColumnIfNotExists("alerts", "move_percent", "REAL NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := s.addColumnIfNotExists("alerts", "move_direction", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := s.addColumnIfNotExists("alerts", "move_minutes", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := s.addColumnIfNotExists("alerts", "breakout_side", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := s.addColumnIfNotExists("alerts", "breakout_days", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := s.addColumnIfNotExists("alerts", "expires_at", "TIMESTAMP"); err != nil {
+		return err
+	}
+	if err := s.addColumnIfNotExists("alerts", "archived_at", "TIMESTAMP"); err != nil {
+		return err
+	}
+	if err := s.addColumnIfNotExists("alerts", "active_window", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := s.addColumnIfNotExists("alerts", "ladder", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := s.addColumnIfNotExists("alerts", "pnl_amount", "REAL NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := s.addColumnIfNotExists("alerts", "pnl_r", "BOOLEAN NOT NULL DEFAULT FALSE"); err != nil {
+		return err
+	}
+	if err := s.addColumnIfNotExists("alerts", "pnl_short", "BOOLEAN NOT NULL DEFAULT FALSE"); err != nil {
+		return err
+	}
+	if err := s.addColumnIfNotExists("alerts", "moves_fired", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	// notifications queued before expiry notices were triggers
+	if err := s.addColumnIfNotExists("queued_notifications", "kind", "TEXT NOT NULL DEFAULT 'trigger'"); err != nil {
+		return err
+	}
+	if err := s.addColumnIfNotExists("queued_notifications", "attempts", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
 
 	// create admin for users
 	return nil
 }
 
+// addColumnIfNotExists migrates tables created by older versions.
+func (s *SqliteStore) hasColumn(table, column string) (bool, error) {
+	var count int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`, table, column).Scan(&count)
+	return count > 0, err
+}
+
+func (s *SqliteStore) addColumnIfNotExists(table, column, definition string) error {
+	exists, err := s.hasColumn(table, column)
+	if err != nil || exists {
+		return err
+	}
+	_, err = s.db.Exec(`ALTER TABLE ` + table + ` ADD COLUMN ` + column + ` ` + definition)
+	return err
+}
+
 func (s *SqliteStore) StablishAdmin(userId int64) error {
 	user, err := s.GetUserByUserId(userId)
 	if user != nil {
-		if user.IsAdmin == false {
-			user.IsAdmin = true
+		if user.Role != RoleOwner {
+			user.Role = RoleOwner
 			if err := s.UpdateUser(user.Id, *user); err != nil {
 				return err
 			}
@@ -88,24 +311,36 @@ func (s *SqliteStore) StablishAdmin(userId int64) error {
 }
 
 // users crud
+const userColumns = "id, user_id, username, firstname, lastname, password, created_at, role, IFNULL(invited_by, 0), IFNULL(active, TRUE), delete_at, language_code"
+
+// userFields returns the scan destinations matching userColumns.
+func userFields(user *User) []any {
+	return []any{&user.Id, &user.UserId, &user.Username, &user.Firstname, &user.Lastname, &user.Password, &user.CreatedAt, &user.Role, &user.InvitedBy, &user.Active, &user.DeleteAt, &user.LanguageCode}
+}
+
 func (s *SqliteStore) GetUser(id string) (*User, error) {
-	row := s.db.QueryRow(`SELECT id, user_id, username, firstname, lastname, created_at, is_admin FROM users WHERE id = ?`, id)
 	var user User
-	if err := row.Scan(&user.Id, &user.UserId, &user.Username, &user.Firstname, &user.Lastname, &user.CreatedAt, &user.IsAdmin); err != nil {
+	if err := s.db.QueryRow("SELECT "+userColumns+" FROM users WHERE id = ?", id).Scan(userFields(&user)...); err != nil {
 		return nil, err
 	}
 	return &user, nil
 }
 func (s *SqliteStore) GetUserByUserId(userId int64) (*User, error) {
-	row := s.db.QueryRow(`SELECT id, user_id, username, firstname, lastname, password, created_at, is_admin FROM users WHERE user_id = ?`, userId)
 	var user User
-	if err := row.Scan(&user.Id, &user.UserId, &user.Username, &user.Firstname, &user.Lastname, &user.Password, &user.CreatedAt, &user.IsAdmin); err != nil {
+	if err := s.db.QueryRow("SELECT "+userColumns+" FROM users WHERE user_id = ?", userId).Scan(userFields(&user)...); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+func (s *SqliteStore) GetUserByUsername(username string) (*User, error) {
+	var user User
+	if err := s.db.QueryRow("SELECT "+userColumns+" FROM users WHERE username = ? COLLATE NOCASE", username).Scan(userFields(&user)...); err != nil {
 		return nil, err
 	}
 	return &user, nil
 }
 func (s *SqliteStore) GetUsers() ([]User, error) {
-	rows, err := s.db.Query(`SELECT id, user_id, username, firstname, lastname ,created_at, is_admin FROM users`)
+	rows, err := s.db.Query("SELECT " + userColumns + " FROM users")
 	if err != nil {
 		return nil, err
 	}
@@ -114,20 +349,68 @@ func (s *SqliteStore) GetUsers() ([]User, error) {
 	var users []User
 	for rows.Next() {
 		var u User
-		if err := rows.Scan(&u.Id, &u.UserId, &u.Username, &u.Firstname, &u.Lastname, &u.CreatedAt, &u.IsAdmin); err != nil {
+		if err := rows.Scan(userFields(&u)...); err != nil {
 			return nil, err
 		}
 		users = append(users, u)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
 	return users, nil
 }
 func (s *SqliteStore) CreateUser(user User) error {
-	_, err := s.db.Exec(`INSERT INTO users (id, user_id, username, firstname, lastname ,password, created_at, is_admin) VALUES (?,?,?,?,?,?,?,?)`, user.Id, user.UserId, user.Username, user.Firstname, user.Lastname, user.Password, user.CreatedAt, user.IsAdmin)
+	return createUser(s.db, user)
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx.
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+func createUser(db execer, user User) error {
+	_, err := db.Exec(`INSERT INTO users (id, user_id, username, firstname, lastname ,password, created_at, role, invited_by, active, language_code) VALUES (?,?,?,?,?,?,?,?,?,?,?)`, user.Id, user.UserId, user.Username, user.Firstname, user.Lastname, user.Password, user.CreatedAt, user.Role, sql.NullInt64{Int64: user.InvitedBy, Valid: user.InvitedBy != 0}, user.Active, user.LanguageCode)
 	return err
 }
 func (s *SqliteStore) UpdateUser(id string, user User) error {
-	_, err := s.db.Exec(`UPDATE users SET user_id = ?, username = ?, firstname = ?, lastname = ?, password = ?, cretated_at = ?, is_admin = ? WHERE id = ?`, user.UserId, user.Username, user.Firstname, user.Lastname, user.Password, user.CreatedAt, user.IsAdmin, id)
+	_, err := s.db.Exec(`UPDATE users SET user_id = ?, username = ?, firstname = ?, lastname = ?, password = ?, created_at = ?, role = ? WHERE id = ?`, user.UserId, user.Username, user.Firstname, user.Lastname, user.Password, user.CreatedAt, user.Role, id)
+	return err
+}
+func (s *SqliteStore) SetUserActive(userId int64, active bool) error {
+	_, err := s.db.Exec(`UPDATE users SET active = ? WHERE user_id = ?`, active, userId)
+	return err
+}
+func (s *SqliteStore) SetUserLanguageCode(userId int64, languageCode string) error {
+	_, err := s.db.Exec(`UPDATE users SET language_code = ? WHERE user_id = ?`, languageCode, userId)
+	return err
+}
+
+// ScheduleUserDeletion sets the time the account is deleted at, nil cancels
+// a scheduled deletion.
+func (s *SqliteStore) ScheduleUserDeletion(userId int64, deleteAt *time.Time) error {
+	_, err := s.db.Exec(`UPDATE users SET delete_at = ? WHERE user_id = ?`, deleteAt, userId)
+	return err
+}
+func (s *SqliteStore) GetUsersScheduledForDeletion() ([]User, error) {
+	rows, err := s.db.Query("SELECT " + userColumns + " FROM users WHERE delete_at IS NOT NULL")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		var u User
+		if err := rows.Scan(userFields(&u)...); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+func (s *SqliteStore) UpdateUserRole(userId int64, role Role) error {
+	_, err := s.db.Exec(`UPDATE users SET role = ? WHERE user_id = ?`, role, userId)
 	return err
 }
 func (s *SqliteStore) DeleteUser(id string) error {
@@ -135,18 +418,178 @@ func (s *SqliteStore) DeleteUser(id string) error {
 	return err
 }
 
+// allowlist
+func (s *SqliteStore) IsAllowlisted(userId int64) (bool, error) {
+	var count int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM allowlist WHERE user_id = ?`, userId).Scan(&count); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+func (s *SqliteStore) AddToAllowlist(userId, addedBy int64) error {
+	_, err := s.db.Exec(`INSERT OR IGNORE INTO allowlist (user_id, added_by, created_at) VALUES (?, ?, ?)`, userId, addedBy, time.Now().UTC())
+	return err
+}
+func (s *SqliteStore) RemoveFromAllowlist(userId int64) error {
+	_, err := s.db.Exec(`DELETE FROM allowlist WHERE user_id = ?`, userId)
+	return err
+}
+
+// quota overrides
+func (s *SqliteStore) GetQuotaOverride(userId int64) (*QuotaOverride, error) {
+	var maxActive, maxPerSymbol, perMinute sql.NullInt64
+	err := s.db.QueryRow(`SELECT max_active_alerts, max_alerts_per_symbol, commands_per_minute FROM quota_overrides WHERE user_id = ?`, userId).
+		Scan(&maxActive, &maxPerSymbol, &perMinute)
+	if err != nil {
+		return nil, err
+	}
+	override := &QuotaOverride{UserId: userId}
+	for _, f := range []struct {
+		value sql.NullInt64
+		field **int
+	}{{maxActive, &override.MaxActiveAlerts}, {maxPerSymbol, &override.MaxAlertsPerSymbol}, {perMinute, &override.CommandsPerMinute}} {
+		if f.value.Valid {
+			limit := int(f.value.Int64)
+			*f.field = &limit
+		}
+	}
+	return override, nil
+}
+func (s *SqliteStore) GetQuotaOverrides() ([]QuotaOverride, error) {
+	rows, err := s.db.Query(`SELECT user_id FROM quota_overrides`)
+	if err != nil {
+		return nil, err
+	}
+	var userIds []int64
+	for rows.Next() {
+		var userId int64
+		if err := rows.Scan(&userId); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		userIds = append(userIds, userId)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var overrides []QuotaOverride
+	for _, userId := range userIds {
+		override, err := s.GetQuotaOverride(userId)
+		if err != nil {
+			return nil, err
+		}
+		overrides = append(overrides, *override)
+	}
+	return overrides, nil
+}
+func (s *SqliteStore) SetQuotaOverride(override *QuotaOverride) error {
+	_, err := s.db.Exec(`INSERT INTO quota_overrides (user_id, max_active_alerts, max_alerts_per_symbol, commands_per_minute) VALUES (?, ?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET max_active_alerts = excluded.max_active_alerts, max_alerts_per_symbol = excluded.max_alerts_per_symbol, commands_per_minute = excluded.commands_per_minute`,
+		override.UserId, override.MaxActiveAlerts, override.MaxAlertsPerSymbol, override.CommandsPerMinute)
+	return err
+}
+func (s *SqliteStore) DeleteQuotaOverride(userId int64) error {
+	_, err := s.db.Exec(`DELETE FROM quota_overrides WHERE user_id = ?`, userId)
+	return err
+}
+
+// invites
+const inviteColumns = "code, created_by, role, max_uses, uses, expires_at, revoked, created_at"
+
+func inviteFields(invite *Invite) []any {
+	return []any{&invite.Code, &invite.CreatedBy, &invite.Role, &invite.MaxUses, &invite.Uses, &invite.ExpiresAt, &invite.Revoked, &invite.CreatedAt}
+}
+
+func (s *SqliteStore) CreateInvite(invite *Invite) error {
+	_, err := s.db.Exec(`INSERT INTO invites (`+inviteColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		invite.Code, invite.CreatedBy, invite.Role, invite.MaxUses, invite.Uses, invite.ExpiresAt, invite.Revoked, invite.CreatedAt)
+	return err
+}
+func (s *SqliteStore) GetInvites() ([]Invite, error) {
+	rows, err := s.db.Query("SELECT " + inviteColumns + " FROM invites ORDER BY created_at DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var invites []Invite
+	for rows.Next() {
+		var invite Invite
+		if err := rows.Scan(inviteFields(&invite)...); err != nil {
+			return nil, err
+		}
+		invites = append(invites, invite)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return invites, nil
+}
+func (s *SqliteStore) RevokeInvite(code string) error {
+	res, err := s.db.Exec(`UPDATE invites SET revoked = TRUE WHERE code = ?`, code)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// RedeemInvite uses up one use of the invite and registers the user with
+// the role of the invite in one transaction.
+func (s *SqliteStore) RedeemInvite(code string, user *User) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	var invite Invite
+	if err := tx.QueryRow("SELECT "+inviteColumns+" FROM invites WHERE code = ?", code).Scan(inviteFields(&invite)...); err != nil {
+		tx.Rollback()
+		if err == sql.ErrNoRows {
+			return ErrInviteInvalid
+		}
+		return err
+	}
+	if !invite.IsValid(time.Now().UTC()) {
+		tx.Rollback()
+		return ErrInviteInvalid
+	}
+	if _, err := tx.Exec(`UPDATE invites SET uses = uses + 1 WHERE code = ?`, code); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	user.Role = invite.Role
+	user.InvitedBy = invite.CreatedBy
+	if err := createUser(tx, *user); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
 // alert CRUD
+const alertColumns = "id, user_id, chat_id, number, symbol, description, target_price, start_price, active, urgent, kind, trail_distance, trail_percent, trail_short, condition, move_percent, move_direction, move_minutes, breakout_side, breakout_days, expires_at, archived_at, active_window, ladder, pnl_amount, pnl_r, pnl_short, moves_fired, high_price, low_price, watched_since, created_at, updated_at"
+
+// alertFields returns the scan destinations matching alertColumns.
+func alertFields(alert *Alert) []any {
+	return []any{&alert.Id, &alert.UserId, &alert.ChatId, &alert.Number, &alert.Symbol, &alert.Description, &alert.TargetPrice, &alert.StartPrice, &alert.Active, &alert.Urgent, &alert.Kind, &alert.Trail.Distance, &alert.Trail.Percent, &alert.Trail.Short, &alert.Condition, &alert.Move.Percent, &alert.Move.Direction, &alert.Move.Minutes, &alert.Breakout.Side, &alert.Breakout.Days, &alert.ExpiresAt, &alert.ArchivedAt, &alert.Window, &alert.Ladder, &alert.PnL.Amount, &alert.PnL.R, &alert.PnL.Short, &alert.MovesFired, &alert.HighPrice, &alert.LowPrice, &alert.WatchedSince, &alert.CreatedAt, &alert.UpdatedAt}
+}
+
 func (s *SqliteStore) GetAlert(id string) (*Alert, error) {
 	var alert Alert
-	err := s.db.QueryRow(`SELECT id, user_id, number, symbol, description, target_price, start_price, active, created_at FROM alerts WHERE id = ?;`, id).
-		Scan(&alert.Id, &alert.UserId, &alert.Number, &alert.Symbol, &alert.Description, &alert.TargetPrice, &alert.StartPrice, &alert.Active, &alert.CreatedAt)
+	err := s.db.QueryRow("SELECT "+alertColumns+" FROM alerts WHERE id = ?;", id).
+		Scan(alertFields(&alert)...)
 	if err != nil {
 		return nil, err
 	}
 	return &alert, nil
 }
 func (s *SqliteStore) GetAlerts() ([]Alert, error) {
-	rows, err := s.db.Query(`SELECT id, user_id, number, symbol, description, target_price, start_price, active, created_at FROM alerts;`)
+	rows, err := s.db.Query("SELECT " + alertColumns + " FROM alerts;")
 	if err != nil {
 		return nil, err
 	}
@@ -155,7 +598,7 @@ func (s *SqliteStore) GetAlerts() ([]Alert, error) {
 	var alerts []Alert
 	for rows.Next() {
 		var alert Alert
-		err := rows.Scan(&alert.Id, &alert.UserId, &alert.Number, &alert.Symbol, &alert.Description, &alert.TargetPrice, &alert.StartPrice, &alert.Active, &alert.CreatedAt)
+		err := rows.Scan(alertFields(&alert)...)
 		if err != nil {
 			return nil, err
 		}
@@ -167,8 +610,8 @@ func (s *SqliteStore) GetAlerts() ([]Alert, error) {
 
 	return alerts, nil
 }
-func (s *SqliteStore) GetAlertsByUserId(userId int64) ([]Alert, error) {
-	rows, err := s.db.Query("SELECT id, user_id, number, symbol, description, target_price, start_price, active, created_at FROM alerts WHERE user_id = ?", userId)
+func (s *SqliteStore) GetAlertsByChatId(chatId int64) ([]Alert, error) {
+	rows, err := s.db.Query("SELECT "+alertColumns+" FROM alerts WHERE chat_id = ?", chatId)
 	if err != nil {
 		return nil, err
 	}
@@ -177,7 +620,7 @@ func (s *SqliteStore) GetAlertsByUserId(userId int64) ([]Alert, error) {
 	var alerts []Alert
 	for rows.Next() {
 		var alert Alert
-		err := rows.Scan(&alert.Id, &alert.UserId, &alert.Number, &alert.Symbol, &alert.Description, &alert.TargetPrice, &alert.StartPrice, &alert.Active, &alert.CreatedAt)
+		err := rows.Scan(alertFields(&alert)...)
 		if err != nil {
 			return nil, err
 		}
@@ -189,15 +632,36 @@ func (s *SqliteStore) GetAlertsByUserId(userId int64) ([]Alert, error) {
 
 	return alerts, nil
 }
-func (s *SqliteStore) GetAlertByNumber(userId int64, number int32) (*Alert, error) {
+func (s *SqliteStore) GetAlertsByUserId(userId int64) ([]Alert, error) {
+	rows, err := s.db.Query("SELECT "+alertColumns+" FROM alerts WHERE user_id = ?", userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var alerts []Alert
+	for rows.Next() {
+		var alert Alert
+		if err := rows.Scan(alertFields(&alert)...); err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, alert)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return alerts, nil
+}
+func (s *SqliteStore) GetAlertByNumber(chatId int64, number int32) (*Alert, error) {
 	var alert Alert
-	if err := s.db.QueryRow(`SELECT id, user_id, number, symbol, description, target_price, start_price, active, created_at FROM alerts WHERE user_id = ? AND number = ?;`, userId, number).Scan(&alert.Id, &alert.UserId, &alert.Number, &alert.Symbol, &alert.Description, &alert.TargetPrice, &alert.StartPrice, &alert.Active, &alert.CreatedAt); err != nil {
+	if err := s.db.QueryRow("SELECT "+alertColumns+" FROM alerts WHERE chat_id = ? AND number = ?;", chatId, number).Scan(alertFields(&alert)...); err != nil {
 		return nil, err
 	}
 	return &alert, nil
 }
-func (s *SqliteStore) GetAlertsByUserIdAndSymbol(userId int64, symbol string) ([]Alert, error) {
-	rows, err := s.db.Query("SELECT id, user_id, number, symbol, description, target_price, start_price, active, created_at FROM alerts WHERE user_id = ? AND symbol = ? COLLATE NOCASE", userId, symbol)
+func (s *SqliteStore) GetAlertsByChatIdAndSymbol(chatId int64, symbol string) ([]Alert, error) {
+	rows, err := s.db.Query("SELECT "+alertColumns+" FROM alerts WHERE chat_id = ? AND symbol = ? COLLATE NOCASE", chatId, symbol)
 	if err != nil {
 		return nil, err
 	}
@@ -206,7 +670,7 @@ func (s *SqliteStore) GetAlertsByUserIdAndSymbol(userId int64, symbol string) ([
 	var alerts []Alert
 	for rows.Next() {
 		var alert Alert
-		err := rows.Scan(&alert.Id, &alert.UserId, &alert.Number, &alert.Symbol, &alert.Description, &alert.TargetPrice, &alert.StartPrice, &alert.Active, &alert.CreatedAt)
+		err := rows.Scan(alertFields(&alert)...)
 		if err != nil {
 			return nil, err
 		}
@@ -218,9 +682,9 @@ func (s *SqliteStore) GetAlertsByUserIdAndSymbol(userId int64, symbol string) ([
 
 	return alerts, nil
 }
-func (s *SqliteStore) GetAlertsByUserIdAndSymbolLike(userId int64, symbol string) ([]Alert, error) {
-	query := "SELECT id, user_id, number, symbol, description, target_price, start_price, active, created_at FROM alerts WHERE user_id = ? AND symbol LIKE ? COLLATE NOCASE"
-	rows, err := s.db.Query(query, userId, "%"+symbol+"%")
+func (s *SqliteStore) GetAlertsByChatIdAndSymbolLike(chatId int64, symbol string) ([]Alert, error) {
+	query := "SELECT " + alertColumns + " FROM alerts WHERE chat_id = ? AND symbol LIKE ? COLLATE NOCASE"
+	rows, err := s.db.Query(query, chatId, "%"+symbol+"%")
 	if err != nil {
 		return nil, err
 	}
@@ -229,7 +693,7 @@ func (s *SqliteStore) GetAlertsByUserIdAndSymbolLike(userId int64, symbol string
 	var alerts []Alert
 	for rows.Next() {
 		var alert Alert
-		err := rows.Scan(&alert.Id, &alert.UserId, &alert.Number, &alert.Symbol, &alert.Description, &alert.TargetPrice, &alert.StartPrice, &alert.Active, &alert.CreatedAt)
+		err := rows.Scan(alertFields(&alert)...)
 		if err != nil {
 			return nil, err
 		}
@@ -241,48 +705,86 @@ func (s *SqliteStore) GetAlertsByUserIdAndSymbolLike(userId int64, symbol string
 
 	return alerts, nil
 }
-func (s *SqliteStore) CreateAlert(alert *Alert) error {
-	var maxNumber int32
-	err := s.db.QueryRow("SELECT IFNULL(MAX(number), 0) FROM alerts WHERE user_id = ?", alert.UserId).Scan(&maxNumber)
+func (s *SqliteStore) GetUserIdsWithAlertsOnSymbol(symbol string) ([]int64, error) {
+	rows, err := s.db.Query(`SELECT DISTINCT user_id FROM alerts WHERE symbol = ? COLLATE NOCASE AND active = TRUE`, symbol)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	alert.Number = maxNumber + 1
+	defer rows.Close()
+
+	var userIds []int64
+	for rows.Next() {
+		var userId int64
+		if err := rows.Scan(&userId); err != nil {
+			return nil, err
+		}
+		userIds = append(userIds, userId)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return userIds, nil
+}
+func (s *SqliteStore) CountActiveAlertsByUserId(userId int64) (int, error) {
+	var count int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM alerts WHERE user_id = ? AND active = TRUE`, userId).Scan(&count)
+	return count, err
+}
+func (s *SqliteStore) CountActiveAlertsByUserIdAndSymbol(userId int64, symbol string) (int, error) {
+	var count int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM alerts WHERE user_id = ? AND symbol = ? COLLATE NOCASE AND active = TRUE`, userId, symbol).Scan(&count)
+	return count, err
+}
+func (s *SqliteStore) CreateAlert(alert *Alert) error {
+	return s.CreateAlerts([]*Alert{alert})
+}
 
+// CreateAlerts stores the alerts in one transaction, numbering them after
+// the existing alerts of their chat.
+func (s *SqliteStore) CreateAlerts(alerts []*Alert) error {
 	tx, err := s.db.Begin()
 	if err != nil {
 		return err
 	}
-	stmt, err := tx.Prepare(`INSERT INTO alerts (id, user_id, number, description, symbol, target_price, start_price, active, created_at, updated_at)
-        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`)
+	stmt, err := tx.Prepare(`INSERT INTO alerts (id, user_id, chat_id, number, description, symbol, target_price, start_price, active, urgent, kind, trail_distance, trail_percent, trail_short, condition, move_percent, move_direction, move_minutes, breakout_side, breakout_days, expires_at, archived_at, active_window, ladder, pnl_amount, pnl_r, pnl_short, moves_fired, high_price, low_price, watched_since, created_at, updated_at)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`)
 	if err != nil {
 		tx.Rollback()
 		return err
 	}
 	defer stmt.Close()
 
-	_, err = stmt.Exec(alert.Id, alert.UserId, alert.Number, alert.Description, alert.Symbol, alert.TargetPrice, alert.StartPrice, alert.Active, alert.CreatedAt, alert.UpdatedAt)
-	if err != nil {
-		tx.Rollback()
-		return err
+	for _, alert := range alerts {
+		var maxNumber int32
+		err := tx.QueryRow("SELECT IFNULL(MAX(number), 0) FROM alerts WHERE chat_id = ?", alert.ChatId).Scan(&maxNumber)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		alert.Number = maxNumber + 1
+
+		_, err = stmt.Exec(alert.Id, alert.UserId, alert.ChatId, alert.Number, alert.Description, alert.Symbol, alert.TargetPrice, alert.StartPrice, alert.Active, alert.Urgent, alert.Kind, alert.Trail.Distance, alert.Trail.Percent, alert.Trail.Short, alert.Condition, alert.Move.Percent, alert.Move.Direction, alert.Move.Minutes, alert.Breakout.Side, alert.Breakout.Days, alert.ExpiresAt, alert.ArchivedAt, alert.Window, alert.Ladder, alert.PnL.Amount, alert.PnL.R, alert.PnL.Short, alert.MovesFired, alert.HighPrice, alert.LowPrice, alert.WatchedSince, alert.CreatedAt, alert.UpdatedAt)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
 	}
 
-	tx.Commit()
-	return nil
+	return tx.Commit()
 }
 func (s *SqliteStore) UpdateAlert(alert *Alert) error {
 	tx, err := s.db.Begin()
 	if err != nil {
 		return err
 	}
-	stmt, err := tx.Prepare(`UPDATE alerts SET description=?, symbol=?, target_price=?, start_price=?, active=? WHERE id=?;`)
+	stmt, err := tx.Prepare(`UPDATE alerts SET description=?, symbol=?, target_price=?, start_price=?, active=?, urgent=?, expires_at=?, archived_at=?, active_window=?, ladder=?, pnl_short=?, moves_fired=?, high_price=?, low_price=?, watched_since=?, updated_at=? WHERE id=?;`)
 	if err != nil {
 		tx.Rollback()
 		return err
 	}
 	defer stmt.Close()
 
-	_, err = stmt.Exec(alert.Description, alert.Symbol, alert.TargetPrice, alert.StartPrice, alert.Active, alert.Id)
+	_, err = stmt.Exec(alert.Description, alert.Symbol, alert.TargetPrice, alert.StartPrice, alert.Active, alert.Urgent, alert.ExpiresAt, alert.ArchivedAt, alert.Window, alert.Ladder, alert.PnL.Short, alert.MovesFired, alert.HighPrice, alert.LowPrice, alert.WatchedSince, alert.UpdatedAt, alert.Id)
 	if err != nil {
 		tx.Rollback()
 		return err
@@ -310,18 +812,227 @@ func (s *SqliteStore) DeleteUserAndAlerts(userId int64) error {
 		return err
 	}
 
-	_, err = tx.Exec(`DELETE FROM alerts WHERE user_id = ?`, userId)
+	// everything stored about the user goes, invites they created stay for
+	// the users who registered with them
+	for _, query := range []string{
+		`DELETE FROM notifications WHERE alert_id IN (SELECT id FROM alerts WHERE user_id = ?)`,
+		`DELETE FROM queued_notifications WHERE alert_id IN (SELECT id FROM alerts WHERE user_id = ?)`,
+		`DELETE FROM preferences WHERE user_id = ?`,
+		`DELETE FROM alerts WHERE user_id = ?`,
+		`DELETE FROM positions WHERE user_id = ?`,
+		`DELETE FROM quota_overrides WHERE user_id = ?`,
+		`DELETE FROM allowlist WHERE user_id = ?`,
+		`DELETE FROM users WHERE user_id = ?`,
+	} {
+		if _, err := tx.Exec(query, userId); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	tx.Commit()
+	return nil
+}
+
+// preferences
+func (s *SqliteStore) GetPreferences(userId int64) (*Preferences, error) {
+	p := Preferences{UserId: userId}
+	err := s.db.QueryRow(`SELECT timezone, language, precision, cards, quiet_start, quiet_end, gaps FROM preferences WHERE user_id = ?`, userId).
+		Scan(&p.Timezone, &p.Language, &p.Precision, &p.Cards, &p.QuietStart, &p.QuietEnd, &p.Gaps)
 	if err != nil {
-		tx.Rollback()
-		return err
+		return nil, err
 	}
+	return &p, nil
+}
+func (s *SqliteStore) SetPreferences(p *Preferences) error {
+	_, err := s.db.Exec(`INSERT INTO preferences (user_id, timezone, language, precision, cards, quiet_start, quiet_end, gaps) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET timezone = excluded.timezone, language = excluded.language, precision = excluded.precision, cards = excluded.cards, quiet_start = excluded.quiet_start, quiet_end = excluded.quiet_end, gaps = excluded.gaps`,
+		p.UserId, p.Timezone, p.Language, p.Precision, p.Cards, p.QuietStart, p.QuietEnd, p.Gaps)
+	return err
+}
 
-	_, err = tx.Exec(`DELETE FROM users WHERE user_id = ?`, userId)
+// sessions
+func (s *SqliteStore) SaveSession(session *Session) error {
+	_, err := s.db.Exec(`INSERT INTO sessions (symbol, day, open, high, low, close, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(symbol, day) DO UPDATE SET open = excluded.open, high = excluded.high, low = excluded.low, close = excluded.close, updated_at = excluded.updated_at`,
+		session.Symbol, session.Day, session.Open, session.High, session.Low, session.Close, session.UpdatedAt)
+	return err
+}
+
+// GetSessions returns the latest sessions of a symbol, newest first.
+func (s *SqliteStore) GetSessions(symbol string, limit int) ([]Session, error) {
+	rows, err := s.db.Query(`SELECT symbol, day, open, high, low, close, updated_at FROM sessions WHERE symbol = ? ORDER BY day DESC LIMIT ?`, symbol, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []Session
+	for rows.Next() {
+		var session Session
+		if err := rows.Scan(&session.Symbol, &session.Day, &session.Open, &session.High, &session.Low, &session.Close, &session.UpdatedAt); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// positions
+const positionColumns = "user_id, symbol, short, size, entry, stop, created_at, updated_at"
+
+func positionFields(p *Position) []any {
+	return []any{&p.UserId, &p.Symbol, &p.Short, &p.Size, &p.Entry, &p.Stop, &p.CreatedAt, &p.UpdatedAt}
+}
+
+func (s *SqliteStore) GetPosition(userId int64, symbol string) (*Position, error) {
+	var p Position
+	if err := s.db.QueryRow("SELECT "+positionColumns+" FROM positions WHERE user_id = ? AND symbol = ?", userId, symbol).Scan(positionFields(&p)...); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// GetPositionsByUserId returns the positions of a user by symbol.
+func (s *SqliteStore) GetPositionsByUserId(userId int64) ([]Position, error) {
+	rows, err := s.db.Query("SELECT "+positionColumns+" FROM positions WHERE user_id = ? ORDER BY symbol", userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var positions []Position
+	for rows.Next() {
+		var p Position
+		if err := rows.Scan(positionFields(&p)...); err != nil {
+			return nil, err
+		}
+		positions = append(positions, p)
+	}
+	return positions, rows.Err()
+}
+
+func (s *SqliteStore) SetPosition(p *Position) error {
+	_, err := s.db.Exec(`INSERT INTO positions (`+positionColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(user_id, symbol) DO UPDATE SET short = excluded.short, size = excluded.size, entry = excluded.entry, stop = excluded.stop, updated_at = excluded.updated_at`,
+		p.UserId, p.Symbol, p.Short, p.Size, p.Entry, p.Stop, p.CreatedAt, p.UpdatedAt)
+	return err
+}
+
+func (s *SqliteStore) DeletePosition(userId int64, symbol string) error {
+	_, err := s.db.Exec(`DELETE FROM positions WHERE user_id = ? AND symbol = ?`, userId, symbol)
+	return err
+}
+
+// notifications and stats
+func (s *SqliteStore) CreateNotification(n *Notification) error {
+	res, err := s.db.Exec(`INSERT INTO notifications (alert_id, chat_id, kind, delivered, error, created_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		n.AlertId, n.ChatId, n.Kind, n.Delivered, n.Error, n.CreatedAt)
+	if err != nil {
+		return err
+	}
+	n.Id, err = res.LastInsertId()
+	return err
+}
+func (s *SqliteStore) QueueNotification(q *QueuedNotification) error {
+	res, err := s.db.Exec(`INSERT INTO queued_notifications (alert_id, chat_id, kind, text, created_at) VALUES (?, ?, ?, ?, ?)`,
+		q.AlertId, q.ChatId, q.Kind, q.Text, q.CreatedAt)
 	if err != nil {
-		tx.Rollback()
 		return err
 	}
+	q.Id, err = res.LastInsertId()
+	return err
+}
+func (s *SqliteStore) GetQueuedNotifications() ([]QueuedNotification, error) {
+	rows, err := s.db.Query(`SELECT id, alert_id, chat_id, kind, text, attempts, created_at FROM queued_notifications ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-	tx.Commit()
-	return nil
+	var queued []QueuedNotification
+	for rows.Next() {
+		var q QueuedNotification
+		if err := rows.Scan(&q.Id, &q.AlertId, &q.ChatId, &q.Kind, &q.Text, &q.Attempts, &q.CreatedAt); err != nil {
+			return nil, err
+		}
+		queued = append(queued, q)
+	}
+	return queued, rows.Err()
+}
+func (s *SqliteStore) RetryQueuedNotification(id int64) error {
+	_, err := s.db.Exec(`UPDATE queued_notifications SET attempts = attempts + 1 WHERE id = ?`, id)
+	return err
+}
+func (s *SqliteStore) DeleteQueuedNotification(id int64) error {
+	_, err := s.db.Exec(`DELETE FROM queued_notifications WHERE id = ?`, id)
+	return err
+}
+func (s *SqliteStore) GetNotificationsByUserId(userId int64) ([]Notification, error) {
+	rows, err := s.db.Query(`SELECT n.id, IFNULL(n.alert_id, ''), IFNULL(n.chat_id, 0), n.kind, n.delivered, IFNULL(n.error, ''), n.created_at
+		FROM notifications n JOIN alerts a ON a.id = n.alert_id WHERE a.user_id = ? ORDER BY n.id`, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notifications []Notification
+	for rows.Next() {
+		var n Notification
+		if err := rows.Scan(&n.Id, &n.AlertId, &n.ChatId, &n.Kind, &n.Delivered, &n.Error, &n.CreatedAt); err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
+func (s *SqliteStore) GetStats(now time.Time) (*Stats, error) {
+	var stats Stats
+	err := s.db.QueryRow(`SELECT COUNT(*), IFNULL(SUM(CASE WHEN IFNULL(active, TRUE) THEN 1 ELSE 0 END), 0) FROM users`).
+		Scan(&stats.TotalUsers, &stats.ActiveUsers)
+	if err != nil {
+		return nil, err
+	}
+	// archived alerts are inactive too, but did not trigger
+	err = s.db.QueryRow(`SELECT IFNULL(SUM(CASE WHEN active THEN 1 ELSE 0 END), 0), IFNULL(SUM(CASE WHEN NOT active AND archived_at IS NULL THEN 1 ELSE 0 END), 0), IFNULL(SUM(CASE WHEN archived_at IS NOT NULL THEN 1 ELSE 0 END), 0) FROM alerts`).
+		Scan(&stats.ActiveAlerts, &stats.TriggeredAlerts, &stats.ArchivedAlerts)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(`SELECT LOWER(symbol), COUNT(*) AS watchers FROM alerts WHERE active = TRUE GROUP BY LOWER(symbol) ORDER BY watchers DESC, LOWER(symbol)`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var sc SymbolCount
+		if err := rows.Scan(&sc.Symbol, &sc.Count); err != nil {
+			return nil, err
+		}
+		stats.AlertsBySymbol = append(stats.AlertsBySymbol, sc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, window := range []struct {
+		since            time.Time
+		triggers, failed *int
+	}{
+		{now.Add(-24 * time.Hour), &stats.Triggers24h, &stats.Failures24h},
+		{now.Add(-7 * 24 * time.Hour), &stats.Triggers7d, &stats.Failures7d},
+	} {
+		err := s.db.QueryRow(`SELECT COUNT(DISTINCT CASE WHEN kind = ? THEN alert_id END), IFNULL(SUM(CASE WHEN delivered THEN 0 ELSE 1 END), 0) FROM notifications WHERE created_at >= ?`, NotificationTrigger, window.since).
+			Scan(window.triggers, window.failed)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = s.db.QueryRow(`SELECT page_count * page_size FROM pragma_page_count(), pragma_page_size()`).Scan(&stats.DatabaseSizeByte)
+	if err != nil {
+		return nil, err
+	}
+	return &stats, nil
 }
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+type AssetClass string
+
+const (
+	AssetForex     AssetClass = "forex"
+	AssetMetal     AssetClass = "metal"
+	AssetEnergy    AssetClass = "energy"
+	AssetCommodity AssetClass = "commodity"
+	AssetCrypto    AssetClass = "crypto"
+	AssetSynthetic AssetClass = "synthetic"
+)
+
+// SymbolMeta describes how the prices of a symbol are quoted.
+type SymbolMeta struct {
+	// TickSize is the smallest step the price moves in
+	TickSize float64 `json:"tick_size"`
+	// Decimals is the number of decimals prices are shown with
+	Decimals int `json:"decimals"`
+	// PipSize is the conventional unit price moves are counted in
+	PipSize       float64    `json:"pip_size"`
+	QuoteCurrency string     `json:"quote_currency"`
+	AssetClass    AssetClass `json:"asset_class"`
+}
+
+// futuresMeta holds the contract specs of the continuous futures scraped
+// from the metals and energy pages, keyed by symbol without the "!".
+var futuresMeta = map[string]SymbolMeta{
+	"gc1":  {TickSize: 0.1, Decimals: 1, PipSize: 0.1, QuoteCurrency: "USD", AssetClass: AssetMetal},
+	"si1":  {TickSize: 0.005, Decimals: 3, PipSize: 0.01, QuoteCurrency: "USD", AssetClass: AssetMetal},
+	"hg1":  {TickSize: 0.0005, Decimals: 4, PipSize: 0.001, QuoteCurrency: "USD", AssetClass: AssetMetal},
+	"pl1":  {TickSize: 0.1, Decimals: 1, PipSize: 0.1, QuoteCurrency: "USD", AssetClass: AssetMetal},
+	"pa1":  {TickSize: 0.5, Decimals: 1, PipSize: 0.5, QuoteCurrency: "USD", AssetClass: AssetMetal},
+	"ali1": {TickSize: 0.25, Decimals: 2, PipSize: 0.25, QuoteCurrency: "USD", AssetClass: AssetMetal},
+	"cl1":  {TickSize: 0.01, Decimals: 2, PipSize: 0.01, QuoteCurrency: "USD", AssetClass: AssetEnergy},
+	"bz1":  {TickSize: 0.01, Decimals: 2, PipSize: 0.01, QuoteCurrency: "USD", AssetClass: AssetEnergy},
+	"ng1":  {TickSize: 0.001, Decimals: 3, PipSize: 0.001, QuoteCurrency: "USD", AssetClass: AssetEnergy},
+	"rb1":  {TickSize: 0.0001, Decimals: 4, PipSize: 0.0001, QuoteCurrency: "USD", AssetClass: AssetEnergy},
+	"ho1":  {TickSize: 0.0001, Decimals: 4, PipSize: 0.0001, QuoteCurrency: "USD", AssetClass: AssetEnergy},
+}
+
+// lookupSymbolMeta returns the metadata of a symbol: forex pairs follow the
+// pip conventions of their quote currency, known futures come from
+// futuresMeta and the rest is derived from the magnitude of the price.
+func lookupSymbolMeta(symbol, category string, price float64) SymbolMeta {
+	symbol = strings.ToLower(symbol)
+	switch category {
+	case "forex":
+		meta := SymbolMeta{TickSize: 0.00001, Decimals: 5, PipSize: 0.0001, AssetClass: AssetForex}
+		if len(symbol) == 6 {
+			meta.QuoteCurrency = strings.ToUpper(symbol[3:])
+		}
+		if meta.QuoteCurrency == "JPY" {
+			meta.TickSize, meta.Decimals, meta.PipSize = 0.001, 3, 0.01
+		}
+		return meta
+	case "feature":
+		if meta, exist := futuresMeta[symbol]; exist {
+			return meta
+		}
+		return priceMeta(price, AssetCommodity)
+	default:
+		return priceMeta(price, AssetCrypto)
+	}
+}
+
+// priceMeta quotes prices with about six significant digits and at least
+// two decimals, for symbols without a known tick size.
+func priceMeta(price float64, class AssetClass) SymbolMeta {
+	decimals := autoDecimals(price)
+	tick := math.Pow10(-decimals)
+	return SymbolMeta{TickSize: tick, Decimals: decimals, PipSize: tick, QuoteCurrency: "USD", AssetClass: class}
+}
+
+func autoDecimals(price float64) int {
+	if price <= 0 {
+		return 5
+	}
+	decimals := 5 - int(math.Floor(math.Log10(price)))
+	return max(2, min(decimals, maxPrecision))
+}
+
+func (m SymbolMeta) Format(price float64) string {
+	return strconv.FormatFloat(price, 'f', m.Decimals, 64)
+}
+
+// OnTick reports whether a price is a whole number of ticks.
+func (m SymbolMeta) OnTick(price float64) bool {
+	if m.TickSize <= 0 {
+		return true
+	}
+	ticks := price / m.TickSize
+	return math.Abs(ticks-math.Round(ticks)) < 1e-6
+}
+
+// Tolerance is how far apart two prices may be and still be the same quote.
+func (m SymbolMeta) Tolerance() float64 {
+	return m.TickSize / 2
+}
+
+// Pips converts a price difference to pips.
+func (m SymbolMeta) Pips(diff float64) float64 {
+	if m.PipSize <= 0 {
+		return 0
+	}
+	return diff / m.PipSize
+}
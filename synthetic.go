@@ -0,0 +1,151 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"time"
+)
+
+// Synthetic tickers are derived from the live prices of two tickers in the
+// registry: `a/b` is the ratio and `a-b` the spread of their prices.
+const (
+	syntheticRatio  = "/"
+	syntheticSpread = "-"
+)
+
+// SyntheticTicker is a synthetic ticker listed in /viewsymbols under a name.
+type SyntheticTicker struct {
+	Symbol string
+	Name   string
+}
+
+// builtinSynthetics are kept in every snapshot of the registry; any other
+// pair of tickers can be used as well, named after its inputs.
+var builtinSynthetics = []SyntheticTicker{
+	{Symbol: "gc1/si1", Name: "gold/silver ratio"},
+	{Symbol: "pl1/gc1", Name: "platinum/gold ratio"},
+	{Symbol: "bz1-cl1", Name: "brent/wti spread"},
+	{Symbol: "eurusd-gbpusd", Name: "euro/pound spread"},
+	{Symbol: "btc/eth", Name: "bitcoin/ether ratio"},
+}
+
+// underivedBuiltins are the built-in synthetic tickers that could not be
+// derived on the last check, so each change is only logged once.
+var underivedBuiltins = make(map[string]bool)
+
+// checkBuiltinSynthetics logs the built-in synthetic tickers whose inputs
+// are missing from a snapshot of the registry, and those that recovered.
+func checkBuiltinSynthetics(snapshot map[string]*Ticker) {
+	if len(snapshot) == 0 {
+		return
+	}
+	for _, s := range builtinSynthetics {
+		_, exist := snapshot[s.Symbol]
+		if exist == !underivedBuiltins[s.Symbol] {
+			continue
+		}
+		underivedBuiltins[s.Symbol] = !exist
+		if exist {
+			log.Printf("Synthetic ticker %s is derived again", s.Symbol)
+		} else {
+			log.Printf("Synthetic ticker %s can not be derived, an input is missing or has no price", s.Symbol)
+		}
+	}
+}
+
+// splitSynthetic splits a synthetic symbol into its inputs and operator.
+func splitSynthetic(symbol string) (left, op, right string, ok bool) {
+	for _, op := range []string{syntheticRatio, syntheticSpread} {
+		if left, right, found := strings.Cut(symbol, op); found && left != "" && right != "" && !strings.ContainsAny(right, syntheticRatio+syntheticSpread) {
+			return left, op, right, true
+		}
+	}
+	return "", "", "", false
+}
+
+// deriveSynthetic computes the ticker of a synthetic symbol from the
+// tickers of its inputs in registry. It is only as fresh as the older of
+// its inputs, so a stale input makes it stale as well.
+func deriveSynthetic(symbol string, registry map[string]*Ticker) (*Ticker, bool) {
+	leftSymbol, op, rightSymbol, ok := splitSynthetic(symbol)
+	if !ok {
+		return nil, false
+	}
+	left, leftExist := registry[leftSymbol]
+	right, rightExist := registry[rightSymbol]
+	if !leftExist || !rightExist || left.Category == "synthetic" || right.Category == "synthetic" {
+		return nil, false
+	}
+	if op == syntheticRatio && (left.LivePrice == 0 || right.LivePrice == 0 || right.PrevPrice == 0) {
+		return nil, false
+	}
+	combine := func(l, r float64) float64 {
+		if op == syntheticRatio {
+			return l / r
+		}
+		return l - r
+	}
+
+	name := left.Name + " " + op + " " + right.Name
+	for _, s := range builtinSynthetics {
+		if s.Symbol == symbol {
+			name = s.Name
+		}
+	}
+	t := &Ticker{
+		Symbol:    symbol,
+		Name:      name,
+		Category:  "synthetic",
+		LivePrice: combine(left.LivePrice, right.LivePrice),
+		PrevPrice: combine(left.PrevPrice, right.PrevPrice),
+		// the prices traded between two updates of the inputs don't
+		// combine, only their quotes do
+		PrevUpdatedAt: earliest(left.PrevUpdatedAt, right.PrevUpdatedAt),
+		CreatedAt:     latest(left.CreatedAt, right.CreatedAt),
+		UpdatedAt:     earliest(left.UpdatedAt, right.UpdatedAt),
+	}
+	t.RangeHigh, t.RangeLow = max(t.PrevPrice, t.LivePrice), min(t.PrevPrice, t.LivePrice)
+	t.Gap = left.Gap || right.Gap
+	if t.Gap {
+		t.RangeHigh, t.RangeLow = t.LivePrice, t.LivePrice
+	}
+	t.Meta = syntheticMeta(op, left.Meta, right.Meta, t.LivePrice)
+	return t, true
+}
+
+// syntheticMeta quotes ratios like symbols without a known tick size and
+// spreads in the finer tick of their inputs.
+func syntheticMeta(op string, left, right SymbolMeta, price float64) SymbolMeta {
+	if op == syntheticRatio {
+		meta := priceMeta(price, AssetSynthetic)
+		meta.QuoteCurrency = ""
+		return meta
+	}
+	meta := SymbolMeta{
+		TickSize:   min(left.TickSize, right.TickSize),
+		Decimals:   max(left.Decimals, right.Decimals),
+		PipSize:    min(left.TickSize, right.TickSize),
+		AssetClass: AssetSynthetic,
+	}
+	if left.PipSize == right.PipSize {
+		meta.PipSize = left.PipSize
+	}
+	if left.QuoteCurrency == right.QuoteCurrency {
+		meta.QuoteCurrency = left.QuoteCurrency
+	}
+	return meta
+}
+
+func earliest(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+func latest(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestDeriveSynthetic(t *testing.T) {
+	now := time.Now().UTC()
+	registry := map[string]*Ticker{
+		"gc1":    {Symbol: "gc1", Name: "gold", Category: "feature", LivePrice: 2400, PrevPrice: 2390, Meta: futuresMeta["gc1"], UpdatedAt: now, PrevUpdatedAt: now.Add(-5 * time.Minute)},
+		"si1":    {Symbol: "si1", Name: "silver", Category: "feature", LivePrice: 30, PrevPrice: 29.875, Meta: futuresMeta["si1"], UpdatedAt: now.Add(-time.Minute), PrevUpdatedAt: now.Add(-6 * time.Minute)},
+		"eurusd": {Symbol: "eurusd", Name: "euro", Category: "forex", LivePrice: 1.085, PrevPrice: 1.084, Meta: lookupSymbolMeta("eurusd", "forex", 1.085), UpdatedAt: now.Add(-20 * time.Minute)},
+		"gbpusd": {Symbol: "gbpusd", Name: "pound", Category: "forex", LivePrice: 1.27, PrevPrice: 1.2705, Meta: lookupSymbolMeta("gbpusd", "forex", 1.27), UpdatedAt: now},
+	}
+	tests := []struct {
+		symbol    string
+		name      string
+		live      float64
+		prev      float64
+		tick      float64
+		updatedAt time.Time
+		stale     bool
+	}{
+		{symbol: "gc1/si1", name: "gold/silver ratio", live: 80, prev: 2390 / 29.875, tick: 0.0001, updatedAt: now.Add(-time.Minute)},
+		{symbol: "si1/gc1", name: "silver / gold", live: 0.0125, prev: 29.875 / 2390, tick: 0.0000001, updatedAt: now.Add(-time.Minute)},
+		{symbol: "eurusd-gbpusd", name: "euro/pound spread", live: 1.085 - 1.27, prev: 1.084 - 1.2705, tick: 0.00001, updatedAt: now.Add(-20 * time.Minute), stale: true},
+	}
+	for _, tt := range tests {
+		ticker, exist := deriveSynthetic(tt.symbol, registry)
+		if !exist {
+			t.Errorf("%s: not derived", tt.symbol)
+			continue
+		}
+		if ticker.Name != tt.name || ticker.Category != "synthetic" {
+			t.Errorf("%s: name %q category %q, want %q synthetic", tt.symbol, ticker.Name, ticker.Category, tt.name)
+		}
+		if math.Abs(ticker.LivePrice-tt.live) > 1e-9 || math.Abs(ticker.PrevPrice-tt.prev) > 1e-9 {
+			t.Errorf("%s: prices %g, %g, want %g, %g", tt.symbol, ticker.LivePrice, ticker.PrevPrice, tt.live, tt.prev)
+		}
+		if math.Abs(ticker.Meta.TickSize-tt.tick) > 1e-12 {
+			t.Errorf("%s: tick %g, want %g", tt.symbol, ticker.Meta.TickSize, tt.tick)
+		}
+		if !ticker.UpdatedAt.Equal(tt.updatedAt) || ticker.Stale(now) != tt.stale {
+			t.Errorf("%s: updated %s stale %t, want %s %t", tt.symbol, ticker.UpdatedAt, ticker.Stale(now), tt.updatedAt, tt.stale)
+		}
+	}
+
+	for _, symbol := range []string{"gc1", "gc1/xyz", "/si1", "gc1-", "gc1/si1/si1"} {
+		if _, exist := deriveSynthetic(symbol, registry); exist {
+			t.Errorf("%s: derived, want none", symbol)
+		}
+	}
+}
+
+func TestCheckBuiltinSynthetics(t *testing.T) {
+	defer clear(underivedBuiltins)
+	for _, s := range builtinSynthetics {
+		if _, _, _, ok := splitSynthetic(s.Symbol); !ok {
+			t.Errorf("built-in %s is not a ratio or spread", s.Symbol)
+		}
+	}
+	snapshot := map[string]*Ticker{"gc1/si1": {Symbol: "gc1/si1"}}
+	checkBuiltinSynthetics(snapshot)
+	if underivedBuiltins["gc1/si1"] || !underivedBuiltins["btc/eth"] {
+		t.Errorf("underived built-ins %v", underivedBuiltins)
+	}
+	snapshot["btc/eth"] = &Ticker{Symbol: "btc/eth"}
+	checkBuiltinSynthetics(snapshot)
+	if underivedBuiltins["btc/eth"] {
+		t.Errorf("btc/eth still underived")
+	}
+}
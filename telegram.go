@@ -5,6 +5,7 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"html"
 	"log"
 	"os"
 	"strconv"
@@ -15,38 +16,40 @@ import (
 )
 
 type TelegramBot struct {
-	bot   *tgbotapi.BotAPI
-	store Storage
+	bot          *tgbotapi.BotAPI
+	store        Storage
+	registration RegistrationMode
+	limiter      *RateLimiter
 }
 
 var (
 	// Database connection
-	// Menu texts
-	firstMenu = "<b>Main Menu</b>\n\nChoose an option."
-	alertMenu = "<b>Alert Menu</b>\n\n1. Add Alert\n2. View Alerts\n3. Update Alert\n4. Delete Alert\n\nUse /addalert, /viewalerts, /updatealert, /deletealert commands respectively."
-
-	// Button texts
+	// Button data
 	alertButton = "Manage Alerts"
 
 	// Store bot screaming status
 	screaming = false
+)
 
-	// Keyboard layout for the main menu
-	mainMenuMarkup = tgbotapi.NewInlineKeyboardMarkup(
+// mainMenuMarkup is the keyboard layout for the main menu.
+func mainMenuMarkup(lang string) tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData(alertButton, alertButton),
+			tgbotapi.NewInlineKeyboardButtonData(T(lang, "menu.alert_button"), alertButton),
 		),
 	)
-)
+}
 
-func NewTelegramBot(store Storage, apiKey string) (*TelegramBot, error) {
+func NewTelegramBot(store Storage, apiKey string, registration RegistrationMode) (*TelegramBot, error) {
 	bot, err := tgbotapi.NewBotAPI(apiKey)
 	if err != nil {
 		return nil, err
 	}
 	return &TelegramBot{
-		store: store,
-		bot:   bot,
+		store:        store,
+		bot:          bot,
+		registration: registration,
+		limiter:      NewRateLimiter(),
 	}, nil
 }
 
@@ -62,8 +65,13 @@ func (b *TelegramBot) Run() {
 
 	updates := b.bot.GetUpdatesChan(u)
 
+	if err := b.publishCommands(); err != nil {
+		log.Printf("Error publishing bot commands: %s", err.Error())
+	}
+
 	go b.receiveUpdates(ctx, updates)
 	go b.startAlertChecker()
+	go b.startDeletionPurger()
 
 	log.Println("Start listening for updates.")
 
@@ -88,6 +96,8 @@ func (b *TelegramBot) handleUpdate(update tgbotapi.Update) {
 		b.handleMessage(update.Message)
 	case update.CallbackQuery != nil:
 		b.handleButton(update.CallbackQuery)
+	case update.InlineQuery != nil:
+		b.handleInlineQuery(update.InlineQuery)
 	}
 }
 func (b *TelegramBot) handleMessage(message *tgbotapi.Message) {
@@ -97,15 +107,14 @@ func (b *TelegramBot) handleMessage(message *tgbotapi.Message) {
 	log.Printf("id: %d, %s wrote %s", user.ID, user.FirstName, text)
 
 	var err error
-	if strings.HasPrefix(text, "/") {
-		err = b.handleCommand(message.Chat.ID, user.ID, text, user.UserName, user.FirstName, user.LastName)
+	if b.isImportReply(message) {
+		err = b.importFromReply(message)
+	} else if strings.HasPrefix(message.Text, "/") || strings.HasPrefix(message.Caption, "/") {
+		err = b.handleCommand(message)
 	} else if screaming && len(text) > 0 {
 		msg := tgbotapi.NewMessage(message.Chat.ID, strings.ToUpper(text))
 		msg.Entities = message.Entities
 		_, err = b.bot.Send(msg)
-	} else {
-		copyMsg := tgbotapi.NewCopyMessage(message.Chat.ID, message.Chat.ID, message.MessageID)
-		_, err = b.bot.CopyMessage(copyMsg)
 	}
 
 	if err != nil {
@@ -113,16 +122,34 @@ func (b *TelegramBot) handleMessage(message *tgbotapi.Message) {
 	}
 }
 func (b *TelegramBot) handleButton(query *tgbotapi.CallbackQuery) {
+	if strings.HasPrefix(query.Data, broadcastCallbackPrefix) {
+		b.handleBroadcastButton(query)
+		return
+	}
+	if strings.HasPrefix(query.Data, importCallbackPrefix) {
+		b.handleImportButton(query)
+		return
+	}
+	if strings.HasPrefix(query.Data, deleteAccountCallbackPrefix) {
+		b.handleDeleteAccountButton(query)
+		return
+	}
+	if strings.HasPrefix(query.Data, settingsCallbackPrefix) {
+		b.handleSettingsButton(query)
+		return
+	}
+
 	var text string
 	markup := tgbotapi.NewInlineKeyboardMarkup()
 	message := query.Message
+	lang := b.language(query.From.ID, query.From.LanguageCode)
 
 	switch query.Data {
 	case alertButton:
-		text = alertMenu
+		text = T(lang, "menu.alerts")
 	default:
-		text = firstMenu
-		markup = mainMenuMarkup
+		text = T(lang, "menu.main")
+		markup = mainMenuMarkup(lang)
 	}
 
 	callbackCfg := tgbotapi.NewCallback(query.ID, "")
@@ -132,252 +159,412 @@ func (b *TelegramBot) handleButton(query *tgbotapi.CallbackQuery) {
 	msg.ParseMode = tgbotapi.ModeHTML
 	b.bot.Send(msg)
 }
-func (b *TelegramBot) handleCommand(chatId int64, userId int64, command, username, fisrtname, lastname string) error {
-	var err error
-	var commandParts []string
-	parts := strings.Split(command, " ")
-	for _, part := range parts {
-		commandParts = append(commandParts, strings.ToLower(strings.TrimSpace(part)))
+func (b *TelegramBot) handleCommand(message *tgbotapi.Message) error {
+	chatId, userId := message.Chat.ID, message.From.ID
+	text := message.Text
+	if text == "" {
+		// commands can be sent as the caption of a document
+		text = message.Caption
+	}
+	lang := b.language(userId, message.From.LanguageCode)
+	parsed, err := ParseCommand(text)
+	if err != nil {
+		return b.sendMessage(chatId, T(lang, "command.unreadable"))
+	}
+	// in groups commands may be addressed to another bot
+	if parsed.Mention != "" && !strings.EqualFold(parsed.Mention, b.bot.Self.UserName) {
+		return nil
+	}
+	if !b.allowCommand(chatId, userId, message.From.LanguageCode) {
+		return nil
 	}
-	var mainCommand = commandParts[0]
 
-	switch {
-	case mainCommand == "/start":
-		err = b.registerUser(chatId, userId, username, fisrtname, lastname)
-	case mainCommand == "/viewuser":
-		err = b.viewUser(chatId, userId)
-	case mainCommand == "/viewusers":
-		err = b.viewUsers(chatId, userId)
-	case mainCommand == "/deleteuser":
-		err = b.deleteUser(chatId, userId)
-	case mainCommand == "/createalert":
-		err = b.createAlert(chatId, userId, commandParts[1:])
-	case mainCommand == "/viewalerts":
-		err = b.viewAlerts(chatId, userId, commandParts[1:])
-	case mainCommand == "/updatealert":
-		err = b.updateAlert(chatId, userId, commandParts[1:])
-	case mainCommand == "/deletealert":
-		err = b.deleteAlert(chatId, userId, commandParts[1:])
-	case mainCommand == "/viewsymbols":
-		err = b.viewSymbols(chatId, userId, commandParts[1:])
-	default:
+	cmd, exist := commandByName[parsed.Name]
+	if !exist {
 		// Handle unknown commands or provide instructions
-		return b.sendMessage(chatId, "Unknown command. Available commands: /start, /createalert, /updatealert, /deletealert, /viewalerts, /viewsymbols")
+		var names []string
+		for _, c := range visibleCommands(b.userRole(userId)) {
+			names = append(names, "/"+c.Name)
+		}
+		return b.sendMessage(chatId, T(lang, "command.unknown", "commands", strings.Join(names, ", ")))
 	}
 
-	return err
+	args, err := validateArgs(cmd.Args, parsed.Args, parsed.Rest)
+	if err == nil {
+		parsed.Flags, err = validateFlags(cmd.Flags, parsed.Flags)
+	}
+	if err != nil {
+		reason := err.Error()
+		if argErr, ok := err.(*ArgError); ok {
+			reason = argErr.Localize(lang)
+		}
+		return b.sendMessage(chatId, T(lang, "command.invalid_arg", "error", reason, "usage", cmd.usage()))
+	}
+
+	c := &CommandContext{
+		Command:      cmd,
+		ChatId:       chatId,
+		ChatType:     message.Chat.Type,
+		UserId:       userId,
+		Username:     message.From.UserName,
+		Firstname:    message.From.FirstName,
+		Lastname:     message.From.LastName,
+		LanguageCode: message.From.LanguageCode,
+		Lang:         lang,
+		Message:      message,
+		Args:         args,
+		Flags:        parsed.Flags,
+	}
+	if ok, err := b.authorize(c); !ok {
+		return err
+	}
+	return cmd.Handler(b, c)
 }
 
-func (b *TelegramBot) checkUser(userID, chatId int64) (*User, error) {
+func (b *TelegramBot) checkUser(userID, chatId int64, lang string) (*User, error) {
 	user, err := b.store.GetUserByUserId(userID)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, b.sendMessage(chatId, "You are not registered.\nUsage: /start")
+			return nil, b.sendMessage(chatId, T(lang, "user.not_registered"))
 		}
 		return nil, err
 	}
 	return user, nil
 }
 
+// alertChat resolves the chat whose alerts a command works on: the chat the
+// command was sent in, or the group or channel given with --chat. Members may
+// view the alerts of a group or channel, managing them is reserved for its
+// administrators. A zero chat id means the user has already been told why.
+func (b *TelegramBot) alertChat(c *CommandContext, manage bool) (int64, error) {
+	chatId := c.ChatId
+	if target, ok := c.Flags["chat"]; ok {
+		var config tgbotapi.ChatInfoConfig
+		if id, err := strconv.ParseInt(target, 10, 64); err == nil {
+			config.ChatID = id
+		} else {
+			config.SuperGroupUsername = "@" + strings.TrimPrefix(target, "@")
+		}
+		chat, err := b.bot.GetChat(config)
+		if err != nil {
+			return 0, b.sendMessage(c.ChatId, c.T("chat.not_found"))
+		}
+		chatId = chat.ID
+	}
+	if chatId == c.UserId {
+		return chatId, nil
+	}
+
+	member, err := b.bot.GetChatMember(tgbotapi.GetChatMemberConfig{
+		ChatConfigWithUser: tgbotapi.ChatConfigWithUser{ChatID: chatId, UserID: c.UserId},
+	})
+	if err != nil {
+		return 0, err
+	}
+	isAdmin := member.IsCreator() || member.IsAdministrator()
+	if manage && !isAdmin {
+		return 0, b.sendMessage(c.ChatId, c.T("chat.admins_only"))
+	}
+	if !isAdmin && (member.HasLeft() || member.WasKicked()) {
+		return 0, b.sendMessage(c.ChatId, c.T("chat.not_member"))
+	}
+	return chatId, nil
+}
+
 // crud on user
-func (b *TelegramBot) registerUser(chatId, userId int64, username, fisrtname, lastname string) error {
+func (b *TelegramBot) registerUser(c *CommandContext) error {
+	chatId, userId := c.ChatId, c.UserId
 	user, err := b.store.GetUserByUserId(userId)
 	if err != nil && err != sql.ErrNoRows {
 		return err
 	}
 	if user != nil {
-		return b.sendMessage(chatId, "You are already registered.")
+		if user.Role == RoleBanned {
+			return b.sendMessage(chatId, c.T("user.banned"))
+		}
+		if user.DeleteAt != nil {
+			return b.restoreUser(c, user)
+		}
+		if !user.Active {
+			if err := b.store.SetUserActive(userId, true); err != nil {
+				return err
+			}
+			return b.sendMessage(chatId, c.T("user.welcome_back"))
+		}
+		return b.sendMessage(chatId, c.T("user.already_registered"))
 	}
 
-	newUser, err := NewUser(userId, username, fisrtname, lastname, "default_pass")
+	newUser, err := NewUser(userId, c.Username, c.Firstname, c.Lastname, "default_pass")
 	if err != nil {
-		return b.sendMessage(chatId, "Error creating user object.")
+		return b.sendMessage(chatId, c.T("user.create_failed"))
+	}
+	newUser.LanguageCode = c.LanguageCode
+
+	// deep links t.me/<bot>?start=<code> arrive as /start <code>
+	if len(c.Args) > 0 && c.Args[0] != inlineStartParameter {
+		if err := b.store.RedeemInvite(c.Args[0], newUser); err != nil {
+			if err == ErrInviteInvalid {
+				return b.sendMessage(chatId, c.T("invite.invalid_link"))
+			}
+			return b.sendMessage(chatId, c.T("user.store_failed"))
+		}
+		return b.sendMessage(chatId, c.T("user.registered_as", "role", newUser.Role))
+	}
+
+	switch b.registration {
+	case RegistrationInvite:
+		return b.sendMessage(chatId, c.T("registration.invite_only"))
+	case RegistrationAllowlist:
+		allowed, err := b.store.IsAllowlisted(userId)
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			return b.sendMessage(chatId, c.T("registration.allowlist", "user_id", userId))
+		}
 	}
 
 	if err := b.store.CreateUser(*newUser); err != nil {
-		return b.sendMessage(chatId, "Error storing user to DB.")
+		return b.sendMessage(chatId, c.T("user.store_failed"))
 	}
-	return b.sendMessage(chatId, "You have been registered successfully.")
+	return b.sendMessage(chatId, c.T("user.registered"))
 }
-func (b *TelegramBot) viewUser(chatId, userId int64) error {
-	user, err := b.checkUser(userId, chatId)
-	if user == nil {
-		return err
-	}
-	return b.sendMessage(chatId, user.toTelegramString())
+func (b *TelegramBot) viewUser(c *CommandContext) error {
+	return b.sendMessage(c.ChatId, c.User.toTelegramString(c.Lang))
 }
-func (b *TelegramBot) viewUsers(chatId, userId int64) error {
-	user, err := b.checkUser(userId, chatId)
-	if user == nil {
-		return err
-	}
-	if !user.IsAdmin {
-		return b.sendMessage(chatId, "Permission denied!")
-	}
+func (b *TelegramBot) viewUsers(c *CommandContext) error {
+	chatId := c.ChatId
 	users, err := b.store.GetUsers()
 	if err != nil {
 		return err
 	}
 	var usersStrings []string
 	for _, u := range users {
-		usersStrings = append(usersStrings, u.toTelegramString())
+		usersStrings = append(usersStrings, u.toTelegramString(c.Lang))
 	}
 
 	return b.sendMessageInChunks(chatId, strings.Join(usersStrings, "\n\n"))
 }
 
-func (b *TelegramBot) deleteUser(chatId, userId int64) error {
-	user, err := b.checkUser(userId, chatId)
-	if err != nil {
-		return err
-	}
-	if err := b.store.DeleteUserAndAlerts(user.UserId); err != nil {
-		return b.sendMessage(chatId, "User data can not be deleted.")
-	}
-	return b.sendMessage(chatId, "User and all associated alerts have been deleted successfully.")
-}
-
 // crud alert
-func (b *TelegramBot) createAlert(chatId, userId int64, command []string) error {
-	user, err := b.checkUser(userId, chatId)
-	if user == nil {
+func (b *TelegramBot) createAlert(c *CommandContext) error {
+	chatId, userId, command := c.ChatId, c.UserId, c.Args
+	alertChatId, err := b.alertChat(c, true)
+	if alertChatId == 0 {
 		return err
 	}
 
 	// Extract alert details from the command
 	if len(command) < 2 {
-		return b.sendMessage(chatId, "Usage: /createalert <ticker> <traget_price> <description>")
+		return b.sendUsage(c)
 	}
 
 	tickerSymbol := command[0]
-	t, exist := tickers[tickerSymbol]
+	t, exist := getTicker(tickerSymbol)
 	if !exist {
-		return b.sendMessage(chatId, "Symbol not found, please try later or insert valid symbol.")
+		return b.sendMessage(chatId, c.T("symbol.not_found"))
+	}
+	if ok, err := b.checkAlertQuota(c, t.Symbol); !ok {
+		return err
+	}
+	switch command[1] {
+	case "trail":
+		return b.createTrailingStop(c, alertChatId, t)
+	case BreakoutHigh, BreakoutLow, BreakoutReenter:
+		return b.createBreakoutAlert(c, alertChatId, t)
+	case "ladder":
+		return b.createLadderAlert(c, alertChatId, t)
 	}
 
 	targetPrice, err := strconv.ParseFloat(command[1], 64)
 	if err != nil {
-		return b.sendMessage(chatId, "Invalid target price.")
+		return b.sendMessage(chatId, c.T("alert.invalid_target"))
 	}
-
-	// check if target_price is not in the range of daily (High and Low)
-	if targetPrice < t.DailyHigh && targetPrice > t.DailyLow {
-		return b.sendMessage(chatId, "Invalid target price.\ntarget_price already in range of daily hight and low.")
+	if !t.Meta.OnTick(targetPrice) {
+		return b.sendMessage(chatId, c.T("alert.off_tick", "symbol", strings.ToUpper(t.Symbol), "tick", t.Meta.Format(t.Meta.TickSize)))
 	}
 
 	var description string
 	if len(command) > 2 {
-		for index, c := range command {
-			if index >= 2 {
-				description = description + " " + c
-			}
-		}
+		description = command[2]
 	} else {
-		description = ""
+		description = c.Flags["note"]
+	}
+	newAlert := NewAlert(userId, alertChatId, t.Symbol, description, targetPrice, t.LivePrice)
+	newAlert.Urgent = c.Flags["urgent"] == "true"
+	if ok, err := b.setValidity(c, newAlert); !ok {
+		return err
 	}
-	newAlert := NewAlert(userId, t.Symbol, description, targetPrice, t.LivePrice)
 	if err := b.store.CreateAlert(newAlert); err != nil {
-		return b.sendMessage(chatId, "Error storing the alert.")
+		return b.sendMessage(chatId, c.T("alert.store_failed"))
 	}
-	return b.sendMessage(chatId, "Alert added successfully.")
+	return b.sendMessage(chatId, c.T("alert.created"))
 }
-func (b *TelegramBot) viewAlerts(chatId, userId int64, command []string) error {
-	user, err := b.checkUser(userId, chatId)
-	if user == nil {
+func (b *TelegramBot) viewAlerts(c *CommandContext) error {
+	chatId, command := c.ChatId, c.Args
+	alertChatId, err := b.alertChat(c, false)
+	if alertChatId == 0 {
 		return err
 	}
 	var alerts []Alert
 	if len(command) > 0 {
 		symbolStr := command[0]
-		alerts, err = b.store.GetAlertsByUserIdAndSymbol(userId, symbolStr)
+		alerts, err = b.store.GetAlertsByChatIdAndSymbol(alertChatId, symbolStr)
 		if err != nil {
 			return err
 		}
 	} else {
-		alerts, err = b.store.GetAlertsByUserId(userId)
+		alerts, err = b.store.GetAlertsByChatId(alertChatId)
 		if err != nil {
 			return err
 		}
 
 	}
 
+	prefs := b.preferences(c.UserId)
+	archived := c.Flags["archived"] == "true"
 	var alertStrings []string
 	var livePrice float64
 	for _, alert := range alerts {
-		t, exist := tickers[alert.Symbol]
+		if (alert.ArchivedAt != nil) != archived {
+			continue
+		}
+		t, exist := getTicker(alert.Symbol)
 		if exist {
 			livePrice = t.LivePrice
 		} else {
 			livePrice = 0
 		}
 
-		alertStrings = append(alertStrings, alert.ToString(livePrice))
+		alertStrings = append(alertStrings, alert.ToString(livePrice, prefs, c.Lang))
 	}
 
 	if len(alertStrings) == 0 {
-		return b.sendMessage(chatId, "No alerts found.")
+		return b.sendMessage(chatId, c.T("alert.none"))
 	}
 	return b.sendMessageInChunks(chatId, strings.Join(alertStrings, "\n\n"))
 }
-func (b *TelegramBot) updateAlert(chatId, userId int64, command []string) error {
-	user, err := b.checkUser(userId, chatId)
-	if user == nil {
+func (b *TelegramBot) updateAlert(c *CommandContext) error {
+	chatId, command := c.ChatId, c.Args
+	alertChatId, err := b.alertChat(c, true)
+	if alertChatId == 0 {
 		return err
 	}
 
 	if len(command) < 2 {
-		return b.sendMessage(chatId, "Usage: /updatealert <number> <target_price>")
+		return b.sendUsage(c)
 	}
 
-	number, err := strconv.ParseInt(command[0], 10, 32)
+	number, level, err := parseAlertRef(command[0])
 	if err != nil {
-		return b.sendMessage(chatId, "Invalid alert number.")
+		return b.sendMessage(chatId, c.T("alert.invalid_number"))
 	}
-	alert, err := b.store.GetAlertByNumber(userId, int32(number))
+	alert, err := b.store.GetAlertByNumber(alertChatId, number)
 	if err != nil {
-		return b.sendMessage(chatId, "Alert not found.")
+		return b.sendMessage(chatId, c.T("alert.not_found"))
 	}
 
 	targetPrice, err := strconv.ParseFloat(command[1], 64)
 	if err != nil {
-		return b.sendMessage(chatId, "Invalid target price.")
-	}
-	ticker, exists := tickers[alert.Symbol]
+		return b.sendMessage(chatId, c.T("alert.invalid_target"))
+	}
+	if level > 0 || alert.Kind == AlertLadder {
+		return b.updateLadderLevel(c, alert, level, targetPrice, false)
+	}
+	switch alert.Kind {
+	case AlertTrail:
+		return b.sendMessage(chatId, c.T("trail.no_update"))
+	case AlertCompound:
+		return b.sendMessage(chatId, c.T("compound.no_update"))
+	case AlertMove:
+		return b.sendMessage(chatId, c.T("move.no_update"))
+	case AlertBreakout:
+		return b.sendMessage(chatId, c.T("breakout.no_update"))
+	case AlertPnL:
+		return b.sendMessage(chatId, c.T("pnl.no_update"))
+	}
+	ticker, exists := getTicker(alert.Symbol)
 	if !exists {
-		return b.sendMessage(chatId, "Live price not available for editing alert")
+		return b.sendMessage(chatId, c.T("alert.no_live_price"))
+	}
+	if !ticker.Meta.OnTick(targetPrice) {
+		return b.sendMessage(chatId, c.T("alert.off_tick", "symbol", strings.ToUpper(ticker.Symbol), "tick", ticker.Meta.Format(ticker.Meta.TickSize)))
 	}
 
-	alert.StartPrice = ticker.LivePrice
-	alert.TargetPrice = targetPrice
+	alert.SetTarget(targetPrice, ticker.LivePrice)
+	alert.UpdatedAt = time.Now().UTC()
 	if err := b.store.UpdateAlert(alert); err != nil {
 		return err
 	}
-	return b.sendMessage(chatId, "Alert updated successfully.")
+	return b.sendMessage(chatId, c.T("alert.updated"))
 }
-func (b *TelegramBot) deleteAlert(chatId, userId int64, command []string) error {
-	user, err := b.checkUser(userId, chatId)
-	if user == nil {
+
+// markUrgent lets an alert bypass the quiet hours of its creator.
+func (b *TelegramBot) markUrgent(c *CommandContext) error {
+	chatId, command := c.ChatId, c.Args
+	alertChatId, err := b.alertChat(c, true)
+	if alertChatId == 0 {
+		return err
+	}
+
+	number, err := strconv.ParseInt(command[0], 10, 32)
+	if err != nil {
+		return b.sendMessage(chatId, c.T("alert.invalid_number"))
+	}
+	alert, err := b.store.GetAlertByNumber(alertChatId, int32(number))
+	if err != nil {
+		return b.sendMessage(chatId, c.T("alert.not_found"))
+	}
+
+	urgent := true
+	if len(command) > 1 {
+		switch strings.ToLower(command[1]) {
+		case "on":
+		case "off":
+			urgent = false
+		default:
+			return b.sendUsage(c)
+		}
+	}
+	alert.Urgent = urgent
+	alert.UpdatedAt = time.Now().UTC()
+	if err := b.store.UpdateAlert(alert); err != nil {
+		return err
+	}
+	if urgent {
+		return b.sendMessage(chatId, c.T("alert.urgent_on", "number", alert.Number))
+	}
+	return b.sendMessage(chatId, c.T("alert.urgent_off", "number", alert.Number))
+}
+func (b *TelegramBot) deleteAlert(c *CommandContext) error {
+	chatId, command := c.ChatId, c.Args
+	alertChatId, err := b.alertChat(c, true)
+	if alertChatId == 0 {
 		return err
 	}
 
 	if len(command) < 1 {
-		return b.sendMessage(chatId, "Usage: /deletealert <number>")
+		return b.sendUsage(c)
 	}
 
-	number, err := strconv.ParseInt(command[0], 10, 32)
+	number, level, err := parseAlertRef(command[0])
 	if err != nil {
-		return b.sendMessage(chatId, "Invalid alert number.")
+		return b.sendMessage(chatId, c.T("alert.invalid_number"))
 	}
 
-	alert, err := b.store.GetAlertByNumber(userId, int32(number))
+	alert, err := b.store.GetAlertByNumber(alertChatId, number)
 	if err != nil {
-		return b.sendMessage(chatId, "Alert not found.")
+		return b.sendMessage(chatId, c.T("alert.not_found"))
+	}
+	if level > 0 {
+		// removing a level leaves the rest of the ladder
+		return b.updateLadderLevel(c, alert, level, 0, true)
 	}
 
 	if err := b.store.DeleteAlert(alert.Id); err != nil {
 		return err
 	}
-	return b.sendMessage(chatId, "Alert deleted successfully.")
+	return b.sendMessage(chatId, c.T("alert.deleted"))
 }
 
 func (b *TelegramBot) sendMessage(chatId int64, msgStr string) error {
@@ -398,56 +585,78 @@ func (b *TelegramBot) sendMessageInChunks(chatId int64, msgStr string) error {
 	return nil
 }
 
-func (b *TelegramBot) viewSymbols(chatId, userId int64, command []string) error {
-	user, err := b.checkUser(userId, chatId)
-	if user == nil {
-		return err
-	}
+func (b *TelegramBot) viewSymbols(c *CommandContext) error {
+	chatId, command := c.ChatId, c.Args
 
+	snapshot := snapshotTickers()
 	var tickerStrings []string
 	if len(command) > 0 {
 		if command[0] == "cryptos" {
-			for _, ticker := range tickers {
+			for _, ticker := range snapshot {
 				if ticker.Category == "crypto" {
-					tickerStrings = append(tickerStrings, ticker.toTelegramString())
+					tickerStrings = append(tickerStrings, ticker.toTelegramString(c.Lang))
 				}
 			}
 		} else if command[0] == "feature" {
-			for _, ticker := range tickers {
+			for _, ticker := range snapshot {
 				if ticker.Category == "feature" {
-					tickerStrings = append(tickerStrings, ticker.toTelegramString())
+					tickerStrings = append(tickerStrings, ticker.toTelegramString(c.Lang))
 				}
 			}
 
 		} else if command[0] == "forex" {
-			for _, ticker := range tickers {
+			for _, ticker := range snapshot {
 				if ticker.Category == "forex" {
-					tickerStrings = append(tickerStrings, ticker.toTelegramString())
+					tickerStrings = append(tickerStrings, ticker.toTelegramString(c.Lang))
 				}
 			}
 
+		} else if command[0] == "synthetic" {
+			for _, ticker := range snapshot {
+				if ticker.Category == "synthetic" {
+					tickerStrings = append(tickerStrings, ticker.toTelegramString(c.Lang)+" "+ticker.Name)
+				}
+			}
+		} else if ticker, exist := lookupTicker(snapshot, command[0]); exist && ticker.Category == "synthetic" {
+			// any pair of tickers makes a synthetic one
+			tickerStrings = append(tickerStrings, ticker.toTelegramString(c.Lang)+" "+ticker.Name)
 		} else {
-			for _, ticker := range tickers {
+			for _, ticker := range snapshot {
 				if strings.Contains(ticker.Symbol, command[0]) || strings.Contains(ticker.Name, command[0]) {
-					tickerStrings = append(tickerStrings, ticker.toTelegramString())
+					tickerStrings = append(tickerStrings, ticker.toTelegramString(c.Lang))
 				}
 			}
 		}
 	} else {
-		for _, ticker := range tickers {
-			tickerStrings = append(tickerStrings, ticker.toTelegramString())
+		for _, ticker := range snapshot {
+			tickerStrings = append(tickerStrings, ticker.toTelegramString(c.Lang))
 		}
 	}
 
 	if len(tickerStrings) == 0 {
-		return b.sendMessage(chatId, "No tickers found.")
+		return b.sendMessage(chatId, c.T("symbol.none"))
 	}
 
 	return b.sendMessageInChunks(chatId, strings.Join(tickerStrings, "\n"))
 }
+
+// mentionCreator returns a mention of the user who created an alert owned by
+// a group or channel, so the notification reaches them.
+func (b *TelegramBot) mentionCreator(alert *Alert, lang string) string {
+	if alert.ChatId == alert.UserId {
+		return ""
+	}
+	name := T(lang, "alert.creator")
+	if user, err := b.store.GetUserByUserId(alert.UserId); err == nil {
+		name = user.Firstname
+	}
+	return fmt.Sprintf("<a href=\"tg://user?id=%d\">%s</a> ", alert.UserId, html.EscapeString(name))
+}
+
 func (b *TelegramBot) startAlertChecker() {
 	for {
 		b.checkAlert()
+		b.deliverQueuedNotifications(time.Now())
 		time.Sleep(1 * time.Minute)
 	}
 }
@@ -457,6 +666,14 @@ func (b *TelegramBot) checkAlert() {
 		log.Printf("Error retrieving alerts: %s", err.Error())
 		return
 	}
+	paused, err := b.pausedUserIds()
+	if err != nil {
+		log.Printf("Error retrieving paused users: %s", err.Error())
+		return
+	}
+
+	// every alert is checked against the prices of the same moment
+	snapshot := snapshotTickers()
 
 	//today := time.Now().Truncate(24 * time.Hour)
 
@@ -470,55 +687,131 @@ func (b *TelegramBot) checkAlert() {
 		// 	}
 		// 	continue
 		// }
-		if !alert.Active {
+		// alerts that already triggered are kept as they are
+		if alert.Active && alert.ArchivedAt == nil && alert.expired(time.Now()) {
+			b.archiveAlert(&alert)
+			continue
+		}
+		if !alert.Active || paused[alert.UserId] || !alert.Window.contains(time.Now()) {
+			continue
+		}
+		if alert.Kind == AlertMove {
+			// move alerts watch every ticker of their scope on its own
+			b.checkMoveAlert(&alert, snapshot)
 			continue
 		}
-		ticker, exist := tickers[alert.Symbol]
-		if !exist {
-			log.Println("Symbol not found:", alert.Symbol, "id:", alert.Id)
-			msg := tgbotapi.NewMessage(alert.UserId, "Symbol not found: "+alert.Symbol)
+		symbols := []string{alert.Symbol}
+		if alert.Kind == AlertCompound {
+			symbols = alert.Condition.symbols()
+		}
+		if missing := missingSymbol(symbols, snapshot); missing != "" {
+			log.Println("Symbol not found:", missing, "id:", alert.Id)
+			msg := tgbotapi.NewMessage(alert.ChatId, T(b.userLanguage(alert.UserId), "alert.symbol_missing", "symbol", missing))
 			_, err = b.bot.Send(msg)
 			continue
 		}
 
-		var isTriggered bool
+		// closed markets and quotes that stopped updating, or inputs of
+		// synthetic tickers that did, are not evaluated until they update
+		// again
+		if closedSymbol(symbols, snapshot, time.Now()) != "" || staleSymbol(symbols, snapshot, time.Now()) != "" {
+			continue
+		}
 
-		if ticker.DailyHigh <= 0 || ticker.DailyLow <= 0 {
-			//check alert with etimated fixed amount for example (1% price)
-			estimatedAmount := 0.01 * alert.TargetPrice
-			if ticker.LivePrice == alert.TargetPrice {
-				isTriggered = true
-			} else if alert.TargetPrice > alert.StartPrice && alert.TargetPrice < (ticker.LivePrice+estimatedAmount) {
-				isTriggered = true
-			} else if alert.TargetPrice < alert.StartPrice && alert.TargetPrice > (ticker.LivePrice-estimatedAmount) {
-				isTriggered = true
-			} else {
-				isTriggered = false
+		ticker, _ := lookupTicker(snapshot, alert.Symbol)
+		var (
+			observed, triggered bool
+			history             []Session
+			hits                []int
+		)
+		switch alert.Kind {
+		case AlertCompound:
+			triggered = alert.Condition.holds(snapshot)
+		case AlertBreakout:
+			history = b.sessionHistory(alert.Symbol)
+			observed, triggered = alert.breakoutTriggered(ticker, history)
+		case AlertLadder:
+			observed = alert.observe(ticker)
+			hits = alert.climb(ticker.Meta.Tolerance(), time.Now())
+			triggered = len(hits) > 0
+		default:
+			observed = alert.observe(ticker)
+			triggered = alert.triggered(ticker)
+		}
+		if triggered && ticker.Gap && alert.rearmGap(ticker) {
+			// the price was never traded between the close and the open
+			if err := b.store.UpdateAlert(&alert); err != nil {
+				log.Println("Error updating alert", err)
 			}
-		} else {
-			//check akert with dailyhigh and dailylow
-			if ticker.LivePrice == alert.TargetPrice {
-				isTriggered = true
-			} else if alert.TargetPrice > alert.StartPrice && ((alert.TargetPrice < ticker.DailyHigh) || (alert.TargetPrice < ticker.LivePrice)) {
-				isTriggered = true
-			} else if alert.TargetPrice < alert.StartPrice && ((alert.TargetPrice > ticker.DailyLow) || (alert.TargetPrice > ticker.LivePrice)) {
-				isTriggered = true
-			} else {
-				isTriggered = false
+			if prefs := b.preferences(alert.UserId); prefs.Gaps {
+				lang := b.userLanguage(alert.UserId)
+				b.notify(&alert, NotificationGap, gapText(&alert, ticker, prefs, lang), prefs, lang)
 			}
-		}
-
-		if isTriggered {
-			alert.Active = false
+		} else if triggered {
+			// ladders stay active until their last level is hit
+			alert.Active = alert.Kind == AlertLadder && alert.Ladder.next() >= 0
 			alert.UpdatedAt = time.Now().UTC()
 			if err := b.store.UpdateAlert(&alert); err != nil {
 				log.Println("Error updating alert", err)
 			}
-			msg := tgbotapi.NewMessage(alert.UserId, fmt.Sprintf("Alert triggered for %s! Current price: %.5f TargetPrice was: %.5f, with Description: %s", alert.Symbol, ticker.LivePrice, alert.TargetPrice, alert.Description))
-			if _, err := b.bot.Send(msg); err != nil {
-				log.Printf("Error sending alert notification to user %d: %s", alert.UserId, err.Error())
-				return
+			prefs, lang := b.preferences(alert.UserId), b.userLanguage(alert.UserId)
+			text := T(lang, "alert.triggered", "symbol", alert.Symbol, "price", prefs.FormatPrice(alert.Symbol, ticker.LivePrice), "target", prefs.FormatPrice(alert.Symbol, alert.TargetPrice), "description", html.EscapeString(alert.Description))
+			switch alert.Kind {
+			case AlertCompound:
+				text = compoundTriggeredText(&alert, snapshot, prefs, lang)
+			case AlertBreakout:
+				text = breakoutTriggeredText(&alert, ticker, history, prefs, lang)
+			case AlertLadder:
+				text = ladderTriggeredText(&alert, hits, ticker, prefs, lang)
+			case AlertPnL:
+				if pnlText := b.pnlTriggeredText(&alert, ticker, prefs, lang); pnlText != "" {
+					text = pnlText
+				}
+			case AlertTrail:
+				text = T(lang, "trail.triggered", "symbol", alert.Symbol, "price", prefs.FormatPrice(alert.Symbol, ticker.LivePrice), "best", prefs.FormatPrice(alert.Symbol, alert.bestPrice()), "trail", alert.Trail.String(), "description", html.EscapeString(alert.Description))
+			}
+			b.notify(&alert, NotificationTrigger, text, prefs, lang)
+		} else if observed {
+			// keep the observed range across restarts
+			if err := b.store.UpdateAlert(&alert); err != nil {
+				log.Println("Error updating alert", err)
 			}
 		}
 	}
+	// breakouts were checked against the sessions before this snapshot
+	b.recordSessions(snapshot)
+}
+
+// notify sends a notification of an alert to its chat, or queues it during
+// the quiet hours of its creator.
+func (b *TelegramBot) notify(alert *Alert, kind, text string, prefs *Preferences, lang string) {
+	// quiet hours only hold back messages to the private chat of the user
+	if alert.ChatId == alert.UserId && !alert.Urgent && prefs.InQuietHours(time.Now()) {
+		if kind == NotificationTrigger {
+			text += "\n" + T(lang, "alert.triggered_quiet", "time", prefs.FormatTime(time.Now()))
+		}
+		queued := &QueuedNotification{
+			AlertId:   alert.Id,
+			ChatId:    alert.ChatId,
+			Kind:      kind,
+			Text:      text,
+			CreatedAt: time.Now().UTC(),
+		}
+		if err := b.store.QueueNotification(queued); err != nil {
+			log.Println("Error queueing notification", err)
+		}
+		return
+	}
+	msg := tgbotapi.NewMessage(alert.ChatId, b.mentionCreator(alert, lang)+text)
+	msg.ParseMode = tgbotapi.ModeHTML
+	_, err := b.bot.Send(msg)
+	if err := b.store.CreateNotification(NewNotification(alert, kind, err)); err != nil {
+		log.Println("Error recording notification", err)
+	}
+	if err != nil {
+		log.Printf("Error sending alert notification to chat %d: %s", alert.ChatId, err.Error())
+		if isBlockedError(err) && alert.ChatId == alert.UserId {
+			b.store.SetUserActive(alert.UserId, false)
+		}
+	}
 }
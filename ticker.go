@@ -1,44 +1,106 @@
 package main
 
 import (
-	"fmt"
+	"html"
 	"strings"
 	"time"
 )
 
+// staleAfter is how long a ticker may go without an update before its
+// prices are not trusted anymore, three scrapes.
+const staleAfter = 15 * time.Minute
+
 type Ticker struct {
-	Symbol    string    `json:"symbol"`
-	Name      string    `json:"name"`
-	Category  string    `json:"category"`
-	LivePrice float64   `json:"live_price"`
-	DailyHigh float64   `json:"daily_high"`
-	DailyLow  float64   `json:"daily_low"`
+	Symbol    string     `json:"symbol"`
+	Name      string     `json:"name"`
+	Category  string     `json:"category"`
+	LivePrice float64    `json:"live_price"`
+	DailyHigh float64    `json:"daily_high"`
+	DailyLow  float64    `json:"daily_low"`
+	Meta      SymbolMeta `json:"meta"`
+	// PrevPrice is the live price before the last update; RangeHigh and
+	// RangeLow are the extremes traded between the two updates
+	PrevPrice     float64   `json:"prev_price"`
+	RangeHigh     float64   `json:"range_high"`
+	RangeLow      float64   `json:"range_low"`
+	PrevUpdatedAt time.Time `json:"prev_updated_at"`
+	// Gap is set when the market closed between the two updates, so
+	// nothing traded between them
+	Gap       bool      `json:"gap"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
 func NewTicker(symbol, name, category string, livePrice, dailyHigh, dailyLow float64) *Ticker {
+	now := time.Now().UTC()
 	return &Ticker{
-		Symbol:    symbol,
-		Name:      name,
-		Category:  category,
-		LivePrice: livePrice,
-		DailyHigh: dailyHigh,
-		DailyLow:  dailyLow,
-		CreatedAt: time.Now().UTC(),
-		UpdatedAt: time.Now().UTC(),
+		Symbol:        symbol,
+		Name:          name,
+		Category:      category,
+		LivePrice:     livePrice,
+		DailyHigh:     dailyHigh,
+		DailyLow:      dailyLow,
+		Meta:          lookupSymbolMeta(symbol, category, livePrice),
+		PrevPrice:     livePrice,
+		RangeHigh:     livePrice,
+		RangeLow:      livePrice,
+		PrevUpdatedAt: now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
 	}
 }
 
 func (t *Ticker) Update(livePrice, dailyHigh, dailyLow float64) error {
-	t.UpdatedAt = time.Now().UTC()
+	now := time.Now().UTC()
+	t.PrevPrice, t.PrevUpdatedAt = t.LivePrice, t.UpdatedAt
+	t.RangeHigh, t.RangeLow = max(t.PrevPrice, livePrice), min(t.PrevPrice, livePrice)
+	t.Gap = reopened(t.Category, t.PrevUpdatedAt, now)
+	if t.Gap {
+		t.RangeHigh, t.RangeLow = livePrice, livePrice
+	}
+	// a daily extreme that changed was traded since the previous update,
+	// either as a new extreme or in a session that started since
+	if dailyHigh > 0 && dailyHigh != t.DailyHigh {
+		t.RangeHigh = max(t.RangeHigh, dailyHigh)
+	}
+	if dailyLow > 0 && dailyLow != t.DailyLow {
+		t.RangeLow = min(t.RangeLow, dailyLow)
+	}
+	t.UpdatedAt = now
 	t.LivePrice = livePrice
 	t.DailyHigh = dailyHigh
 	t.DailyLow = dailyLow
 	return nil
 }
 
-func (t *Ticker) toTelegramString() string {
-	return fmt.Sprintf("Symbol [%s]: (%0.4f)",
-		strings.ToUpper(t.Symbol), t.LivePrice)
+// Stale reports whether the ticker missed its recent updates.
+func (t *Ticker) Stale(now time.Time) bool {
+	return now.Sub(t.UpdatedAt) > staleAfter
+}
+
+func (t *Ticker) toTelegramString(lang string) string {
+	line := T(lang, "ticker.line", "symbol", strings.ToUpper(t.Symbol), "price", t.Meta.Format(t.LivePrice))
+	if !marketOpen(t.Category, time.Now()) {
+		line += " \U0001F319"
+	} else if t.Stale(time.Now()) {
+		line += " \u26A0\uFE0F"
+	}
+	return line
+}
+
+// toQuoteString renders the quote card of the ticker in HTML; the scraped
+// name is escaped like alert descriptions.
+func (t *Ticker) toQuoteString(lang string) string {
+	quote := T(lang, "ticker.quote", "symbol", strings.ToUpper(t.Symbol), "name", html.EscapeString(t.Name), "price", t.Meta.Format(t.LivePrice), "currency", t.Meta.QuoteCurrency)
+	if t.DailyHigh > 0 && t.DailyLow > 0 {
+		quote += "\n" + T(lang, "ticker.quote_range", "high", t.Meta.Format(t.DailyHigh), "low", t.Meta.Format(t.DailyLow))
+	}
+	quote += "\n" + T(lang, "ticker.quote_meta", "class", T(lang, "asset."+string(t.Meta.AssetClass)), "tick", t.Meta.Format(t.Meta.TickSize), "pip", t.Meta.Format(t.Meta.PipSize))
+	quote += "\n" + T(lang, "ticker.quote_updated", "time", t.UpdatedAt.Format(time.RFC3339))
+	if now := time.Now(); !marketOpen(t.Category, now) {
+		quote += "\n" + T(lang, "ticker.quote_closed")
+	} else if t.Stale(now) {
+		quote += "\n" + T(lang, "ticker.quote_stale", "ago", formatDuration(now.Sub(t.UpdatedAt)))
+	}
+	return quote
 }
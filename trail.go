@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Trail is the distance a trailing stop keeps from the best price seen
+// since it was created. Long stops follow the highest price and fire when
+// the price falls back by the distance, short stops follow the lowest.
+type Trail struct {
+	Distance float64 `json:"distance"`
+	// Percent gives Distance in percent of the best price
+	Percent bool `json:"percent"`
+	Short   bool `json:"short"`
+}
+
+var errInvalidTrail = errors.New("invalid trail")
+
+// parseTrail reads `<distance|pct> [long|short]` from the start of fields,
+// returning the trail and the number of fields it used.
+func parseTrail(fields []string) (Trail, int, error) {
+	var trail Trail
+	if len(fields) == 0 {
+		return trail, 0, errInvalidTrail
+	}
+	value := fields[0]
+	if strings.HasSuffix(value, "%") {
+		trail.Percent = true
+		value = strings.TrimSuffix(value, "%")
+	}
+	distance, err := strconv.ParseFloat(value, 64)
+	if err != nil || !(distance > 0) || (trail.Percent && distance >= 100) {
+		return trail, 0, errInvalidTrail
+	}
+	trail.Distance = distance
+	used := 1
+	if len(fields) > 1 {
+		switch strings.ToLower(fields[1]) {
+		case "short":
+			trail.Short = true
+			used++
+		case "long":
+			used++
+		}
+	}
+	return trail, used, nil
+}
+
+// String renders the trail in the syntax parseTrail reads.
+func (t Trail) String() string {
+	s := strconv.FormatFloat(t.Distance, 'f', -1, 64)
+	if t.Percent {
+		s += "%"
+	}
+	if t.Short {
+		s += " short"
+	}
+	return s
+}
+
+// stop returns the price the stop fires at for the best price seen.
+func (t Trail) stop(best float64) float64 {
+	distance := t.Distance
+	if t.Percent {
+		distance = best * t.Distance / 100
+	}
+	if t.Short {
+		return best + distance
+	}
+	return best - distance
+}
+
+// createTrailingStop handles `/createalert <symbol> trail <distance|pct>
+// [long|short] [description]`.
+func (b *TelegramBot) createTrailingStop(c *CommandContext, alertChatId int64, t *Ticker) error {
+	var fields []string
+	if len(c.Args) > 2 {
+		fields = strings.Fields(c.Args[2])
+	}
+	trail, used, err := parseTrail(fields)
+	if err != nil {
+		return b.sendMessage(c.ChatId, c.T("trail.invalid"))
+	}
+	description := strings.Join(fields[used:], " ")
+	if description == "" {
+		description = c.Flags["note"]
+	}
+
+	alert := NewTrailingStop(c.UserId, alertChatId, t.Symbol, description, trail, t.LivePrice)
+	alert.Urgent = c.Flags["urgent"] == "true"
+	if ok, err := b.setValidity(c, alert); !ok {
+		return err
+	}
+	if err := b.store.CreateAlert(alert); err != nil {
+		return b.sendMessage(c.ChatId, c.T("alert.store_failed"))
+	}
+	return b.sendMessage(c.ChatId, c.T("trail.created", "stop", t.Meta.Format(alert.TargetPrice)))
+}
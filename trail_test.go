@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTrail(t *testing.T) {
+	tests := []struct {
+		fields []string
+		want   Trail
+		used   int
+		isErr  bool
+	}{
+		{fields: []string{"150"}, want: Trail{Distance: 150}, used: 1},
+		{fields: []string{"2.5%", "short", "breakout"}, want: Trail{Distance: 2.5, Percent: true, Short: true}, used: 2},
+		{fields: []string{"0.002", "LONG"}, want: Trail{Distance: 0.002}, used: 2},
+		{fields: []string{"3%", "take", "profit"}, want: Trail{Distance: 3, Percent: true}, used: 1},
+		{fields: []string{}, isErr: true},
+		{fields: []string{"-5"}, isErr: true},
+		{fields: []string{"100%"}, isErr: true},
+		{fields: []string{"abc"}, isErr: true},
+	}
+	for _, tt := range tests {
+		got, used, err := parseTrail(tt.fields)
+		if tt.isErr {
+			if err == nil {
+				t.Errorf("parseTrail(%q) expected an error", tt.fields)
+			}
+			continue
+		}
+		if err != nil || got != tt.want || used != tt.used {
+			t.Errorf("parseTrail(%q) = %+v, %d, %v, want %+v, %d", tt.fields, got, used, err, tt.want, tt.used)
+		}
+	}
+}
+
+func TestTrailingStop(t *testing.T) {
+	tests := []struct {
+		name     string
+		trail    Trail
+		prices   []float64
+		wantStop float64
+		want     bool
+	}{
+		{name: "long follows the high", trail: Trail{Distance: 100}, prices: []float64{60200, 60500, 60450}, wantStop: 60400, want: false},
+		{name: "long fires on the pullback", trail: Trail{Distance: 100}, prices: []float64{60200, 60500, 60400}, wantStop: 60400, want: true},
+		{name: "long never moves its stop down", trail: Trail{Distance: 100}, prices: []float64{59950, 59920}, wantStop: 59900, want: false},
+		{name: "short follows the low", trail: Trail{Distance: 100, Short: true}, prices: []float64{59800, 59500, 59550}, wantStop: 59600, want: false},
+		{name: "short fires on the bounce", trail: Trail{Distance: 100, Short: true}, prices: []float64{59500, 59650}, wantStop: 59600, want: true},
+		{name: "percent of the best price", trail: Trail{Distance: 10, Percent: true}, prices: []float64{70000, 63000}, wantStop: 63000, want: true},
+	}
+	for _, tt := range tests {
+		alert := NewTrailingStop(1, 1, "btc", "", tt.trail, 60000)
+		ticker := &Ticker{Meta: SymbolMeta{TickSize: 0.01}, LivePrice: 60000, UpdatedAt: alert.WatchedSince}
+		var triggered bool
+		for i, price := range tt.prices {
+			ticker.PrevPrice, ticker.PrevUpdatedAt = ticker.LivePrice, ticker.UpdatedAt
+			ticker.RangeHigh, ticker.RangeLow = max(ticker.PrevPrice, price), min(ticker.PrevPrice, price)
+			ticker.LivePrice, ticker.UpdatedAt = price, alert.WatchedSince.Add(time.Duration(i+1)*time.Minute)
+			alert.observe(ticker)
+			triggered = alert.triggered(ticker)
+		}
+		if alert.TargetPrice != tt.wantStop || triggered != tt.want {
+			t.Errorf("%s: stop %g, triggered %t, want %g, %t", tt.name, alert.TargetPrice, triggered, tt.wantStop, tt.want)
+		}
+	}
+}
@@ -15,7 +15,13 @@ type User struct {
 	Lastname  string    `json:"lastname"`
 	Password  string    `json:"password"`
 	CreatedAt time.Time `json:"created_at"`
-	IsAdmin   bool      `json:"is_admin"`
+	Role      Role      `json:"role"`
+	InvitedBy int64     `json:"invited_by"`
+	Active    bool      `json:"active"`
+	// LanguageCode is the language of the Telegram client the user last used
+	LanguageCode string `json:"language_code"`
+	// DeleteAt is set while the account waits out the deletion grace period
+	DeleteAt *time.Time `json:"delete_at,omitempty"`
 }
 
 func GetCreateUsersTable() string {
@@ -27,7 +33,11 @@ func GetCreateUsersTable() string {
 		lastname TEXT NOT NULL,
 		password TEXT NOT NULL,
 		created_at TIMESTAMP NOT NULL,
-		is_admin BOOLEAN
+		role TEXT NOT NULL DEFAULT 'trader',
+		invited_by INTEGER,
+		active BOOLEAN NOT NULL DEFAULT TRUE,
+		delete_at TIMESTAMP,
+		language_code TEXT NOT NULL DEFAULT ''
 	);`
 }
 
@@ -44,7 +54,8 @@ func NewUser(user_id int64, username, firstname, lastname, password string) (*Us
 		Lastname:  lastname,
 		Password:  hashedPassword,
 		CreatedAt: time.Now().UTC(),
-		IsAdmin:   false,
+		Role:      RoleTrader,
+		Active:    true,
 	}, nil
 }
 
@@ -61,11 +72,26 @@ func NewAdmin(user_id int64, password string) (*User, error) {
 		Lastname:  "admin",
 		Password:  hashedPassword,
 		CreatedAt: time.Now().UTC(),
-		IsAdmin:   true,
+		Role:      RoleOwner,
+		Active:    true,
 	}, nil
 }
 
-func (u *User) toTelegramString() string {
-	return fmt.Sprintf("User ID: %d\nChat ID: %d\nUsername: %s\nFistname: %s\nLastname: %s\nPassword: %s\nCreated At: %s",
-		u.UserId, u.UserId, u.Username, u.Firstname, u.Lastname, u.Password, u.CreatedAt.Format(time.RFC3339))
+func (u *User) toTelegramString(lang string) string {
+	str := T(lang, "user.card", "user_id", u.UserId, "username", u.Username, "firstname", u.Firstname, "lastname", u.Lastname, "role", u.Role, "created_at", u.CreatedAt.Format(time.RFC3339))
+	if u.InvitedBy != 0 {
+		str += "\n" + T(lang, "user.card_invited_by", "user_id", u.InvitedBy)
+	}
+	if u.DeleteAt != nil {
+		str += "\n" + T(lang, "user.card_delete_at", "time", u.DeleteAt.Format(time.RFC3339))
+	}
+	return str
+}
+
+func GetCreateAllowlistTable() string {
+	return `CREATE TABLE IF NOT EXISTS allowlist (
+		user_id INTEGER PRIMARY KEY,
+		added_by INTEGER,
+		created_at TIMESTAMP NOT NULL
+	);`
 }
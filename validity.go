@@ -0,0 +1,396 @@
+package main
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MarketSession is a named trading session alerts can be limited to.
+type MarketSession struct {
+	Zone       string
+	Start, End string
+}
+
+// marketSessions are the main forex sessions, on weekdays in the local time
+// of their financial center.
+var marketSessions = map[string]MarketSession{
+	"sydney":  {Zone: "Australia/Sydney", Start: "07:00", End: "16:00"},
+	"tokyo":   {Zone: "Asia/Tokyo", Start: "09:00", End: "18:00"},
+	"london":  {Zone: "Europe/London", Start: "08:00", End: "17:00"},
+	"newyork": {Zone: "America/New_York", Start: "08:00", End: "17:00"},
+}
+
+var weekdayNames = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+const (
+	everyDay = 1<<7 - 1
+	weekdays = everyDay &^ (1<<time.Sunday | 1<<time.Saturday)
+	weekends = 1<<time.Sunday | 1<<time.Saturday
+)
+
+// ActiveWindow limits when an alert is checked: on some days of the week,
+// between two times of the day in a timezone, or during a market session.
+// The zero window is always open.
+type ActiveWindow struct {
+	// Session names one of marketSessions, which gives the days, times and
+	// zone
+	Session string
+	// Days has bit 1<<time.Weekday set for every day the window opens on
+	Days uint8
+	// Start and End are minutes after midnight; a window ending before it
+	// starts runs overnight and belongs to the day it starts on, one
+	// starting when it ends lasts all day
+	Start, End int
+	Zone       string
+}
+
+var errInvalidWindow = errors.New("invalid window")
+
+// parseWindow reads `<session>` or `[days] [HH:MM-HH:MM] [zone]`, such as
+// `london` or `weekdays 08:00-16:00 Europe/Berlin`. Windows without a zone
+// are in zone, the timezone of the user.
+func parseWindow(text, zone string) (ActiveWindow, error) {
+	fields := strings.Fields(strings.TrimSpace(text))
+	if len(fields) == 1 {
+		if _, exist := marketSessions[strings.ToLower(fields[0])]; exist {
+			return ActiveWindow{Session: strings.ToLower(fields[0])}, nil
+		}
+	}
+	w := ActiveWindow{Days: everyDay, Zone: zone}
+	if len(fields) > 0 {
+		if days, err := parseDays(fields[0]); err == nil {
+			w.Days = days
+			fields = fields[1:]
+		}
+	}
+	if len(fields) > 0 {
+		if start, end, found := strings.Cut(fields[0], "-"); found {
+			var err1, err2 error
+			w.Start, err1 = parseClock(start)
+			w.End, err2 = parseClock(end)
+			if err1 != nil || err2 != nil {
+				return w, errInvalidWindow
+			}
+			fields = fields[1:]
+		}
+	}
+	if len(fields) > 0 {
+		if _, err := time.LoadLocation(fields[0]); err != nil {
+			return w, errInvalidWindow
+		}
+		w.Zone = fields[0]
+		fields = fields[1:]
+	}
+	if len(fields) > 0 || (w.Days == everyDay && w.Start == w.End) {
+		return w, errInvalidWindow
+	}
+	return w, nil
+}
+
+// parseDays reads daily, weekdays, weekends or days and ranges of days such
+// as mon,wed or mon-thu.
+func parseDays(s string) (uint8, error) {
+	switch strings.ToLower(s) {
+	case "daily":
+		return everyDay, nil
+	case "weekdays":
+		return weekdays, nil
+	case "weekends":
+		return weekends, nil
+	}
+	index := func(name string) (int, bool) {
+		for i, n := range weekdayNames {
+			if strings.EqualFold(name, n) {
+				return i, true
+			}
+		}
+		return 0, false
+	}
+	var days uint8
+	for _, part := range strings.Split(s, ",") {
+		first, last, isRange := strings.Cut(part, "-")
+		from, ok := index(first)
+		if !ok {
+			return 0, errInvalidWindow
+		}
+		to := from
+		if isRange {
+			if to, ok = index(last); !ok {
+				return 0, errInvalidWindow
+			}
+		}
+		// ranges may wrap around the weekend, such as fri-mon
+		for d := from; ; d = (d + 1) % 7 {
+			days |= 1 << d
+			if d == to {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+// String renders the window in the syntax parseWindow reads.
+func (w ActiveWindow) String() string {
+	if w.Session != "" {
+		return w.Session
+	}
+	var parts []string
+	switch w.Days {
+	case everyDay:
+		if w.Start == w.End {
+			parts = append(parts, "daily")
+		}
+	case weekdays:
+		parts = append(parts, "weekdays")
+	case weekends:
+		parts = append(parts, "weekends")
+	default:
+		var names []string
+		for d, name := range weekdayNames {
+			if w.Days&(1<<d) != 0 {
+				names = append(names, name)
+			}
+		}
+		parts = append(parts, strings.Join(names, ","))
+	}
+	if w.Start != w.End {
+		parts = append(parts, fmt.Sprintf("%02d:%02d-%02d:%02d", w.Start/60, w.Start%60, w.End/60, w.End%60))
+	}
+	return strings.Join(append(parts, w.Zone), " ")
+}
+
+// resolve returns the days, times and zone of the window, expanding
+// market sessions.
+func (w ActiveWindow) resolve() ActiveWindow {
+	if session, exist := marketSessions[w.Session]; exist {
+		start, _ := parseClock(session.Start)
+		end, _ := parseClock(session.End)
+		return ActiveWindow{Days: weekdays, Start: start, End: end, Zone: session.Zone}
+	}
+	return w
+}
+
+// contains reports whether the window is open at a time.
+func (w ActiveWindow) contains(now time.Time) bool {
+	if w == (ActiveWindow{}) {
+		return true
+	}
+	w = w.resolve()
+	loc, err := time.LoadLocation(w.Zone)
+	if err != nil {
+		loc = time.UTC
+	}
+	local := now.In(loc)
+	minute := local.Hour()*60 + local.Minute()
+	day := local.Weekday()
+	switch {
+	case w.Start == w.End:
+	case w.Start < w.End:
+		if minute < w.Start || minute >= w.End {
+			return false
+		}
+	case minute >= w.Start:
+	case minute < w.End:
+		// the early hours of an overnight window belong to the day before
+		day = (day + 6) % 7
+	default:
+		return false
+	}
+	return w.Days&(1<<day) != 0
+}
+
+// Value stores the window in the syntax parseWindow reads, "" for the zero
+// window.
+func (w ActiveWindow) Value() (driver.Value, error) {
+	if w == (ActiveWindow{}) {
+		return "", nil
+	}
+	return w.String(), nil
+}
+
+func (w *ActiveWindow) Scan(src any) error {
+	var text string
+	switch v := src.(type) {
+	case nil:
+	case string:
+		text = v
+	case []byte:
+		text = string(v)
+	default:
+		return fmt.Errorf("cannot scan %T into a window", src)
+	}
+	*w = ActiveWindow{}
+	if text == "" {
+		return nil
+	}
+	window, err := parseWindow(text, "UTC")
+	if err != nil {
+		return fmt.Errorf("stored window %q: %w", text, err)
+	}
+	*w = window
+	return nil
+}
+
+var errInvalidExpiry = errors.New("invalid expiry")
+
+// parseExpiry reads an expiry as a duration from now such as 12h or 7d, a
+// date whose end it expires at or a date and time such as
+// 2024-12-31T18:00, both in the timezone of the user.
+func parseExpiry(value string, now time.Time, loc *time.Location) (time.Time, error) {
+	var expiresAt time.Time
+	if d, err := ParseDuration(value); err == nil {
+		expiresAt = now.Add(d)
+	} else if date, err := time.ParseInLocation(time.DateOnly, value, loc); err == nil {
+		expiresAt = date.AddDate(0, 0, 1)
+	} else if at, err := time.ParseInLocation("2006-01-02T15:04", value, loc); err == nil {
+		expiresAt = at
+	} else {
+		return expiresAt, errInvalidExpiry
+	}
+	if !expiresAt.After(now) {
+		return expiresAt, errInvalidExpiry
+	}
+	return expiresAt.UTC(), nil
+}
+
+// expired reports whether the alert outlived its expiry.
+func (a *Alert) expired(now time.Time) bool {
+	return a.ExpiresAt != nil && !now.Before(*a.ExpiresAt)
+}
+
+// validityString renders the expiry, window and archival of an alert for
+// its card, or "" when it has none.
+func (a *Alert) validityString(prefs *Preferences, lang string) string {
+	now := time.Now()
+	if prefs.Cards == CardCompact {
+		if a.ArchivedAt == nil && a.ExpiresAt != nil {
+			return " ⌛" + formatDuration(a.ExpiresAt.Sub(now))
+		}
+		return ""
+	}
+	var lines []string
+	switch {
+	case a.ArchivedAt != nil:
+		lines = append(lines, T(lang, "validity.card_archived", "time", prefs.FormatTime(*a.ArchivedAt)))
+	case a.ExpiresAt != nil:
+		lines = append(lines, T(lang, "validity.card_expires", "time", prefs.FormatTime(*a.ExpiresAt), "remaining", formatDuration(a.ExpiresAt.Sub(now))))
+	}
+	if a.Window != (ActiveWindow{}) {
+		key := "validity.card_window"
+		if !a.Window.contains(now) {
+			key = "validity.card_window_closed"
+		}
+		lines = append(lines, T(lang, key, "window", a.Window.String()))
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return "\n" + strings.Join(lines, "\n")
+}
+
+// setValidity sets the expiry and window of an alert from the --expires and
+// --window flags, where off clears them. It tells the user and returns false
+// when a flag is invalid.
+func (b *TelegramBot) setValidity(c *CommandContext, alert *Alert) (bool, error) {
+	loc := b.preferences(c.UserId).Location()
+	if value, exist := c.Flags["expires"]; exist {
+		if value == "off" {
+			alert.ExpiresAt = nil
+		} else {
+			expiresAt, err := parseExpiry(value, time.Now(), loc)
+			if err != nil {
+				return false, b.sendMessage(c.ChatId, c.T("validity.invalid_expiry"))
+			}
+			alert.ExpiresAt = &expiresAt
+		}
+	}
+	if value, exist := c.Flags["window"]; exist {
+		if value == "off" {
+			alert.Window = ActiveWindow{}
+		} else {
+			window, err := parseWindow(value, loc.String())
+			if err != nil {
+				return false, b.sendMessage(c.ChatId, c.T("validity.invalid_window"))
+			}
+			alert.Window = window
+		}
+	}
+	return true, nil
+}
+
+// archiveAlert retires an expired alert and tells its chat.
+func (b *TelegramBot) archiveAlert(alert *Alert) {
+	now := time.Now().UTC()
+	alert.Active = false
+	alert.ArchivedAt = &now
+	alert.UpdatedAt = now
+	if err := b.store.UpdateAlert(alert); err != nil {
+		log.Println("Error archiving alert", err)
+		return
+	}
+	prefs, lang := b.preferences(alert.UserId), b.userLanguage(alert.UserId)
+	text := T(lang, "validity.expired", "number", alert.Number, "symbol", strings.ToUpper(alert.Symbol), "description", html.EscapeString(alert.Description))
+	b.notify(alert, NotificationExpiry, text, prefs, lang)
+}
+
+// rearm watches a restored alert from the live price, so a target crossed
+// before it was archived doesn't fire it again; trailing stops trail from the
+// live price.
+func (a *Alert) rearm(t *Ticker) {
+	target := a.TargetPrice
+	if a.Kind == AlertTrail {
+		target = a.Trail.stop(t.LivePrice)
+	}
+	a.SetTarget(target, t.LivePrice)
+}
+
+// setAlertValidity handles `/validity <number> --expires=... --window=...`.
+// An archived alert given a new expiry or none is restored.
+func (b *TelegramBot) setAlertValidity(c *CommandContext) error {
+	alertChatId, err := b.alertChat(c, true)
+	if alertChatId == 0 {
+		return err
+	}
+	number, err := strconv.ParseInt(c.Args[0], 10, 32)
+	if err != nil {
+		return b.sendMessage(c.ChatId, c.T("alert.invalid_number"))
+	}
+	alert, err := b.store.GetAlertByNumber(alertChatId, int32(number))
+	if err != nil {
+		return b.sendMessage(c.ChatId, c.T("alert.not_found"))
+	}
+	_, hasExpiry := c.Flags["expires"]
+	_, hasWindow := c.Flags["window"]
+	if !hasExpiry && !hasWindow {
+		return b.sendUsage(c)
+	}
+	if ok, err := b.setValidity(c, alert); !ok {
+		return err
+	}
+	if alert.ArchivedAt != nil && hasExpiry {
+		if ok, err := b.checkAlertQuota(c, alert.Symbol); !ok {
+			return err
+		}
+		if alert.Kind != AlertCompound && alert.Kind != AlertMove {
+			ticker, exists := getTicker(alert.Symbol)
+			if !exists {
+				return b.sendMessage(c.ChatId, c.T("alert.no_live_price"))
+			}
+			alert.rearm(ticker)
+		}
+		alert.ArchivedAt = nil
+		alert.Active = true
+	}
+	alert.UpdatedAt = time.Now().UTC()
+	if err := b.store.UpdateAlert(alert); err != nil {
+		return err
+	}
+	return b.sendMessage(c.ChatId, c.T("validity.updated", "number", alert.Number))
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseWindow(t *testing.T) {
+	tests := []struct {
+		text  string
+		want  ActiveWindow
+		isErr bool
+	}{
+		{text: "London", want: ActiveWindow{Session: "london"}},
+		{text: "weekdays 08:00-16:00", want: ActiveWindow{Days: weekdays, Start: 8 * 60, End: 16 * 60, Zone: "Europe/Berlin"}},
+		{text: "mon,wed,fri", want: ActiveWindow{Days: 1<<time.Monday | 1<<time.Wednesday | 1<<time.Friday, Zone: "Europe/Berlin"}},
+		{text: "fri-mon 22:00-02:00 UTC", want: ActiveWindow{Days: 1<<time.Friday | 1<<time.Saturday | 1<<time.Sunday | 1<<time.Monday, Start: 22 * 60, End: 2 * 60, Zone: "UTC"}},
+		{text: "09:30-16:00 America/New_York", want: ActiveWindow{Days: everyDay, Start: 9*60 + 30, End: 16 * 60, Zone: "America/New_York"}},
+		{text: "daily", isErr: true},
+		{text: "weekdays 8-16", isErr: true},
+		{text: "weekdays 08:00-16:00 Mars/Olympus", isErr: true},
+		{text: "someday", isErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseWindow(tt.text, "Europe/Berlin")
+		if tt.isErr {
+			if err == nil {
+				t.Errorf("parseWindow(%q) expected an error", tt.text)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("parseWindow(%q) = %+v, %v, want %+v", tt.text, got, err, tt.want)
+			continue
+		}
+		// String renders what parseWindow reads
+		if again, err := parseWindow(got.String(), "UTC"); err != nil || again != got {
+			t.Errorf("parseWindow(%q) = %+v, %v, want %+v", got.String(), again, err, got)
+		}
+	}
+}
+
+func TestWindowContains(t *testing.T) {
+	berlin := mustLoadLocation("Europe/Berlin")
+	office, _ := parseWindow("weekdays 08:00-16:00", "Europe/Berlin")
+	night, _ := parseWindow("fri 22:00-02:00", "Europe/Berlin")
+	tests := []struct {
+		name   string
+		window ActiveWindow
+		at     time.Time
+		want   bool
+	}{
+		{name: "office hours", window: office, at: time.Date(2024, 5, 6, 8, 0, 0, 0, berlin), want: true},
+		{name: "after the office", window: office, at: time.Date(2024, 5, 6, 16, 0, 0, 0, berlin)},
+		{name: "saturday", window: office, at: time.Date(2024, 5, 4, 10, 0, 0, 0, berlin)},
+		{name: "friday night", window: night, at: time.Date(2024, 5, 3, 23, 0, 0, 0, berlin), want: true},
+		// the early hours belong to the night the window started on
+		{name: "saturday morning", window: night, at: time.Date(2024, 5, 4, 1, 0, 0, 0, berlin), want: true},
+		{name: "friday morning", window: night, at: time.Date(2024, 5, 3, 1, 0, 0, 0, berlin)},
+		// 08:00 in London is 09:00 in Berlin
+		{name: "london open", window: ActiveWindow{Session: "london"}, at: time.Date(2024, 5, 6, 9, 0, 0, 0, berlin), want: true},
+		{name: "before london", window: ActiveWindow{Session: "london"}, at: time.Date(2024, 5, 6, 8, 59, 0, 0, berlin)},
+		{name: "always", at: time.Date(2024, 5, 4, 3, 0, 0, 0, berlin), want: true},
+	}
+	for _, tt := range tests {
+		if got := tt.window.contains(tt.at); got != tt.want {
+			t.Errorf("%s: contains(%s) = %t, want %t", tt.name, tt.at, got, tt.want)
+		}
+	}
+}
+
+func TestParseExpiry(t *testing.T) {
+	berlin := mustLoadLocation("Europe/Berlin")
+	now := time.Date(2024, 5, 6, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Time
+		isErr bool
+	}{
+		{value: "7d", want: now.AddDate(0, 0, 7)},
+		{value: "12h", want: now.Add(12 * time.Hour)},
+		// a date expires when it ends in the timezone of the user
+		{value: "2024-05-06", want: time.Date(2024, 5, 6, 22, 0, 0, 0, time.UTC)},
+		{value: "2024-05-07T18:00", want: time.Date(2024, 5, 7, 16, 0, 0, 0, time.UTC)},
+		{value: "2024-05-05", isErr: true},
+		{value: "2024-05-06T11:00", isErr: true},
+		{value: "tomorrow", isErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseExpiry(tt.value, now, berlin)
+		if tt.isErr {
+			if err == nil {
+				t.Errorf("parseExpiry(%q) expected an error", tt.value)
+			}
+			continue
+		}
+		if err != nil || !got.Equal(tt.want) {
+			t.Errorf("parseExpiry(%q) = %s, %v, want %s", tt.value, got, err, tt.want)
+		}
+	}
+}
+
+func TestRearm(t *testing.T) {
+	ticker := &Ticker{Symbol: "eurusd", LivePrice: 1.102, PrevPrice: 1.099, RangeHigh: 1.102, RangeLow: 1.099}
+	alert := NewAlert(1, 1, "eurusd", "", 1.1, 1.095)
+	ticker.PrevUpdatedAt, ticker.UpdatedAt = alert.WatchedSince, alert.WatchedSince.Add(time.Minute)
+	alert.observe(ticker)
+	if !alert.triggered(ticker) {
+		t.Fatalf("alert did not trigger at its target")
+	}
+
+	// restored after it was archived, the cross it already saw is forgotten
+	alert.rearm(ticker)
+	ticker.PrevPrice, ticker.RangeHigh, ticker.RangeLow = 1.102, 1.103, 1.101
+	ticker.PrevUpdatedAt, ticker.UpdatedAt = alert.WatchedSince, alert.WatchedSince.Add(time.Minute)
+	alert.observe(ticker)
+	if alert.triggered(ticker) {
+		t.Errorf("restored alert triggered again at %g", ticker.LivePrice)
+	}
+}